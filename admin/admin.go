@@ -0,0 +1,27 @@
+package admin
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+)
+
+const defaultAdminPort int = 9990
+
+var mux = http.NewServeMux()
+
+// Handle registers handler for pattern on the admin server, it has to be
+// called before Start
+func Handle(pattern string, handler http.Handler) {
+	mux.Handle(pattern, handler)
+}
+
+// Start serves the registered admin endpoints on port in a go routine
+func Start(port int) {
+	if port <= 0 {
+		port = defaultAdminPort
+	}
+	go func(addr string) {
+		log.Fatal(http.ListenAndServe(addr, mux))
+	}(":" + strconv.Itoa(port))
+}
@@ -0,0 +1,325 @@
+package alerting
+
+import (
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/flipkart-incubator/go-dmux/logging"
+	"github.com/flipkart-incubator/go-dmux/metrics"
+)
+
+// Conf holds the thresholds alerts are raised at and where they are posted
+type Conf struct {
+	StuckPartitionAfter string      `json:"stuck_partition_after"` //a partition with lag whose commits did not advance this long is stuck, defaults to 10m
+	MaxSinkErrorRatio   *float64    `json:"max_sink_error_ratio"`  //ratio of failed sink calls in an interval above which an alert fires, defaults to 0.5
+	MinSinkCalls        int         `json:"min_sink_calls"`        //sink calls in an interval below which the error ratio is not checked, defaults to 10
+	Interval            string      `json:"interval"`              //how often the conditions are evaluated, defaults to 30s
+	Webhook             WebhookConf `json:"webhook"`               //alerts are posted to the webhook if its url is set
+}
+
+const (
+	defaultStuckPartitionAfter = 10 * time.Minute
+	defaultMaxSinkErrorRatio   = 0.5
+	defaultMinSinkCalls        = 10
+	defaultInterval            = 30 * time.Second
+)
+
+// Name of a condition alerted on
+type Name string
+
+const (
+	// StuckPartition fires for a partition with lag whose committed offset did
+	// not advance for stuck_partition_after
+	StuckPartition Name = "stuck_partition"
+	// PendingAcksFull fires while every pending_acks slot is taken, the source
+	// is blocked till the oldest message is processed
+	PendingAcksFull Name = "pending_acks_full"
+	// SinkErrors fires while the ratio of failed sink calls is above
+	// max_sink_error_ratio
+	SinkErrors Name = "sink_errors"
+)
+
+// Alert is a change of a condition, Firing is false once it is resolved
+type Alert struct {
+	Name       Name      `json:"alert"`
+	Connection string    `json:"connection"`
+	Topic      string    `json:"topic,omitempty"`
+	Partition  *int32    `json:"partition,omitempty"`
+	Firing     bool      `json:"firing"`
+	Message    string    `json:"message"`
+	Time       time.Time `json:"time"`
+}
+
+// thresholds is the parsed Conf
+type thresholds struct {
+	stuckAfter        time.Duration
+	maxSinkErrorRatio float64
+	minSinkCalls      int
+}
+
+var (
+	l           sync.Mutex
+	connections = make(map[string]*Connection)
+	limits      = thresholds{defaultStuckPartitionAfter, defaultMaxSinkErrorRatio, defaultMinSinkCalls}
+	hook        *webhook
+	now         = time.Now
+)
+
+// Start evaluates the conditions of every connection every interval, alerts
+// are published as the dmux_alert_firing metric, logged and posted to the
+// webhook if there is one
+func Start(conf Conf) {
+	t := thresholds{defaultStuckPartitionAfter, defaultMaxSinkErrorRatio, defaultMinSinkCalls}
+	t.stuckAfter = parseDuration("stuck_partition_after", conf.StuckPartitionAfter, t.stuckAfter)
+	if conf.MaxSinkErrorRatio != nil {
+		t.maxSinkErrorRatio = *conf.MaxSinkErrorRatio
+	}
+	if conf.MinSinkCalls > 0 {
+		t.minSinkCalls = conf.MinSinkCalls
+	}
+	interval := parseDuration("interval", conf.Interval, defaultInterval)
+
+	l.Lock()
+	limits = t
+	if conf.Webhook.URL != "" {
+		hook = newWebhook(conf.Webhook)
+	}
+	l.Unlock()
+
+	go func() {
+		for at := range time.Tick(interval) {
+			evaluate(at)
+		}
+	}()
+}
+
+func parseDuration(key, value string, fallback time.Duration) time.Duration {
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatal("invalid alerting " + key + " " + err.Error())
+	}
+	return d
+}
+
+// evaluate the conditions of every connection and publishes the alerts which
+// changed
+func evaluate(at time.Time) {
+	l.Lock()
+	t := limits
+	all := make([]*Connection, 0, len(connections))
+	for _, c := range connections {
+		all = append(all, c)
+	}
+	l.Unlock()
+
+	for _, c := range all {
+		for _, alert := range c.evaluate(at, t) {
+			publish(alert)
+		}
+	}
+}
+
+// publish the change of an alert as metric, log and to the webhook
+func publish(alert Alert) {
+	var firing int64
+	labels := metrics.Labels{Connection: alert.Connection, Alert: string(alert.Name), Topic: alert.Topic}
+	if alert.Partition != nil {
+		labels.Partition = *alert.Partition
+	}
+	if alert.Firing {
+		firing = 1
+	}
+	metrics.Ingest(metrics.Metric{Type: metrics.AlertFiring, Value: firing, Labels: labels})
+
+	logger := logging.ForConnection(alert.Connection)
+	if alert.Firing {
+		logger.Warnf("alert %s firing: %s", alert.Name, alert.Message)
+	} else {
+		logger.Infof("alert %s resolved: %s", alert.Name, alert.Message)
+	}
+
+	l.Lock()
+	h := hook
+	l.Unlock()
+	h.post(alert)
+}
+
+// Connection collects the signals the alerts of one connection are evaluated
+// from. A nil *Connection is valid and ignores every signal
+type Connection struct {
+	name string
+
+	l          sync.Mutex
+	partitions map[partitionKey]*partition
+	pending    []func() (pending, size int)
+
+	success, failure int // sink calls since the last evaluation
+
+	firing map[alertKey]bool
+}
+
+type partitionKey struct {
+	topic     string
+	partition int32
+}
+
+// partition tracks offsets of messages, newest read or produced and last
+// committed
+type partition struct {
+	read, newest, committed int64
+	since                   time.Time // last advance of the commits, or when the lag became positive
+}
+
+type alertKey struct {
+	name Name
+	partitionKey
+}
+
+// ForConnection returns the Connection of name, creating it on first use
+func ForConnection(name string) *Connection {
+	l.Lock()
+	defer l.Unlock()
+	c, ok := connections[name]
+	if !ok {
+		c = &Connection{
+			name:       name,
+			partitions: make(map[partitionKey]*partition),
+			firing:     make(map[alertKey]bool),
+		}
+		connections[name] = c
+	}
+	return c
+}
+
+// partition returns the state of topic and partition, creating it with
+// every message before offset committed
+func (c *Connection) partition(topic string, p int32, offset int64) *partition {
+	key := partitionKey{topic, p}
+	state, ok := c.partitions[key]
+	if !ok {
+		state = &partition{read: offset - 1, newest: offset - 1, committed: offset - 1, since: now()}
+		c.partitions[key] = state
+	}
+	return state
+}
+
+// Read records that the source read offset of a partition
+func (c *Connection) Read(topic string, p int32, offset int64) {
+	if c == nil {
+		return
+	}
+	c.l.Lock()
+	if state := c.partition(topic, p, offset); offset > state.read {
+		state.read = offset
+	}
+	c.l.Unlock()
+}
+
+// Produced records the offset of the newest message of a partition, it is
+// ignored till a message of the partition is read
+func (c *Connection) Produced(topic string, p int32, offset int64) {
+	if c == nil {
+		return
+	}
+	c.l.Lock()
+	if state, ok := c.partitions[partitionKey{topic, p}]; ok && offset > state.newest {
+		state.newest = offset
+	}
+	c.l.Unlock()
+}
+
+// Committed records that every message of a partition up to offset is
+// committed
+func (c *Connection) Committed(topic string, p int32, offset int64) {
+	if c == nil {
+		return
+	}
+	c.l.Lock()
+	if state := c.partition(topic, p, offset); offset > state.committed {
+		state.committed = offset
+		state.since = now()
+	}
+	c.l.Unlock()
+}
+
+// WatchPendingAcks registers the queue of messages waiting to be acked,
+// queue returns how many are pending and how many can be
+func (c *Connection) WatchPendingAcks(queue func() (pending, size int)) {
+	if c == nil {
+		return
+	}
+	c.l.Lock()
+	c.pending = append(c.pending, queue)
+	c.l.Unlock()
+}
+
+// SinkCall records the outcome of one call of the sink
+func (c *Connection) SinkCall(success bool) {
+	if c == nil {
+		return
+	}
+	c.l.Lock()
+	if success {
+		c.success++
+	} else {
+		c.failure++
+	}
+	c.l.Unlock()
+}
+
+// evaluate returns the alerts of c which changed since the last evaluation
+func (c *Connection) evaluate(at time.Time, t thresholds) []Alert {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	var changed []Alert
+	set := func(key alertKey, firing bool, message string) {
+		if c.firing[key] == firing {
+			return
+		}
+		c.firing[key] = firing
+		alert := Alert{Name: key.name, Connection: c.name, Firing: firing, Message: message, Time: at}
+		if key.topic != "" {
+			p := key.partition
+			alert.Topic, alert.Partition = key.topic, &p
+		}
+		changed = append(changed, alert)
+	}
+
+	for key, state := range c.partitions {
+		newest := state.read
+		if state.newest > newest {
+			newest = state.newest
+		}
+		lag := newest - state.committed
+		if lag <= 0 {
+			state.since = at
+		}
+		stalled := at.Sub(state.since)
+		set(alertKey{StuckPartition, key}, lag > 0 && stalled > t.stuckAfter,
+			key.topic+"/"+strconv.Itoa(int(key.partition))+" committed offset "+strconv.FormatInt(state.committed, 10)+
+				" did not advance for "+stalled.Truncate(time.Second).String()+" with lag "+strconv.FormatInt(lag, 10))
+	}
+
+	for _, queue := range c.pending {
+		pending, size := queue()
+		set(alertKey{name: PendingAcksFull}, pending >= size,
+			strconv.Itoa(pending)+" of "+strconv.Itoa(size)+" pending_acks taken")
+	}
+
+	calls := c.success + c.failure
+	ratio := 0.0
+	if calls > 0 {
+		ratio = float64(c.failure) / float64(calls)
+	}
+	set(alertKey{name: SinkErrors}, calls >= t.minSinkCalls && ratio > t.maxSinkErrorRatio,
+		strconv.Itoa(c.failure)+" of "+strconv.Itoa(calls)+" sink calls failed")
+	c.success, c.failure = 0, 0
+
+	return changed
+}
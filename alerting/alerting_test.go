@@ -0,0 +1,107 @@
+package alerting
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvaluate(t *testing.T) {
+	at := time.Unix(1000, 0)
+	now = func() time.Time { return at }
+	defer func() { now = time.Now }()
+	limits := thresholds{stuckAfter: time.Minute, maxSinkErrorRatio: 0.5, minSinkCalls: 4}
+
+	c := ForConnection("orders")
+	defer func() {
+		l.Lock()
+		delete(connections, "orders")
+		l.Unlock()
+	}()
+	pending := 0
+	c.WatchPendingAcks(func() (int, int) { return pending, 2 })
+
+	c.Read("orders", 3, 10)
+	c.Read("orders", 3, 11)
+	c.Committed("orders", 3, 10)
+	c.Produced("orders", 3, 20)
+	c.Produced("orders", 4, 20) // not read yet, ignored
+	at = at.Add(30 * time.Second)
+	assert.Empty(t, c.evaluate(at, limits))
+
+	at = at.Add(time.Minute)
+	partition := int32(3)
+	assert.Equal(t, []Alert{{
+		Name:       StuckPartition,
+		Connection: "orders",
+		Topic:      "orders",
+		Partition:  &partition,
+		Firing:     true,
+		Message:    "orders/3 committed offset 10 did not advance for 1m30s with lag 10",
+		Time:       at,
+	}}, c.evaluate(at, limits))
+	// only changes are alerted
+	assert.Empty(t, c.evaluate(at, limits))
+
+	c.Committed("orders", 3, 11)
+	alerts := c.evaluate(at, limits)
+	assert.Len(t, alerts, 1)
+	assert.False(t, alerts[0].Firing)
+
+	pending = 2
+	c.SinkCall(true)
+	for i := 0; i < 3; i++ {
+		c.SinkCall(false)
+	}
+	alerts = c.evaluate(at, limits)
+	assert.Len(t, alerts, 2)
+	for _, alert := range alerts {
+		assert.True(t, alert.Firing)
+		assert.Nil(t, alert.Partition)
+	}
+	assert.ElementsMatch(t, []string{"2 of 2 pending_acks taken", "3 of 4 sink calls failed"},
+		[]string{alerts[0].Message, alerts[1].Message})
+
+	// sink calls are counted per evaluation
+	pending = 1
+	c.SinkCall(false)
+	alerts = c.evaluate(at, limits)
+	assert.Len(t, alerts, 2)
+	for _, alert := range alerts {
+		assert.False(t, alert.Firing)
+	}
+
+	var disabled *Connection
+	disabled.Read("orders", 3, 10)
+	disabled.SinkCall(false)
+}
+
+func TestWebhook(t *testing.T) {
+	bodies := make(chan []byte, 1)
+	headers := make(chan http.Header, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		headers <- r.Header
+		bodies <- body
+	}))
+	defer server.Close()
+
+	w := newWebhook(WebhookConf{URL: server.URL, Headers: map[string]string{"Authorization": "Bearer token"}})
+	w.post(Alert{Name: SinkErrors, Connection: "orders", Firing: true, Message: "3 of 4 sink calls failed", Time: time.Unix(1000, 0).UTC()})
+
+	assert.Equal(t, "Bearer token", (<-headers).Get("Authorization"))
+	var posted map[string]interface{}
+	assert.NoError(t, json.Unmarshal(<-bodies, &posted))
+	assert.Equal(t, map[string]interface{}{
+		"alert":      "sink_errors",
+		"connection": "orders",
+		"firing":     true,
+		"message":    "3 of 4 sink calls failed",
+		"time":       "1970-01-01T00:16:40Z",
+	}, posted)
+}
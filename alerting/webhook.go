@@ -0,0 +1,87 @@
+package alerting
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// WebhookConf holds where alerts are posted to
+type WebhookConf struct {
+	URL     string            `json:"url"`     //every alert and its resolution is posted as json
+	Headers map[string]string `json:"headers"` //added to every post, e.g. for authentication
+	Timeout string            `json:"timeout"` //of a post, defaults to 10s
+}
+
+const (
+	defaultWebhookTimeout = 10 * time.Second
+	webhookQueueSize      = 256
+)
+
+// webhook posts alerts in a go routine, alerts are dropped rather than
+// blocking when the queue is full
+type webhook struct {
+	conf   WebhookConf
+	client *http.Client
+	alerts chan Alert
+}
+
+func newWebhook(conf WebhookConf) *webhook {
+	w := &webhook{
+		conf:   conf,
+		client: &http.Client{Timeout: parseDuration("webhook.timeout", conf.Timeout, defaultWebhookTimeout)},
+		alerts: make(chan Alert, webhookQueueSize),
+	}
+	go w.run()
+	return w
+}
+
+func (w *webhook) post(alert Alert) {
+	if w == nil {
+		return
+	}
+	select {
+	case w.alerts <- alert:
+	default:
+		log.Printf("webhook queue full, dropped alert %s of %s \n", alert.Name, alert.Connection)
+	}
+}
+
+func (w *webhook) run() {
+	for alert := range w.alerts {
+		if err := w.send(alert); err != nil {
+			log.Printf("failed to post alert %s of %s to webhook %s \n", alert.Name, alert.Connection, err.Error())
+		}
+	}
+}
+
+func (w *webhook) send(alert Alert) error {
+	payload, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("POST", w.conf.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for key, val := range w.conf.Headers {
+		request.Header.Set(key, val)
+	}
+	response, err := w.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	io.Copy(ioutil.Discard, response.Body)
+	if response.StatusCode >= 300 {
+		return errors.New("webhook responded " + strconv.Itoa(response.StatusCode))
+	}
+	return nil
+}
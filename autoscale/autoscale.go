@@ -0,0 +1,305 @@
+package autoscale
+
+import (
+	"log"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/flipkart-incubator/go-dmux/logging"
+	"github.com/flipkart-incubator/go-dmux/metrics"
+)
+
+// Conf holds the bounds and thresholds the workers of a Dmux are resized by.
+// The controller grows the workers additively while the lag is above max_lag
+// and not falling, and shrinks them multiplicatively while the sink fails or
+// is slower than target_latency. Without lag the workers shrink additively
+type Conf struct {
+	Enabled       bool     `json:"enabled"`
+	Min           int      `json:"min"`             //fewest workers, defaults to 1
+	Max           int      `json:"max"`             //most workers, defaults to 4 times dmux.size
+	Interval      string   `json:"interval"`        //how often a resize is decided, defaults to 30s
+	Cooldown      string   `json:"cooldown"`        //least time between two resizes, defaults to 2m
+	MaxLag        int64    `json:"max_lag"`         //lag of the connection above which it grows, defaults to 1000
+	TargetLatency string   `json:"target_latency"`  //mean latency of sink calls above which it shrinks, not checked by default
+	MaxErrorRatio *float64 `json:"max_error_ratio"` //ratio of failed sink calls above which it shrinks, defaults to 0.1
+	MinSinkCalls  int      `json:"min_sink_calls"`  //sink calls in an interval below which latency and errors are not checked, defaults to 10
+	Step          int      `json:"step"`            //workers added or removed while growing or idle, defaults to 1
+	Backoff       float64  `json:"backoff"`         //factor the workers are multiplied with while shrinking, defaults to 0.75
+}
+
+const (
+	defaultInterval      = 30 * time.Second
+	defaultCooldown      = 2 * time.Minute
+	defaultMaxLag        = 1000
+	defaultMaxErrorRatio = 0.1
+	defaultMinSinkCalls  = 10
+	defaultStep          = 1
+	defaultBackoff       = 0.75
+)
+
+// Up and Down are the directions of a resize
+const (
+	Up   = "up"
+	Down = "down"
+)
+
+var (
+	l           sync.Mutex
+	connections = make(map[string]*Connection)
+)
+
+// Connection collects the signals the workers of one connection are resized
+// by. A nil *Connection is valid and ignores every signal
+type Connection struct {
+	l                sync.Mutex
+	success, failure int           // sink calls since the last decision
+	latency          time.Duration // of the sink calls since the last decision
+	calls            int           // sink calls whose latency was recorded
+	lags             map[lagKey]int64
+	forwards         []*Connection // record every lag of this connection too
+}
+
+type lagKey struct {
+	topic     string
+	partition int32
+}
+
+// ForConnection returns the Connection of name, creating it on first use
+func ForConnection(name string) *Connection {
+	l.Lock()
+	defer l.Unlock()
+	c, ok := connections[name]
+	if !ok {
+		c = &Connection{lags: make(map[lagKey]int64)}
+		connections[name] = c
+	}
+	return c
+}
+
+// SinkCall records the outcome of one call of the sink
+func (c *Connection) SinkCall(success bool) {
+	if c == nil {
+		return
+	}
+	c.l.Lock()
+	if success {
+		c.success++
+	} else {
+		c.failure++
+	}
+	c.l.Unlock()
+}
+
+// Latency records how long one call of the sink took
+func (c *Connection) Latency(d time.Duration) {
+	if c == nil {
+		return
+	}
+	c.l.Lock()
+	c.latency += d
+	c.calls++
+	c.l.Unlock()
+}
+
+// Lag records the latest lag of a partition
+func (c *Connection) Lag(topic string, partition int32, lag int64) {
+	if c == nil {
+		return
+	}
+	c.l.Lock()
+	c.lags[lagKey{topic, partition}] = lag
+	forwards := c.forwards
+	c.l.Unlock()
+	for _, to := range forwards {
+		to.Lag(topic, partition, lag)
+	}
+}
+
+// Release forgets the lag of a partition the connection no longer consumes
+func (c *Connection) Release(topic string, partition int32) {
+	if c == nil {
+		return
+	}
+	c.l.Lock()
+	delete(c.lags, lagKey{topic, partition})
+	forwards := c.forwards
+	c.l.Unlock()
+	for _, to := range forwards {
+		to.Release(topic, partition)
+	}
+}
+
+// Forward makes c record every lag into to as well, so the sinks of a fan-out
+// connection are resized by the lag of the connection and by their own sink
+// calls
+func (c *Connection) Forward(to *Connection) {
+	if c == nil {
+		return
+	}
+	c.l.Lock()
+	c.forwards = append(c.forwards, to)
+	c.l.Unlock()
+}
+
+// window is what a Connection recorded since the last decision
+type window struct {
+	success, failure int
+	meanLatency      time.Duration
+	lag              int64
+	lagKnown         bool
+}
+
+// take returns the window and starts the next one, lags are kept
+func (c *Connection) take() window {
+	c.l.Lock()
+	defer c.l.Unlock()
+	w := window{success: c.success, failure: c.failure, lagKnown: len(c.lags) > 0}
+	if c.calls > 0 {
+		w.meanLatency = c.latency / time.Duration(c.calls)
+	}
+	for _, lag := range c.lags {
+		w.lag += lag
+	}
+	c.success, c.failure, c.latency, c.calls = 0, 0, 0, 0
+	return w
+}
+
+// Controller decides the number of workers of the Dmux of a connection
+type Controller struct {
+	name   string
+	signal *Connection
+	logger *logging.Logger
+
+	min, max, step         int
+	interval, cooldown     time.Duration
+	maxLag                 int64
+	targetLatency          time.Duration
+	maxErrorRatio, backoff float64
+	minSinkCalls           int
+
+	resized time.Time // of the last resize
+	lag     int64     // of the last decision, -1 if unknown
+}
+
+// GetController returns the Controller of the connection name whose Dmux
+// starts with size workers, nil if conf is not enabled
+func GetController(name string, conf Conf, size int) *Controller {
+	if !conf.Enabled {
+		return nil
+	}
+	c := &Controller{
+		name:          name,
+		signal:        ForConnection(name),
+		logger:        logging.ForConnection(name),
+		min:           1,
+		max:           4 * size,
+		step:          defaultStep,
+		interval:      parseDuration("interval", conf.Interval, defaultInterval),
+		cooldown:      parseDuration("cooldown", conf.Cooldown, defaultCooldown),
+		maxLag:        defaultMaxLag,
+		targetLatency: parseDuration("target_latency", conf.TargetLatency, 0),
+		maxErrorRatio: defaultMaxErrorRatio,
+		backoff:       defaultBackoff,
+		minSinkCalls:  defaultMinSinkCalls,
+		lag:           -1,
+	}
+	if conf.Min > 0 {
+		c.min = conf.Min
+	}
+	if conf.Max > 0 {
+		c.max = conf.Max
+	}
+	if conf.Step > 0 {
+		c.step = conf.Step
+	}
+	if conf.MaxLag > 0 {
+		c.maxLag = conf.MaxLag
+	}
+	if conf.MaxErrorRatio != nil {
+		c.maxErrorRatio = *conf.MaxErrorRatio
+	}
+	if conf.MinSinkCalls > 0 {
+		c.minSinkCalls = conf.MinSinkCalls
+	}
+	if conf.Backoff > 0 && conf.Backoff < 1 {
+		c.backoff = conf.Backoff
+	}
+	if c.min > c.max {
+		log.Fatal("autoscale min " + strconv.Itoa(c.min) + " is above max " + strconv.Itoa(c.max))
+	}
+	return c
+}
+
+func parseDuration(key, value string, fallback time.Duration) time.Duration {
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatal("invalid autoscale " + key + " " + err.Error())
+	}
+	return d
+}
+
+// Interval returns how often Decide is expected to be called
+func (c *Controller) Interval() time.Duration {
+	return c.interval
+}
+
+// Decide returns the number of workers the Dmux with size workers should
+// have at, size if it should not be resized. Every decision is exported as
+// the dmux_workers metric and every resize is logged and counted
+func (c *Controller) Decide(size int, at time.Time) int {
+	w := c.signal.take()
+	lag := c.lag
+	if w.lagKnown {
+		c.lag = w.lag
+	}
+
+	next, reason := c.decide(size, w, lag)
+	if next != size && at.Sub(c.resized) < c.cooldown {
+		c.logger.Debugf("autoscale holding %d workers in cooldown: %s", size, reason)
+		next = size
+	}
+	if next != size {
+		direction := Up
+		if next < size {
+			direction = Down
+		}
+		c.resized = at
+		c.logger.Infof("autoscale resizing from %d to %d workers: %s", size, next, reason)
+		metrics.Ingest(metrics.Metric{Type: metrics.Resizes, Value: 1, Labels: metrics.Labels{Connection: c.name, Direction: direction}})
+	}
+	metrics.Ingest(metrics.Metric{Type: metrics.Workers, Value: int64(next), Labels: metrics.Labels{Connection: c.name}})
+	return next
+}
+
+// decide applies the thresholds to a window, previous is the lag of the last
+// decision or -1. It returns the bounded size and why
+func (c *Controller) decide(size int, w window, previous int64) (int, string) {
+	next, reason := size, "steady"
+	calls := w.success + w.failure
+	switch {
+	case calls >= c.minSinkCalls && float64(w.failure)/float64(calls) > c.maxErrorRatio:
+		next = int(math.Floor(float64(size) * c.backoff))
+		reason = strconv.Itoa(w.failure) + " of " + strconv.Itoa(calls) + " sink calls failed"
+	case c.targetLatency > 0 && calls >= c.minSinkCalls && w.meanLatency > c.targetLatency:
+		next = int(math.Floor(float64(size) * c.backoff))
+		reason = "mean sink latency " + w.meanLatency.String() + " is above " + c.targetLatency.String()
+	case w.lagKnown && w.lag > c.maxLag && (previous < 0 || w.lag >= previous):
+		next = size + c.step
+		reason = "lag " + strconv.FormatInt(w.lag, 10) + " is above " + strconv.FormatInt(c.maxLag, 10) + " and not falling"
+	case w.lagKnown && w.lag == 0:
+		next = size - c.step
+		reason = "no lag"
+	}
+	if next < c.min {
+		next = c.min
+	}
+	if next > c.max {
+		next = c.max
+	}
+	return next, reason
+}
@@ -0,0 +1,78 @@
+package autoscale
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecide(t *testing.T) {
+	assert.Nil(t, GetController("orders", Conf{}, 4))
+
+	c := GetController("orders", Conf{Enabled: true, Max: 10, Cooldown: "1m", TargetLatency: "100ms"}, 4)
+	defer func() {
+		l.Lock()
+		delete(connections, "orders")
+		l.Unlock()
+	}()
+	signal := ForConnection("orders")
+	at := time.Unix(1000, 0)
+
+	// lag above max_lag and not falling grows by step
+	signal.Lag("orders", 0, 800)
+	signal.Lag("orders", 1, 400)
+	assert.Equal(t, 5, c.Decide(4, at))
+
+	// in cooldown
+	signal.Lag("orders", 0, 900)
+	assert.Equal(t, 5, c.Decide(5, at.Add(30*time.Second)))
+
+	// falling lag holds
+	signal.Lag("orders", 0, 700)
+	assert.Equal(t, 5, c.Decide(5, at.Add(2*time.Minute)))
+
+	// errors shrink multiplicatively
+	for i := 0; i < 10; i++ {
+		signal.SinkCall(i < 8)
+		signal.Latency(10 * time.Millisecond)
+	}
+	signal.Lag("orders", 0, 5000)
+	assert.Equal(t, 6, c.Decide(8, at.Add(4*time.Minute)))
+
+	// slow sink shrinks, down to min
+	for i := 0; i < 10; i++ {
+		signal.SinkCall(true)
+		signal.Latency(200 * time.Millisecond)
+	}
+	assert.Equal(t, 1, c.Decide(1, at.Add(6*time.Minute)))
+
+	// no lag shrinks by step, up to max
+	signal.Lag("orders", 0, 0)
+	signal.Lag("orders", 1, 0)
+	assert.Equal(t, 3, c.Decide(4, at.Add(8*time.Minute)))
+	signal.Lag("orders", 0, 5000)
+	assert.Equal(t, 10, c.Decide(10, at.Add(10*time.Minute)))
+
+	var disabled *Connection
+	disabled.SinkCall(false)
+	disabled.Lag("orders", 0, 1)
+}
+
+func TestForward(t *testing.T) {
+	defer func() {
+		l.Lock()
+		delete(connections, "orders")
+		delete(connections, "orders.search")
+		l.Unlock()
+	}()
+	signal, branch := ForConnection("orders"), ForConnection("orders.search")
+	signal.Forward(branch)
+	signal.Lag("orders", 0, 700)
+	signal.SinkCall(false)
+	branch.SinkCall(true)
+
+	// the branch gets the lag of the connection and keeps its own sink calls
+	w := branch.take()
+	assert.Equal(t, window{success: 1, lag: 700, lagKnown: true}, w)
+}
@@ -2,13 +2,19 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	sideline_models "github.com/flipkart-incubator/go-dmux/sideline"
 	"io/ioutil"
 	"log"
 	"os"
 
+	"github.com/flipkart-incubator/go-dmux/alerting"
 	"github.com/flipkart-incubator/go-dmux/connection"
+	"github.com/flipkart-incubator/go-dmux/health"
 	"github.com/flipkart-incubator/go-dmux/logging"
+	"github.com/flipkart-incubator/go-dmux/metrics"
+	"github.com/flipkart-incubator/go-dmux/tracing"
+	"github.com/sirupsen/logrus"
 )
 
 // ConnectionType based on this type of Connection and related forks happen
@@ -44,11 +50,23 @@ func (c ConnectionType) getConfig(data []byte) interface{} {
 	}
 }
 
-// Start invokes Run of the respective connection in a go routine
-func (c ConnectionType) Start(conf interface{}, enableDebug bool, sidelineImpl interface{}) {
+// Start invokes Run of the respective connection, name is the name of the dmuxItem.
+//
+// Deprecated: debug logs follow logging.level, use Run. enableDebug true sets the
+// log level to debug as it was the only source of debug logs before.
+func (c ConnectionType) Start(name string, conf interface{}, enableDebug bool, sidelineImpl interface{}) {
+	if enableDebug {
+		logging.SetLevel(logrus.DebugLevel)
+	}
+	c.Run(name, conf, sidelineImpl)
+}
+
+// Run invokes Run of the respective connection, name is the name of the dmuxItem
+func (c ConnectionType) Run(name string, conf interface{}, sidelineImpl interface{}) {
 	switch c {
 	case KafkaHTTP:
 		if sidelineImpl != nil {
+			health.ForConnection(name).ExpectSideline()
 			confBytes, err := json.Marshal(conf)
 			if err != nil {
 				log.Fatal("Error in InitialisePlugin " + err.Error())
@@ -57,25 +75,26 @@ func (c ConnectionType) Start(conf interface{}, enableDebug bool, sidelineImpl i
 			if initErr != nil {
 				log.Fatal(initErr.Error())
 			}
+			health.ForConnection(name).SidelineInitialised()
 		}
 		connObj := &connection.KafkaHTTPConn{
-			EnableDebugLog: enableDebug,
-			Conf:           conf,
-			SidelineImpl:   sidelineImpl,
+			Name:         name,
+			Conf:         conf,
+			SidelineImpl: sidelineImpl,
 		}
 		log.Println("Starting ", KafkaHTTP)
 		connObj.Run()
 	case KafkaFoxtrot:
 		connObj := &connection.KafkaFoxtrotConn{
-			EnableDebugLog: enableDebug,
-			Conf:           conf,
+			Name: name,
+			Conf: conf,
 		}
 		log.Println("Starting ", KafkaFoxtrot)
 		connObj.Run()
 	case PulsarHTTP:
 		connObj := &connection.PulsarConn{
-			EnableDebugLog: enableDebug,
-			Conf:           conf,
+			Name: name,
+			Conf: conf,
 		}
 		log.Println("Starting ", PulsarHTTP)
 		connObj.Run()
@@ -97,6 +116,18 @@ type DmuxConf struct {
 	// DMuxMap    map[string]KafkaHTTPConnConfig `json:"dmuxMap"`
 	MetricPort int             `json:"metric_port"`
 	Logging    logging.LogConf `json:"logging"`
+
+	LegacyOffsetMetrics bool `json:"legacy_offset_metrics"` // also publish offset_metrics with dot encoded keys, deprecated
+
+	Metrics []metrics.BackendConf `json:"metrics"` // backends the metrics are published to, prometheus on metric_port if empty
+
+	AdminPort int `json:"admin_port"` // port of the admin endpoints, defaults to 9990
+
+	Tracing tracing.Conf `json:"tracing"` // OTLP tracing of messages, disabled by default
+
+	Health health.Conf `json:"health"` // thresholds of /health/ready
+
+	Alerting alerting.Conf `json:"alerting"` // thresholds of the alerts and the webhook they are posted to
 }
 
 // DmuxItem struct defines name and type of connection
@@ -123,3 +154,32 @@ func (s DMuxConfigSetting) GetDmuxConf() DmuxConf {
 
 	return conf
 }
+
+// ReplayConnection returns the Connection of a kafka DmuxItem with its source
+// bounded to replay from..to. Empty from or to keep the replay settings of the
+// item, if any.
+func (d DmuxItem) ReplayConnection(from, to string) (interface{}, error) {
+	if d.ConnType != KafkaHTTP && d.ConnType != KafkaFoxtrot {
+		return nil, fmt.Errorf("replay is not supported for %s connections", d.ConnType)
+	}
+	conn, ok := d.Connection.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid connection of %s", d.Name)
+	}
+	src, ok := conn["source"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("missing source in connection of %s", d.Name)
+	}
+	replay, ok := src["replay"].(map[string]interface{})
+	if !ok {
+		replay = make(map[string]interface{})
+	}
+	if from != "" {
+		replay["from"] = from
+	}
+	if to != "" {
+		replay["to"] = to
+	}
+	src["replay"] = replay
+	return conn, nil
+}
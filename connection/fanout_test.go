@@ -0,0 +1,66 @@
+package connection
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/flipkart-incubator/go-dmux/core"
+	"github.com/flipkart-incubator/go-dmux/health"
+	sink "github.com/flipkart-incubator/go-dmux/http"
+	"github.com/flipkart-incubator/go-dmux/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+// joinedSource reports joined and producing like a kafka source and pushes
+// msgs
+type joinedSource struct {
+	name string
+	msgs []*KafkaMessage
+}
+
+func (s *joinedSource) Generate(out chan<- interface{}) {
+	h := health.ForConnection(s.name)
+	h.Joined(true)
+	h.Producing(true)
+	for _, msg := range s.msgs {
+		out <- msg
+	}
+}
+
+func (s *joinedSource) Stop()                              {}
+func (s *joinedSource) GetKey(msg interface{}) []byte      { return msg.(*KafkaMessage).Msg.Key }
+func (s *joinedSource) GetPartition(msg interface{}) int32 { return msg.(*KafkaMessage).Msg.Partition }
+func (s *joinedSource) GetValue(msg interface{}) []byte    { return msg.(*KafkaMessage).Msg.Value }
+func (s *joinedSource) GetOffset(msg interface{}) int64    { return msg.(*KafkaMessage).Msg.Offset }
+
+func TestFanOutHealth(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	defer server.Close()
+
+	msg := &KafkaMessage{Msg: &sarama.ConsumerMessage{Topic: "orders", Key: []byte("k"), Value: []byte("v")}}
+	src := &joinedSource{name: "fanout", msgs: []*KafkaMessage{msg}}
+	conf := sink.HTTPSinkConf{Endpoint: server.URL, Method: "POST", Timeout: core.Duration{Duration: time.Second}}
+	c := &KafkaHTTPConn{Name: "fanout"}
+	c.connectFanOut(src, []FanOutSinkConf{
+		{Name: "search", Dmux: core.DmuxConf{Size: 1}, Sink: conf},
+		{Name: "billing", Optional: true, Dmux: core.DmuxConf{Size: 1}, Sink: conf},
+	}, GetKafkaHook(nil, logging.ForConnection("fanout")), nil)
+
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&calls) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the sinks report as the connection, which is ready once its source joined
+	ready, statuses := health.Ready()
+	assert.True(t, ready, statuses)
+	assert.Contains(t, statuses, "fanout")
+	assert.NotContains(t, statuses, "fanout.search")
+	assert.NotContains(t, statuses, "fanout.billing")
+}
@@ -4,14 +4,18 @@ import (
 	"encoding/json"
 	"github.com/flipkart-incubator/go-dmux/offset_monitor"
 	"log"
-	"os"
 	"strconv"
 	"strings"
 
 	"github.com/Shopify/sarama"
+	"github.com/flipkart-incubator/go-dmux/alerting"
 	"github.com/flipkart-incubator/go-dmux/core"
+	"github.com/flipkart-incubator/go-dmux/filter"
+	"github.com/flipkart-incubator/go-dmux/health"
 	sink "github.com/flipkart-incubator/go-dmux/http"
 	source "github.com/flipkart-incubator/go-dmux/kafka"
+	"github.com/flipkart-incubator/go-dmux/logging"
+	"github.com/flipkart-incubator/go-dmux/plugin"
 )
 
 // **************** CONFIG ***********
@@ -23,11 +27,11 @@ type KafkaFoxtrotConnConfig struct {
 
 // KafkaFoxtrotConn struct to abstract this connections Run
 type KafkaFoxtrotConn struct {
-	EnableDebugLog bool
-	Conf           interface{}
+	Name string
+	Conf interface{}
 }
 
-// CustomURLKey  place holder name, which will be replaced by kafka key
+// CustomURLKey  place holder name, which will be replaced by the ordering key
 const CustomURLKey = "__KEY_NAME__"
 
 func (c *KafkaFoxtrotConn) getConfiguration() *KafkaFoxtrotConnConfig {
@@ -40,29 +44,41 @@ func (c *KafkaFoxtrotConn) getConfiguration() *KafkaFoxtrotConnConfig {
 // Run method to start this Connection from source to sink
 func (c *KafkaFoxtrotConn) Run() {
 	conf := c.getConfiguration()
-	log.Println("starting kafka_foxtrot with conf", conf)
-	if c.EnableDebugLog {
-		// enable sarama logs if booted with debug logs
-		log.Println("enabling sarama logs")
-		sarama.Logger = log.New(os.Stdout, "[Sarama] ", log.LstdFlags)
-	}
-	kafkaMsgFactory := getKafkaFoxtrotFactory()
-	offMonitor := offset_monitor.GetOffMonitor(conf.OffsetMonitor)
+	logger := logging.ForConnection(c.Name)
+	logger.Infof("starting kafka_foxtrot with conf %v", conf)
+	// sarama logs are written while the log level is debug
+	sarama.Logger = log.New(logging.DebugWriter(), "[Sarama] ", 0)
+	pl := plugin.GetPlugin(c.Name, conf.Dmux.Plugin, conf.Dmux.Size)
+	kafkaMsgFactory := getKafkaFoxtrotFactory(core.GetKeyExtractor(conf.Dmux.OrderingKey), pl)
+	offMonitor := offset_monitor.GetOffMonitor(conf.OffsetMonitor, c.Name)
 	src := source.GetKafkaSource(conf.Source, kafkaMsgFactory, offMonitor)
+	src.SetHealth(health.ForConnection(c.Name))
+	src.SetAlerts(alerting.ForConnection(c.Name))
+	src.SetFilter(filter.GetFilter(c.Name, conf.Dmux.Filter))
+	src.SetPlugin(pl)
 	offsetTracker := source.GetKafkaOffsetTracker(conf.PendingAcks, src)
-	hook := GetKafkaHook(offsetTracker, c.EnableDebugLog)
+	hook := GetKafkaHook(offsetTracker, logger)
+	var stats *source.ReplayStats
+	if conf.Source.Replay != nil {
+		stats = countReplay(offsetTracker)
+	}
 	sk := sink.GetHTTPSink(conf.Dmux.Size, conf.Sink)
 	sk.RegisterHook(hook)
+	sk.SetConnection(c.Name)
+	sk.SetPlugin(pl)
 	src.RegisterHook(hook)
 
 	//hash distribution
 	h := GetKafkaMsgHasher()
 
-	d := core.GetDistribution(conf.Dmux.DistributorType, h)
+	d := core.GetDistribution(conf.Dmux.DistributorType, h, GetKafkaMsgPartitioner())
 
 	dmux := core.GetDmux(conf.Dmux, d)
-	var optionalParams core.DmuxOptionalParams = core.DmuxOptionalParams{c.EnableDebugLog}
+	var optionalParams core.DmuxOptionalParams = core.DmuxOptionalParams{Connection: c.Name, Logger: logger}
 	dmux.ConnectWithSideline(src, sk, nil, optionalParams)
+	if conf.Source.Replay != nil {
+		awaitReplay(conf.Source.ConsumerGroupName, src, offsetTracker, stats, dmux)
+	}
 	dmux.Join()
 }
 
@@ -73,18 +89,22 @@ type KafkaFoxtrotMessage struct {
 	KafkaMessage
 }
 
-func getKafkaFoxtrotFactory() source.KafkaMsgFactory {
-	return new(kafkaFoxtrotFactoryImpl)
+func getKafkaFoxtrotFactory(keys *core.KeyExtractor, pl *plugin.Plugin) source.KafkaMsgFactory {
+	return &kafkaFoxtrotFactoryImpl{keys, pl}
 }
 
 type kafkaFoxtrotFactoryImpl struct {
+	keys   *core.KeyExtractor
+	plugin *plugin.Plugin
 }
 
 // Create KafkaMessage which implments KafkaMsg and HTTPMsg and wraps sarama.ConsumerMessage
-func (*kafkaFoxtrotFactoryImpl) Create(msg *sarama.ConsumerMessage) source.KafkaMsg {
+func (f *kafkaFoxtrotFactoryImpl) Create(msg *sarama.ConsumerMessage) source.KafkaMsg {
 	kafkaMsg := &KafkaFoxtrotMessage{}
 	kafkaMsg.KafkaMessage.Msg = msg
 	kafkaMsg.KafkaMessage.Processed = false
+	kafkaMsg.KafkaMessage.Trace = startKafkaTrace(msg)
+	kafkaMsg.KafkaMessage.OrderingKey = orderingKey(f.keys, f.plugin, &kafkaMsg.KafkaMessage)
 	return kafkaMsg
 }
 
@@ -92,7 +112,7 @@ func (*kafkaFoxtrotFactoryImpl) Create(msg *sarama.ConsumerMessage) source.Kafka
 
 // GetPayload implements HTTPMsg for HttpSink processing
 func (k *KafkaFoxtrotMessage) GetPayload() []byte {
-	return k.Msg.Value
+	return k.KafkaMessage.GetPayload()
 }
 
 // GetHeaders implements HTTPMsg for HttpSink processing
@@ -110,7 +130,7 @@ func (k *KafkaFoxtrotMessage) GetHeaders(conf sink.HTTPSinkConf) map[string]stri
 // This implementation passes in query parameter partition and offset for debuggin
 func (k *KafkaFoxtrotMessage) GetURL(endpoint string) string {
 	// log.Println("In GetURL ")
-	url := strings.Replace(endpoint, CustomURLKey, string(k.Msg.Key), 1)
+	url := strings.Replace(endpoint, CustomURLKey, string(k.OrderingKey), 1)
 	//debug query string to help in debuggin
 	url = url + "?debug=" + k.Msg.Topic + "," + strconv.FormatInt(int64(k.Msg.Partition), 10) +
 		// "," + string(k.Msg.Key)
@@ -130,7 +150,7 @@ func (k *KafkaFoxtrotMessage) GetDebugPath() string {
 // BatchURL implements HTTPMsg for HttpSink processing
 // This implementation passes in query parameter partition and offset for debuggin
 func (k *KafkaFoxtrotMessage) BatchURL(msgs []interface{}, endpoint string, version int) string {
-	url := strings.Replace(endpoint, CustomURLKey, string(k.Msg.Key), 1)
+	url := strings.Replace(endpoint, CustomURLKey, string(k.OrderingKey), 1)
 	url = url + "/bulk"
 
 	var builder strings.Builder
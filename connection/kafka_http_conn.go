@@ -6,14 +6,21 @@ import (
 	sideline_models "github.com/flipkart-incubator/go-dmux/sideline"
 	"hash/fnv"
 	"log"
-	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Shopify/sarama"
+	"github.com/flipkart-incubator/go-dmux/alerting"
 	"github.com/flipkart-incubator/go-dmux/core"
+	"github.com/flipkart-incubator/go-dmux/filter"
+	"github.com/flipkart-incubator/go-dmux/health"
 	sink "github.com/flipkart-incubator/go-dmux/http"
 	source "github.com/flipkart-incubator/go-dmux/kafka"
+	"github.com/flipkart-incubator/go-dmux/logging"
+	"github.com/flipkart-incubator/go-dmux/plugin"
+	"github.com/flipkart-incubator/go-dmux/tracing"
+	"github.com/flipkart-incubator/go-dmux/transform"
 )
 
 // **************** CONFIG ***********
@@ -25,13 +32,23 @@ type KafkaHTTPConnConfig struct {
 	Sink          sink.HTTPSinkConf             `json:"sink"`
 	PendingAcks   int                           `json:"pending_acks"`
 	OffsetMonitor offset_monitor.OffMonitorConf `json:"offset_monitor"`
+	Sinks         []FanOutSinkConf              `json:"sinks"` // deliver every message to each of these sinks instead of sink
+}
+
+// FanOutSinkConf holds config of a named sink of a fan-out connection and of
+// the dmux feeding it
+type FanOutSinkConf struct {
+	Name     string            `json:"name"`
+	Optional bool              `json:"optional"` // best effort, offsets are committed without waiting for it and it skips messages while it is behind
+	Dmux     core.DmuxConf     `json:"dmux"`
+	Sink     sink.HTTPSinkConf `json:"sink"`
 }
 
 // KafkaHTTPConn struct to abstract this connections Run
 type KafkaHTTPConn struct {
-	EnableDebugLog bool
-	Conf           interface{}
-	SidelineImpl   interface{}
+	Name         string
+	Conf         interface{}
+	SidelineImpl interface{}
 }
 
 func (c *KafkaHTTPConn) getConfiguration() *KafkaHTTPConnConfig {
@@ -44,34 +61,94 @@ func (c *KafkaHTTPConn) getConfiguration() *KafkaHTTPConnConfig {
 // Run method to start this Connection from source to sink
 func (c *KafkaHTTPConn) Run() {
 	conf := c.getConfiguration()
-	log.Println("starting go-dmux with conf", conf)
-	if c.EnableDebugLog {
-		// enable sarama logs if booted with debug logs
-		log.Println("enabling sarama logs")
-		sarama.Logger = log.New(os.Stdout, "[Sarama] ", log.LstdFlags)
-	}
-	kafkaMsgFactory := getKafkaHTTPFactory()
-	offMonitor := offset_monitor.GetOffMonitor(conf.OffsetMonitor)
+	logger := logging.ForConnection(c.Name)
+	logger.Infof("starting go-dmux with conf %v", conf)
+	// sarama logs are written while the log level is debug
+	sarama.Logger = log.New(logging.DebugWriter(), "[Sarama] ", 0)
+	pl := plugin.GetPlugin(c.Name, conf.Dmux.Plugin, conf.workers())
+	kafkaMsgFactory := getKafkaHTTPFactory(core.GetKeyExtractor(conf.Dmux.OrderingKey), pl)
+	offMonitor := offset_monitor.GetOffMonitor(conf.OffsetMonitor, c.Name)
 	src := source.GetKafkaSource(conf.Source, kafkaMsgFactory, offMonitor)
+	src.SetHealth(health.ForConnection(c.Name))
+	src.SetAlerts(alerting.ForConnection(c.Name))
+	src.SetFilter(filter.GetFilter(c.Name, conf.Dmux.Filter))
+	src.SetPlugin(pl)
 	offsetTracker := source.GetKafkaOffsetTracker(conf.PendingAcks, src)
-	hook := GetKafkaHook(offsetTracker, c.EnableDebugLog)
-	sk := sink.GetHTTPSink(conf.Dmux.Size, conf.Sink)
-	sk.RegisterHook(hook)
+	hook := GetKafkaHook(offsetTracker, logger)
+	var stats *source.ReplayStats
+	if conf.Source.Replay != nil {
+		stats = countReplay(offsetTracker)
+	}
 	src.RegisterHook(hook)
 
+	var dmuxes []*core.Dmux
+	if len(conf.Sinks) == 0 {
+		sk := sink.GetHTTPSink(conf.Dmux.Size, conf.Sink)
+		sk.RegisterHook(hook)
+		sk.SetConnection(c.Name)
+		sk.SetPlugin(pl)
+		dmuxes = append(dmuxes, c.connect(src, sk, conf.Dmux, c.Name, logger))
+	} else {
+		dmuxes = c.connectFanOut(src, conf.Sinks, hook, pl)
+	}
+	if conf.Source.Replay != nil {
+		awaitReplay(conf.Source.ConsumerGroupName, src, offsetTracker, stats, dmuxes...)
+	}
+	for _, dmux := range dmuxes {
+		dmux.Join()
+	}
+}
+
+// workers returns the workers of the connection, of every sink with fan-out
+func (conf *KafkaHTTPConnConfig) workers() int {
+	if len(conf.Sinks) == 0 {
+		return conf.Dmux.Size
+	}
+	workers := 0
+	for _, s := range conf.Sinks {
+		workers += s.Dmux.Size
+	}
+	return workers
+}
+
+// connectFanOut runs a dmux per sink of sinks, each fed by a branch of a
+// fan-out of src. The sinks report health and alerts as the connection
+func (c *KafkaHTTPConn) connectFanOut(src core.Source, sinks []FanOutSinkConf, hook sink.HTTPSinkHook, pl *plugin.Plugin) []*core.Dmux {
+	fanOut := core.GetFanOut(src, c.Name)
+	names := make(map[string]bool)
+	var dmuxes []*core.Dmux
+	for _, s := range sinks {
+		if s.Name == "" || names[s.Name] {
+			log.Fatal("sinks of " + c.Name + " need unique names, found " + strconv.Quote(s.Name))
+		}
+		names[s.Name] = true
+		branch := fanOut.Branch(s.Name, !s.Optional)
+		sk := sink.GetHTTPSink(s.Dmux.Size, s.Sink)
+		sk.RegisterHook(hook)
+		sk.SetConnection(c.Name)
+		sk.SetBranch(branch.Connection())
+		sk.SetPlugin(pl)
+		dmuxes = append(dmuxes, c.connect(branch, sk, s.Dmux, branch.Connection(), logging.ForConnection(branch.Connection())))
+	}
+	return dmuxes
+}
+
+// connect runs a dmux of conf from src to sk, sidelining if the connection
+// has a sideline plugin
+func (c *KafkaHTTPConn) connect(src core.Source, sk core.Sink, conf core.DmuxConf, name string, logger *logging.Logger) *core.Dmux {
 	//hash distribution
 	h := GetKafkaMsgHasher()
 
-	d := core.GetDistribution(conf.Dmux.DistributorType, h)
+	d := core.GetDistribution(conf.DistributorType, h, GetKafkaMsgPartitioner())
 
-	dmux := core.GetDmux(conf.Dmux, d)
-	var optionalParams core.DmuxOptionalParams = core.DmuxOptionalParams{c.EnableDebugLog}
+	dmux := core.GetDmux(conf, d)
+	var optionalParams core.DmuxOptionalParams = core.DmuxOptionalParams{Connection: name, Logger: logger}
 	if c.SidelineImpl != nil {
 		dmux.ConnectWithSideline(src, sk, c.SidelineImpl.(sideline_models.CheckMessageSideline), optionalParams)
 	} else {
 		dmux.ConnectWithSideline(src, sk, nil, optionalParams)
 	}
-	dmux.Join()
+	return dmux
 }
 
 /*
@@ -96,26 +173,82 @@ type KafkaMessage struct {
 	Processed bool   //marker to know once this message has been processed by Sink
 	Sidelined bool   // marker to know if the message gets sideliend
 	URL       string // added to avoid GetURLPath to repeate concat during logging
+
+	Trace *tracing.Trace // nil unless tracing is enabled
+
+	OrderingKey []byte // key the message is distributed and sidelined by
+	Payload     []byte // value as transformed by the sink, nil to post the value of the record
+
+	delivered func() // of a fan-out copy, called once it is processed or sidelined
 }
 
-func getKafkaHTTPFactory() source.KafkaMsgFactory {
-	return new(kafkaHTTPFactoryImpl)
+func getKafkaHTTPFactory(keys *core.KeyExtractor, pl *plugin.Plugin) source.KafkaMsgFactory {
+	return &kafkaHTTPFactoryImpl{keys, pl}
 }
 
 type kafkaHTTPFactoryImpl struct {
+	keys   *core.KeyExtractor
+	plugin *plugin.Plugin
 }
 
 // Create KafkaMessage which implments KafkaMsg and HTTPMsg and wraps sarama.ConsumerMessage
-func (*kafkaHTTPFactoryImpl) Create(msg *sarama.ConsumerMessage) source.KafkaMsg {
-	return &KafkaMessage{
+func (f *kafkaHTTPFactoryImpl) Create(msg *sarama.ConsumerMessage) source.KafkaMsg {
+	kafkaMsg := &KafkaMessage{
 		Msg:       msg,
 		Processed: false,
+		Trace:     startKafkaTrace(msg),
+	}
+	kafkaMsg.OrderingKey = orderingKey(f.keys, f.plugin, kafkaMsg)
+	return kafkaMsg
+}
+
+// orderingKey returns the ordering key of k as the key function of the plugin
+// returns it, or else as keys extracts it
+func orderingKey(keys *core.KeyExtractor, pl *plugin.Plugin, k *KafkaMessage) []byte {
+	if pl != nil {
+		if key := pl.Key(k.GetTransformRecord()); key != nil {
+			return key
+		}
 	}
+	return keys.Extract(k.Msg.Key, k.Msg.Value, source.RecordHeader(k.Msg))
+}
+
+// startKafkaTrace starts the Trace of msg, continuing the trace of its
+// traceparent record header if it has one
+func startKafkaTrace(msg *sarama.ConsumerMessage) *tracing.Trace {
+	if !tracing.Enabled() {
+		return nil
+	}
+	traceparent := ""
+	for _, h := range msg.Headers {
+		if h != nil && string(h.Key) == tracing.Header {
+			traceparent = string(h.Value)
+		}
+	}
+	return tracing.StartTrace(traceparent,
+		tracing.String("messaging.system", "kafka"),
+		tracing.String("messaging.destination", msg.Topic),
+		tracing.Int("messaging.kafka.partition", int64(msg.Partition)),
+		tracing.Int("messaging.kafka.offset", msg.Offset))
 }
 
 // MarkDone the  KafkaMessage as processed
 func (k *KafkaMessage) MarkDone() {
 	k.Processed = true
+	if k.delivered != nil {
+		k.delivered()
+	}
+}
+
+// Copy implements core.FanOutMsg, the copy shares the record, trace and
+// ordering key of k
+func (k *KafkaMessage) Copy(delivered func()) interface{} {
+	return &KafkaMessage{
+		Msg:         k.Msg,
+		Trace:       k.Trace,
+		OrderingKey: k.OrderingKey,
+		delivered:   delivered,
+	}
 }
 
 // GetRawMsg returns saram.ConsumerMessage under KafkaMessage
@@ -128,35 +261,50 @@ func (k *KafkaMessage) IsProcessed() bool {
 	return k.Processed
 }
 
+// MarkSidelined the KafkaMessage as sidelined, a sidelined message is also
+// processed as far as offsets are concerned
+func (k *KafkaMessage) MarkSidelined() {
+	k.Sidelined = true
+	k.MarkDone()
+}
+
+// IsSidelined returns true if KafkaMessage was MarkSidelined
+func (k *KafkaMessage) IsSidelined() bool {
+	return k.Sidelined
+}
+
+// GetOrderingKey implements core.OrderingKeyMsg
+func (k *KafkaMessage) GetOrderingKey() []byte {
+	return k.OrderingKey
+}
+
+// GetTrace implements tracing.Traced
+func (k *KafkaMessage) GetTrace() *tracing.Trace {
+	return k.Trace
+}
+
 // *****************************************
 
 // **************** Hooks ***********
 
 // KafkaOffsetHook implments HTTPSinkHook amd KafkaSourceHook interface to track kafka offsets
 type KafkaOffsetHook struct {
-	offsetTracker  source.OffsetTracker
-	enableDebugLog bool
+	offsetTracker source.OffsetTracker
+	logger        *logging.Logger
 }
 
 // Pre is invoked - before KafaSource pushes message to DMux. This implementation
 // invokes OffsetTracker TrackMe method here, to ensure the Message to track is
 // queued before its execution
 func (h *KafkaOffsetHook) Pre(data source.KafkaMsg) {
-	// log.Println(h.enableDebugLog)
 	// msg := data.(*KafkaMessage)
 	h.offsetTracker.TrackMe(data)
-	if h.enableDebugLog {
-		msg := data.(sink.HTTPMsg)
-		log.Printf("%s after kafka source \n", msg.GetDebugPath())
-	}
+	h.debug(data, "after kafka source")
 }
 
 // PreHTTPCall is invoked - before HttpSink exection.
 func (h *KafkaOffsetHook) PreHTTPCall(msg interface{}) {
-	if h.enableDebugLog {
-		data := msg.(sink.HTTPMsg)
-		log.Printf("%s before http sink \n", data.GetDebugPath())
-	}
+	h.debug(msg, "before http sink")
 }
 
 // PostHTTPCall is invoked - after HttpSink execution. This implementation calls
@@ -167,29 +315,37 @@ func (h *KafkaOffsetHook) PostHTTPCall(msg interface{}, success bool) {
 	if success {
 		data.MarkDone()
 	}
-	if h.enableDebugLog {
-		val := msg.(sink.HTTPMsg)
-		log.Printf("%s after http sink, status = %t \n", val.GetDebugPath(), success)
+	h.debug(msg, "after http sink, status = %t", success)
+}
+
+// debug logs a sample of the messages passing the hook with their topic and
+// partition
+func (h *KafkaOffsetHook) debug(msg interface{}, format string, args ...interface{}) {
+	if !h.logger.DebugEnabled() {
+		return
 	}
+	raw := msg.(source.KafkaMsg).GetRawMsg()
+	path := msg.(sink.HTTPMsg).GetDebugPath()
+	h.logger.WithPartition(raw.Topic, raw.Partition).SampledDebugf(path+" "+format, args...)
 }
 
 // GetKafkaHook is a global function that returns instance of KafkaOffsetHook
-func GetKafkaHook(offsetTracker source.OffsetTracker, enableDebugLog bool) *KafkaOffsetHook {
-	return &KafkaOffsetHook{offsetTracker, enableDebugLog}
+func GetKafkaHook(offsetTracker source.OffsetTracker, logger *logging.Logger) *KafkaOffsetHook {
+	return &KafkaOffsetHook{offsetTracker: offsetTracker, logger: logger}
 }
 
 // **************** HashLogic ***********
 
 // KafkaMsgHasher implements hasher
 // a hash logic implementation of KafkaMessage.
-// This runs consistenHashin on Key of KafkaKeyedMessage
+// This runs consistenHashin on the ordering key of KafkaKeyedMessage
 type KafkaMsgHasher struct{}
 
 // ComputeHash method for KafkaMessage
 func (o *KafkaMsgHasher) ComputeHash(data interface{}) int {
 	val := data.(source.KafkaMsg)
 	h := fnv.New32a()
-	h.Write(val.GetRawMsg().Key)
+	h.Write(source.OrderingKey(val))
 	return int(h.Sum32())
 }
 
@@ -198,13 +354,49 @@ func GetKafkaMsgHasher() core.Hasher {
 	return new(KafkaMsgHasher)
 }
 
+// KafkaMsgPartitioner implements core.Partitioner for the partition
+// distributor
+type KafkaMsgPartitioner struct{}
+
+// GetTopicPartition returns the topic and partition of a KafkaMessage
+func (p *KafkaMsgPartitioner) GetTopicPartition(data interface{}) (string, int32) {
+	msg := data.(source.KafkaMsg).GetRawMsg()
+	return msg.Topic, msg.Partition
+}
+
+// GetKafkaMsgPartitioner is Global function to get instance of KafkaMsgPartitioner
+func GetKafkaMsgPartitioner() core.Partitioner {
+	return new(KafkaMsgPartitioner)
+}
+
 // **************** HTTPSink Interface implementation ***********
 
 // GetPayload implements HTTPMsg for HttpSink processing
 func (k *KafkaMessage) GetPayload() []byte {
+	if k.Payload != nil {
+		return k.Payload
+	}
 	return k.Msg.Value
 }
 
+// GetTransformRecord implements transform.Msg for HttpSink processing
+func (k *KafkaMessage) GetTransformRecord() transform.Record {
+	return transform.Record{
+		Topic:     k.Msg.Topic,
+		Partition: k.Msg.Partition,
+		Offset:    k.Msg.Offset,
+		Key:       k.Msg.Key,
+		Timestamp: k.Msg.Timestamp,
+		Headers:   k.GetRecordHeaders(),
+		Value:     k.Msg.Value,
+	}
+}
+
+// SetPayload implements transform.Msg for HttpSink processing
+func (k *KafkaMessage) SetPayload(payload []byte) {
+	k.Payload = payload
+}
+
 // GetHeaders implements HTTPMsg for HttpSink processing
 func (k *KafkaMessage) GetHeaders(conf sink.HTTPSinkConf) map[string]string {
 	header := make(map[string]string)
@@ -216,6 +408,46 @@ func (k *KafkaMessage) GetHeaders(conf sink.HTTPSinkConf) map[string]string {
 	return header
 }
 
+// http headers describing the kafka record, forwarded when sink.record_headers.metadata is set
+const (
+	TopicHeader     = "X-Kafka-Topic"
+	PartitionHeader = "X-Kafka-Partition"
+	OffsetHeader    = "X-Kafka-Offset"
+	KeyHeader       = "X-Kafka-Key"
+	TimestampHeader = "X-Kafka-Timestamp" // epoch millis, only if the record has one
+)
+
+// GetRecordHeaders implements RecordMsg for HttpSink processing
+func (k *KafkaMessage) GetRecordHeaders() map[string]string {
+	header := make(map[string]string, len(k.Msg.Headers))
+	for _, h := range k.Msg.Headers {
+		header[string(h.Key)] = string(h.Value)
+	}
+	return header
+}
+
+// GetRecordMetadata implements RecordMsg for HttpSink processing
+func (k *KafkaMessage) GetRecordMetadata() map[string]string {
+	header := map[string]string{
+		TopicHeader:     k.Msg.Topic,
+		PartitionHeader: strconv.FormatInt(int64(k.Msg.Partition), 10),
+		OffsetHeader:    strconv.FormatInt(k.Msg.Offset, 10),
+		KeyHeader:       string(k.Msg.Key),
+	}
+	if timestamp := k.timestamp(); timestamp >= 0 {
+		header[TimestampHeader] = strconv.FormatInt(timestamp, 10)
+	}
+	return header
+}
+
+// timestamp of the record in epoch millis, -1 if the record has none
+func (k *KafkaMessage) timestamp() int64 {
+	if k.Msg.Timestamp.IsZero() {
+		return -1
+	}
+	return k.Msg.Timestamp.UnixNano() / int64(time.Millisecond)
+}
+
 // GetURL implements HTTPMsg for HttpSink processing
 func (k *KafkaMessage) GetURL(endpoint string) string {
 	return endpoint + k.GetDebugPath()
@@ -262,12 +494,22 @@ func (k *KafkaMessage) BatchPayload(msgs []interface{}, version int) []byte {
 	partition := int(0)
 	for i := 0; i < len(msgs); i++ {
 		msg := msgs[i].(*KafkaMessage)
-		if version == 1 {
+		switch version {
+		case 1:
 			payload[i] = msg.GetPayload()
-		} else {
+		case 2:
 			partition = int(msg.Msg.Partition)
 			offset := msg.Msg.Offset
 			payload[i] = core.EncodePayload(msg.Msg.Key, offset, msg.GetPayload())
+		case 3:
+			partition = int(msg.Msg.Partition)
+			headers := make([]core.RecordHeader, len(msg.Msg.Headers))
+			for j, h := range msg.Msg.Headers {
+				headers[j] = core.RecordHeader{Key: h.Key, Value: h.Value}
+			}
+			payload[i] = core.EncodePayloadV3(msg.Msg.Key, msg.Msg.Offset, msg.timestamp(), headers, msg.GetPayload())
+		default:
+			panic("unknown batch version " + strconv.Itoa(version))
 		}
 	}
 	if version == 1 {
@@ -0,0 +1,26 @@
+package connection
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/flipkart-incubator/go-dmux/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchPayload(t *testing.T) {
+	msg := &KafkaMessage{Msg: &sarama.ConsumerMessage{
+		Partition: 3,
+		Offset:    7,
+		Key:       []byte("k"),
+		Value:     []byte("v"),
+		Headers:   []*sarama.RecordHeader{{Key: []byte("h"), Value: []byte("x")}},
+	}}
+	msgs := []interface{}{msg}
+
+	assert.Equal(t, core.Encode([][]byte{[]byte("v")}), msg.BatchPayload(msgs, 1))
+	assert.Equal(t, core.EncodeV2(3, [][]byte{core.EncodePayload([]byte("k"), 7, []byte("v"))}), msg.BatchPayload(msgs, 2))
+	headers := []core.RecordHeader{{Key: []byte("h"), Value: []byte("x")}}
+	assert.Equal(t, core.EncodeV2(3, [][]byte{core.EncodePayloadV3([]byte("k"), 7, -1, headers, []byte("v"))}), msg.BatchPayload(msgs, 3))
+	assert.Panics(t, func() { msg.BatchPayload(msgs, 4) })
+}
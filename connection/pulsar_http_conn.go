@@ -2,10 +2,14 @@ package connection
 
 import (
 	"encoding/json"
+	"github.com/flipkart-incubator/go-dmux/alerting"
 	"github.com/flipkart-incubator/go-dmux/core"
+	"github.com/flipkart-incubator/go-dmux/filter"
+	"github.com/flipkart-incubator/go-dmux/health"
 	sink "github.com/flipkart-incubator/go-dmux/http"
+	"github.com/flipkart-incubator/go-dmux/logging"
+	"github.com/flipkart-incubator/go-dmux/plugin"
 	source "github.com/flipkart-incubator/go-dmux/pulsar"
-	"log"
 )
 
 // PulsarConnConfig holds config to connect pulsar source to http sink
@@ -18,8 +22,8 @@ type PulsarConnConfig struct {
 
 // PulsarConn abstracts connection
 type PulsarConn struct {
-	EnableDebugLog bool
-	Conf           interface{}
+	Name string
+	Conf interface{}
 }
 
 // getConfiguration parses configs and returns connection config
@@ -33,21 +37,30 @@ func (c *PulsarConn) getConfiguration() *PulsarConnConfig {
 // Run starts connection from source to sink
 func (c *PulsarConn) Run() {
 	conf := c.getConfiguration()
-	log.Println("starting go-dmux with conf", conf)
+	logger := logging.ForConnection(c.Name)
+	logger.Infof("starting go-dmux with conf %v", conf)
 
 	src := source.GetPulsarSource(conf.Source)
+	src.SetHealth(health.ForConnection(c.Name))
+	src.SetAlerts(alerting.ForConnection(c.Name))
+	src.SetKeyExtractor(core.GetKeyExtractor(conf.Dmux.OrderingKey))
+	src.SetFilter(filter.GetFilter(c.Name, conf.Dmux.Filter))
+	pl := plugin.GetPlugin(c.Name, conf.Dmux.Plugin, conf.Dmux.Size)
+	src.SetPlugin(pl)
 	tracker := source.GetCursorTracker(conf.PendingAcks, src)
-	hook := source.GetPulsarHook(tracker, c.EnableDebugLog)
+	hook := source.GetPulsarHook(tracker, logger)
 
 	snk := sink.GetHTTPSink(conf.Dmux.Size, conf.Sink)
 	snk.RegisterHook(hook)
+	snk.SetConnection(c.Name)
+	snk.SetPlugin(pl)
 	src.RegisterHook(hook)
 
 	h := source.GetMessageHasher()
-	d := core.GetDistribution(conf.Dmux.DistributorType, h)
+	d := core.GetDistribution(conf.Dmux.DistributorType, h, source.GetMessagePartitioner())
 
 	dmux := core.GetDmux(conf.Dmux, d)
-	var optionalParams core.DmuxOptionalParams = core.DmuxOptionalParams{c.EnableDebugLog}
+	var optionalParams core.DmuxOptionalParams = core.DmuxOptionalParams{Connection: c.Name, Logger: logger}
 	dmux.ConnectWithSideline(src, snk, nil, optionalParams)
 	dmux.Join()
 }
@@ -0,0 +1,26 @@
+package connection
+
+import (
+	"log"
+
+	"github.com/flipkart-incubator/go-dmux/core"
+	source "github.com/flipkart-incubator/go-dmux/kafka"
+)
+
+// countReplay returns the stats a replaying connection fills in
+func countReplay(offsetTracker *source.KafkaOffsetTracker) *source.ReplayStats {
+	stats := new(source.ReplayStats)
+	offsetTracker.CountInto(stats)
+	return stats
+}
+
+// awaitReplay blocks till the replay source has pushed its whole range and
+// every message of it is processed, then stops every dmux so Join returns
+func awaitReplay(name string, src *source.KafkaSource, offsetTracker *source.KafkaOffsetTracker, stats *source.ReplayStats, dmuxes ...*core.Dmux) {
+	<-src.Finished()
+	offsetTracker.Close()
+	for _, dmux := range dmuxes {
+		dmux.Stop()
+	}
+	log.Printf("replay of %s finished: %s \n", name, stats)
+}
@@ -1,5 +1,7 @@
 package core
 
+import "hash/fnv"
+
 //Hasher interface that can be implemented to define data interface and compute
 // and return the righ hash int for it
 type Hasher interface {
@@ -8,6 +10,12 @@ type Hasher interface {
 	ComputeHash(data interface{}) int
 }
 
+//Partitioner interface can be implemented to tell the topic and partition a
+//message was read from, to distribute with PartitionDistributor
+type Partitioner interface {
+	GetTopicPartition(data interface{}) (topic string, partition int32)
+}
+
 //GetHashDistribution returns hashDistributor implementation of Distributor
 //interface to provide Consistent Hash based routing in Dmux from Source to Sink.
 //This needs Client to implement Hasher and pass Hasher in this method arg
@@ -24,13 +32,32 @@ const (
 	HashDistributor DistributorType = "Hash"
 	//RoundRobinDistributor will distribute on round robin fashion
 	RoundRobinDistributor DistributorType = "RoundRobin"
+	//ConsistentHashDistributor will distribute based on the jump consistent
+	//hash of the key, a resize moves only the keys of the added or removed workers
+	ConsistentHashDistributor DistributorType = "ConsistentHash"
+	//LeastLoadedDistributor will distribute to the worker with the fewest
+	//queued messages, it does not keep any order
+	LeastLoadedDistributor DistributorType = "LeastLoaded"
+	//PartitionDistributor will distribute every partition of a topic to one
+	//worker, keeping the order per partition
+	PartitionDistributor DistributorType = "Partition"
 )
 
-//GetDistribution returns correct Distributor based on distributorType
-func GetDistribution(distributorType DistributorType, h Hasher) Distributor {
+//GetDistribution returns correct Distributor based on distributorType, p is
+//only needed by PartitionDistributor
+func GetDistribution(distributorType DistributorType, h Hasher, p Partitioner) Distributor {
 	switch distributorType {
 	case RoundRobinDistributor:
 		return GetRoundRobinDistribution()
+	case ConsistentHashDistributor:
+		return GetConsistentHashDistribution(h)
+	case LeastLoadedDistributor:
+		return GetLeastLoadedDistribution()
+	case PartitionDistributor:
+		if p == nil {
+			panic("Partition distributor is not supported by this connection")
+		}
+		return GetPartitionDistribution(p)
 	default:
 		return GetHashDistribution(h)
 	}
@@ -42,10 +69,74 @@ func GetRoundRobinDistribution() Distributor {
 	return &hd
 }
 
+//GetConsistentHashDistribution returns consistentHashDistributor, which like
+//hashDistributor keeps the order per key, but a resize from n to n+k workers
+//moves only about k/(n+k) of the keys instead of almost all of them
+func GetConsistentHashDistribution(h Hasher) Distributor {
+	return &consistentHashDistributor{h}
+}
+
+//GetLeastLoadedDistribution returns leastLoadedDistributor, which picks the
+//worker with the fewest queued messages so a slow worker does not stall the
+//distribution for every other one. Ties are broken round robin
+func GetLeastLoadedDistribution() Distributor {
+	return new(leastLoadedDistributor)
+}
+
+//GetPartitionDistribution returns partitionDistributor, which maps the
+//partitions of a topic to consecutive workers. Like hashDistributor it keeps
+//the order per key, but hot keys do not skew the load beyond their partition
+func GetPartitionDistribution(p Partitioner) Distributor {
+	return &partitionDistributor{p}
+}
+
+//queueWatcher is implemented by distributors which look at the queues of the
+//workers, Dmux passes them the queues whenever the workers are set up
+type queueWatcher interface {
+	watchQueues(ch []chan interface{})
+}
+
+//watchQueues passes ch to d if it is a queueWatcher
+func watchQueues(d Distributor, ch []chan interface{}) {
+	if w, ok := d.(queueWatcher); ok {
+		w.watchQueues(ch)
+	}
+}
+
+//order of a distributor tells how messages are kept in order across resizes
+type order int
+
+const (
+	//unordered distributors don't keep any order
+	unordered order = iota
+	//keyed distributors are a function of message and size, the worker of a
+	//message before a resize is known
+	keyed
+	//unknown distributors are not known to either, every message waits for
+	//the old workers on resize
+	unknown
+)
+
+//orderOf returns the order of d
+func orderOf(d Distributor) order {
+	switch d.(type) {
+	case *roundRobinDistributor, *leastLoadedDistributor:
+		return unordered
+	case *hashDistributor, *consistentHashDistributor, *partitionDistributor:
+		return keyed
+	default:
+		return unknown
+	}
+}
+
 type hashDistributor struct {
 	hasher Hasher
 }
 
+type consistentHashDistributor struct {
+	hasher Hasher
+}
+
 type roundRobinDistributor struct {
 	count int
 }
@@ -64,6 +155,64 @@ func (h *hashDistributor) Distribute(data interface{}, size int) int {
 	return bucket
 }
 
+type leastLoadedDistributor struct {
+	queues []chan interface{}
+	next   int
+}
+
+func (l *leastLoadedDistributor) watchQueues(ch []chan interface{}) {
+	l.queues = ch
+}
+
+//Distribute returns the first of the least loaded workers starting after the
+//last one picked, round robin if the queues are not known
+func (l *leastLoadedDistributor) Distribute(data interface{}, size int) int {
+	if len(l.queues) != size {
+		picked := l.next % size
+		l.next = picked + 1
+		return picked
+	}
+	picked := -1
+	for i := 0; i < size; i++ {
+		j := (l.next + i) % size
+		if picked < 0 || len(l.queues[j]) < len(l.queues[picked]) {
+			picked = j
+		}
+	}
+	l.next = picked + 1
+	return picked
+}
+
+type partitionDistributor struct {
+	partitioner Partitioner
+}
+
+//Distribute offsets the partition by the hash of the topic, so the
+//partitions of different topics do not all start at the first worker
+func (p *partitionDistributor) Distribute(data interface{}, size int) int {
+	topic, partition := p.partitioner.GetTopicPartition(data)
+	h := fnv.New32a()
+	h.Write([]byte(topic))
+	return int((uint64(h.Sum32()) + uint64(uint32(partition))) % uint64(size))
+}
+
+func (c *consistentHashDistributor) Distribute(data interface{}, size int) int {
+	return jumpHash(uint64(c.hasher.ComputeHash(data)), size)
+}
+
+//jumpHash is the jump consistent hash of Lamping and Veach
+//https://arxiv.org/abs/1406.2294, it maps key to one of buckets with no state
+//and keeps a key in its bucket as buckets grow unless it moves to a new one
+func jumpHash(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
+
 func abs(hash int) int {
 	if hash < 0 {
 		return -hash
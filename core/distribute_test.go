@@ -2,6 +2,8 @@ package core
 
 import (
 	"hash/fnv"
+	"log"
+	"strconv"
 	"testing"
 )
 
@@ -62,3 +64,165 @@ func TestMsgDistribution(t *testing.T) {
 		}
 	}
 }
+
+func TestConsistentHashDistribution(t *testing.T) {
+	log.Println("running test TestConsistentHashDistribution")
+	const keys = 100000
+	size := 10
+	counts := make([]int, size)
+	placed := make([]int, keys)
+	d := GetDistribution(ConsistentHashDistributor, StrData(""), nil)
+	for i := 0; i < keys; i++ {
+		key := StrData(strconv.Itoa(i))
+		placed[i] = d.Distribute(key, size)
+		if placed[i] != d.Distribute(key, size) {
+			t.Fatalf("key %s distributed to %d and %d", key, placed[i], d.Distribute(key, size))
+		}
+		counts[placed[i]]++
+	}
+	//every worker gets its share of keys within 5%
+	for i, count := range counts {
+		if share := float64(count) / (keys / float64(size)); share < 0.95 || share > 1.05 {
+			t.Errorf("worker %d got %.3f of its share of keys", i, share)
+		}
+	}
+
+	//growing to 12 workers moves about 2/12 of the keys, all to the new workers
+	resized := 12
+	moved := 0
+	for i := 0; i < keys; i++ {
+		if bucket := d.Distribute(StrData(strconv.Itoa(i)), resized); bucket != placed[i] {
+			moved++
+			if bucket < size {
+				t.Fatalf("key %d moved from worker %d to existing worker %d", i, placed[i], bucket)
+			}
+		}
+	}
+	if ratio := float64(moved) / keys; ratio < 0.15 || ratio > 0.18 {
+		t.Errorf("expected about %.3f of keys to move, %.3f moved", 2.0/12, ratio)
+	}
+
+	//the modulo hash moves most of them
+	h := GetHashDistribution(StrData(""))
+	moved = 0
+	for i := 0; i < keys; i++ {
+		key := StrData(strconv.Itoa(i))
+		if h.Distribute(key, size) != h.Distribute(key, resized) {
+			moved++
+		}
+	}
+	if ratio := float64(moved) / keys; ratio < 0.5 {
+		t.Errorf("expected most keys to move with the modulo hash, %.3f moved", ratio)
+	}
+}
+
+func TestJumpHash(t *testing.T) {
+	//growing by one bucket a key either stays or moves to the new bucket
+	for _, key := range []uint64{0, 1, 42, 0xdeadbeef, 1<<64 - 1} {
+		bucket := jumpHash(key, 1)
+		if bucket != 0 {
+			t.Errorf("jumpHash(%d, 1) expected 0 got %d", key, bucket)
+		}
+		for buckets := 2; buckets <= 100; buckets++ {
+			next := jumpHash(key, buckets)
+			if next != bucket && next != buckets-1 {
+				t.Errorf("jumpHash(%d, %d) moved from %d to %d", key, buckets, bucket, next)
+			}
+			bucket = next
+		}
+	}
+}
+
+func TestLeastLoadedDistribution(t *testing.T) {
+	log.Println("running test TestLeastLoadedDistribution")
+	d := GetDistribution(LeastLoadedDistributor, nil, nil)
+
+	//round robin till the queues are known
+	for i := 0; i < 6; i++ {
+		if actual := d.Distribute(nil, 3); actual != i%3 {
+			t.Errorf("expected %d got %d", i%3, actual)
+		}
+	}
+
+	ch := make([]chan interface{}, 3)
+	for i := range ch {
+		ch[i] = make(chan interface{}, 10)
+	}
+	watchQueues(d, ch)
+	fill := func(i, n int) {
+		for ; n > 0; n-- {
+			ch[i] <- nil
+		}
+	}
+	fill(0, 3)
+	fill(1, 1)
+	fill(2, 2)
+	if actual := d.Distribute(nil, 3); actual != 1 {
+		t.Errorf("expected the emptiest worker 1 got %d", actual)
+	}
+	//ties go round robin
+	fill(1, 1)
+	expected := []int{2, 1, 2, 0}
+	for _, e := range expected {
+		actual := d.Distribute(nil, 3)
+		if actual != e {
+			t.Errorf("expected %d got %d", e, actual)
+		}
+		fill(actual, 1)
+	}
+}
+
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+func (topicPartition) GetTopicPartition(data interface{}) (string, int32) {
+	tp := data.(topicPartition)
+	return tp.topic, tp.partition
+}
+
+func TestPartitionDistribution(t *testing.T) {
+	log.Println("running test TestPartitionDistribution")
+	d := GetDistribution(PartitionDistributor, nil, topicPartition{})
+	size := 4
+	for _, topic := range []string{"orders", "payments"} {
+		//consecutive partitions of a topic go to consecutive workers
+		first := d.Distribute(topicPartition{topic, 0}, size)
+		for p := int32(1); p < 8; p++ {
+			expected := (first + int(p)) % size
+			if actual := d.Distribute(topicPartition{topic, p}, size); actual != expected {
+				t.Errorf("%s/%d expected %d got %d", topic, p, expected, actual)
+			}
+		}
+	}
+	if d.Distribute(topicPartition{"orders", 0}, size) == d.Distribute(topicPartition{"payments", 0}, size) {
+		t.Errorf("expected the topics to start at different workers")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected a panic without Partitioner")
+		}
+	}()
+	GetDistribution(PartitionDistributor, nil, nil)
+}
+
+func BenchmarkHashDistribute(b *testing.B) {
+	benchmarkDistribute(b, GetHashDistribution(StrData("")))
+}
+
+func BenchmarkConsistentHashDistribute(b *testing.B) {
+	benchmarkDistribute(b, GetConsistentHashDistribution(StrData("")))
+}
+
+func benchmarkDistribute(b *testing.B, d Distributor) {
+	keys := make([]StrData, 1024)
+	for i := range keys {
+		keys[i] = StrData(strconv.Itoa(i))
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		d.Distribute(keys[i%len(keys)], 64)
+	}
+}
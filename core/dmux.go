@@ -4,9 +4,15 @@ import (
 	"encoding/json"
 	"errors"
 	"github.com/cenkalti/backoff"
+	"github.com/flipkart-incubator/go-dmux/autoscale"
+	"github.com/flipkart-incubator/go-dmux/filter"
+	"github.com/flipkart-incubator/go-dmux/logging"
+	"github.com/flipkart-incubator/go-dmux/metrics"
+	"github.com/flipkart-incubator/go-dmux/plugin"
 	sideline_module "github.com/flipkart-incubator/go-dmux/sideline"
 	"log"
 	"math"
+	"strconv"
 	"sync"
 	"time"
 )
@@ -36,6 +42,13 @@ type DmuxConf struct {
 	BatchSize       int             `json:"batch_size"`
 	Version         int             `json:"version"`
 	Sideline        Sideline        `json:"sideline"`
+
+	OrderingKey OrderingKeyConf `json:"ordering_key"` // key messages are distributed and sidelined by, defaults to the key of the record
+	Parking     ParkingConf     `json:"parking"`      // park failing keys instead of blocking their worker, only without sideline and batching
+	Lanes       bool            `json:"lanes"`        // consume every key in flight in its own lane on size workers instead of size queues
+	Autoscale   autoscale.Conf  `json:"autoscale"`    // resize the workers by lag and sink latency and errors
+	Filter      filter.Conf     `json:"filter"`       // drop messages by rules before they are distributed
+	Plugin      plugin.Conf     `json:"plugin"`       // filter, key and transform messages with a WebAssembly module
 }
 
 // Sideline holds config parameters for sideline
@@ -49,7 +62,15 @@ type Sideline struct {
 }
 
 type DmuxOptionalParams struct {
-	EnableDebugLog bool
+	Connection string          // name of the connection the metrics of Dmux are labeled with
+	Logger     *logging.Logger // logger of the connection, defaults to logging.ForConnection(Connection)
+}
+
+// connection is what the workers of a Dmux know about the connection they
+// run in
+type connection struct {
+	name   string
+	logger *logging.Logger
 }
 
 // ControlMsg is the struct passed to Dmux control Channel to enable it
@@ -87,6 +108,13 @@ type Sink interface {
 	BatchConsume(msg []interface{}, version int)
 }
 
+// SidelineMarker is implemented by messages that want to know when they were
+// sidelined, so the Source can treat them as handled though the Sink never
+// consumed them
+type SidelineMarker interface {
+	MarkSidelined()
+}
+
 // Source is interface that implements input Source to the Dmux
 type Source interface {
 	//Generate method takes output channel to which it writes data. The
@@ -106,7 +134,8 @@ type Source interface {
 }
 
 // Distributor interface abstracts the Logic to distribute the load from Source
-// to Sink. Client can choose to use HashDistributor or RoundRobinDistributor or
+// to Sink. Client can choose to use HashDistributor, ConsistentHashDistributor,
+// RoundRobinDistributor, LeastLoadedDistributor or PartitionDistributor or
 // write their own distribution Logic
 type Distributor interface {
 	//Distribute method take incoming data interface and number of outbound channels
@@ -127,6 +156,9 @@ type Dmux struct {
 	distribute             Distributor
 	version                int
 	sideline               Sideline
+	parking                *parking // nil unless parking is enabled
+	lanes                  bool
+	autoscale              autoscale.Conf
 }
 
 const defaultSourceQSize int = 1
@@ -134,6 +166,9 @@ const defaultSinkQSize int = 100
 const defaultBatchSize int = 1
 const defaultVersion int = 1
 
+// maxVersion is the latest batch encoding, see EncodePayloadV3
+const maxVersion int = 3
+
 // GetDmux is public method used to Get instance of a Dmux struct
 func GetDmux(conf DmuxConf, d Distributor) *Dmux {
 	control := make(chan ControlMsg)
@@ -156,12 +191,21 @@ func GetDmux(conf DmuxConf, d Distributor) *Dmux {
 		batchSize = conf.BatchSize
 	}
 
+	if conf.Version < 0 || conf.Version > maxVersion {
+		log.Fatal("invalid dmux.version " + strconv.Itoa(conf.Version))
+	}
 	if conf.Version > 0 {
 		version = conf.Version
 	}
 
+	var park *parking
+	if conf.Parking.Enabled {
+		p := getParking(conf.Parking)
+		park = &p
+	}
+
 	output := &Dmux{conf.Size, batchSize, sourceQSize, sinkQSize,
-		control, response, err, d, version, conf.Sideline}
+		control, response, err, d, version, conf.Sideline, park, conf.Lanes, conf.Autoscale}
 	return output
 }
 
@@ -226,32 +270,51 @@ func getStopMsg() ControlMsg {
 
 func (d *Dmux) runWithSideline(source Source, sink Sink, sidelineImpl sideline_module.CheckMessageSideline, optionalParams DmuxOptionalParams) {
 
-	ch, wg := setupWithSideline(d.size, d.sinkQSize, d.batchSize, sink, source, d.version, d.sideline, sidelineImpl)
+	conn := connection{name: optionalParams.Connection, logger: optionalParams.Logger}
+	if conn.logger == nil {
+		conn.logger = logging.ForConnection(conn.name)
+	}
+	w := setupWithSideline(d.size, d.sinkQSize, d.batchSize, sink, source, d.version, d.sideline, sidelineImpl, d.parking, d.lanes, conn)
+	r := newRouter(d.distribute, w, d.sinkQSize, conn)
 	in := make(chan interface{}, d.sourceQSize)
 	//start source
 	//TODO handle panic recovery if in channel is closed for shutdown
 	go source.Generate(in)
 
+	ticker := time.NewTicker(metricsInterval)
+	defer ticker.Stop()
+
+	//resize by the decisions of the controller, if autoscale is enabled
+	var decide <-chan time.Time
+	controller := autoscale.GetController(conn.name, d.autoscale, d.size)
+	if controller != nil {
+		decider := time.NewTicker(controller.Interval())
+		defer decider.Stop()
+		decide = decider.C
+	}
+
 	for {
 		select {
 		case data := <-in:
-			i := d.distribute.Distribute(data, len(ch))
-			// log.Printf("writing to channel %d len %d", i, len(ch[i]))
-			if optionalParams.EnableDebugLog {
-				log.Printf("writing to channel %d len %d \n", i, len(ch[i]))
+			r.route(data)
+		case i := <-r.passed():
+			r.pass(i)
+		case <-ticker.C:
+			r.m.flush(r.ch)
+		case at := <-decide:
+			if size := controller.Decide(len(r.ch), at); size != len(r.ch) {
+				r.resize(size)
 			}
-			ch[i] <- data
 		case ctrl := <-d.control:
 			if ctrl.signal == Resize {
-				log.Println("processing resize")
-				shutdown(ch, wg)
+				conn.logger.Info("processing resize")
 				resizeMeta := ctrl.meta.(ResizeMeta)
-				ch, wg = setupWithSideline(resizeMeta.newSize, d.sinkQSize, d.batchSize, sink, source, d.version, d.sideline, sidelineImpl)
+				r.resize(resizeMeta.newSize)
 				d.response <- ResponseMsg{ctrl.signal, Sucess}
 			} else if ctrl.signal == Stop {
-				log.Println("processing stop")
+				conn.logger.Info("processing stop")
 				source.Stop()
-				shutdown(ch, wg)
+				r.stop()
 				close(in)
 				d.response <- ResponseMsg{ctrl.signal, Sucess}
 				d.err <- nil
@@ -261,13 +324,6 @@ func (d *Dmux) runWithSideline(source Source, sink Sink, sidelineImpl sideline_m
 	}
 }
 
-func shutdown(ch []chan interface{}, wg *sync.WaitGroup) {
-	for _, c := range ch {
-		close(c)
-	}
-	wg.Wait()
-}
-
 /*
 	func setup(size, qsize, batchSize int, sink Sink, version int) ([]chan interface{}, *sync.WaitGroup) {
 		if version == 1 && batchSize == 1 {
@@ -277,21 +333,39 @@ func shutdown(ch []chan interface{}, wg *sync.WaitGroup) {
 		}
 	}
 */
-func setupWithSideline(size, qsize, batchSize int, sink Sink, source Source, version int, sideline Sideline, sidelineImpl sideline_module.CheckMessageSideline) ([]chan interface{}, *sync.WaitGroup) {
+func setupWithSideline(size, qsize, batchSize int, sink Sink, source Source, version int, sideline Sideline, sidelineImpl sideline_module.CheckMessageSideline, park *parking, lanes bool, conn connection) workers {
+	if park != nil && (sidelineImpl != nil || version != 1 || batchSize != 1) {
+		log.Fatal("Not Supported parking with sideline or batching")
+		return nil
+	}
+	if lanes && (park != nil || sidelineImpl != nil || version != 1 || batchSize != 1) {
+		log.Fatal("Not Supported lanes with parking, sideline or batching")
+		return nil
+	}
 	if version == 1 && batchSize == 1 {
+		if lanes {
+			conn.logger.Debug("Calling laneSetup")
+			return laneSetup(size, qsize, sink, source)
+		}
+		if park != nil {
+			conn.logger.Debug("Calling parkingSetup")
+			return parkingSetup(size, qsize, sink, source, *park, conn)
+		}
 		if sidelineImpl != nil {
-			log.Printf("Calling simpleSetupWithSideline \n")
-			return simpleSetupWithSideline(size, qsize, sink, source, sideline, sidelineImpl)
+			conn.logger.Debug("Calling simpleSetupWithSideline")
+			return simpleSetupWithSideline(size, qsize, sink, source, sideline, sidelineImpl, conn)
 		} else {
-			log.Printf("Calling simpleSetup \n")
+			conn.logger.Debug("Calling simpleSetup")
 			return simpleSetup(size, qsize, sink)
 		}
 	} else {
 		if sidelineImpl == nil {
-			return batchSetup(size, qsize, batchSize, sink, version)
+			return newBatchWorkers(size, sink, func(size int, sink Sink) ([]chan interface{}, *sync.WaitGroup) {
+				return batchSetup(size, qsize, batchSize, sink, version, conn)
+			})
 		}
 		log.Fatal("Not Supported sidelining for batching")
-		return nil, nil
+		return nil
 	}
 }
 
@@ -307,7 +381,7 @@ func setupWithSideline(size, qsize, batchSize int, sink Sink, source Source, ver
 // BatchConsumer will update its batch array index from one entry each of respective channel index. (This provides
 // ability for consumer to consume in parallel) and then flush the batch.
 // Close of any channel in a BatchConsumer will stop the BatchConsumer.
-func batchSetup(sz, qsz, batchsz int, sink Sink, version int) ([]chan interface{}, *sync.WaitGroup) {
+func batchSetup(sz, qsz, batchsz int, sink Sink, version int, conn connection) ([]chan interface{}, *sync.WaitGroup) {
 	size := sz * batchsz // create double nuber of channels
 
 	wg := new(sync.WaitGroup)
@@ -350,6 +424,7 @@ func batchSetup(sz, qsz, batchsz int, sink Sink, version int) ([]chan interface{
 				}
 				// log.Println("flusing ", batch)
 				//flush batched message
+				ingestMetric(metrics.BatchSize, conn.name, int64(len(batch)))
 				sk.BatchConsume(batch, version)
 			}
 
@@ -358,30 +433,30 @@ func batchSetup(sz, qsz, batchsz int, sink Sink, version int) ([]chan interface{
 	return ch, wg
 }
 
-func simpleSetup(size, qsize int, sink Sink) ([]chan interface{}, *sync.WaitGroup) {
-	wg := new(sync.WaitGroup)
-	wg.Add(size)
-	var responseCodes []int
-	ch := make([]chan interface{}, size)
-	for i := 0; i < size; i++ {
-		ch[i] = make(chan interface{}, qsize)
-		go func(index int) {
-			sk := sink.Clone()
-			for msg := range ch[index] {
-				sk.Consume(msg, math.MaxInt32, responseCodes)
+func simpleSetup(size, qsize int, sink Sink) workers {
+	return newQueueWorkers(size, qsize, func(in chan interface{}) {
+		sk := sink.Clone()
+		var responseCodes []int
+		for msg := range in {
+			if f, ok := msg.(fence); ok {
+				close(f)
+				continue
 			}
-			wg.Done()
-		}(i)
-	}
-	return ch, wg
+			sk.Consume(msg, math.MaxInt32, responseCodes)
+		}
+	})
 }
 
-func sinkConsume(sink Sink, sinkChannel []chan ChannelObject, index int, sideline Sideline, sidelineChannel []chan ChannelObject) {
+func sinkConsume(sink Sink, sinkChannel chan ChannelObject, sideline Sideline, sidelineChannel chan ChannelObject, conn connection) {
 	sk := sink.Clone()
 	expBackOff := backoff.NewExponentialBackOff()
 	//expBackOff.MaxElapsedTime = math.MaxInt32 * time.Minute
-	for channelObject := range sinkChannel[index] {
-		log.Printf("Inside Sink channel \n")
+	for channelObject := range sinkChannel {
+		if _, ok := channelObject.Msg.(fence); ok {
+			sidelineChannel <- channelObject
+			continue
+		}
+		conn.logger.SampledDebugf("Inside Sink channel")
 		retryError := backoff.Retry(func() error {
 			consumeError := sk.Consume(channelObject.Msg, sideline.Retries, sideline.SidelineResponseCodes)
 			if consumeError == nil {
@@ -393,7 +468,7 @@ func sinkConsume(sink Sink, sinkChannel []chan ChannelObject, index int, sidelin
 					Sideline: channelObject.Sideline,
 					Version:  0,
 				}
-				sidelineChannel[index] <- sendToSidelineChannel
+				sidelineChannel <- sendToSidelineChannel
 				return nil
 			}
 			return errors.New("failed in sink consume " + consumeError.Error())
@@ -404,9 +479,13 @@ func sinkConsume(sink Sink, sinkChannel []chan ChannelObject, index int, sidelin
 	}
 }
 
-func mainChannelConsumption(ch []chan interface{}, index int, source Source, sideline Sideline, sidelineImpl sideline_module.CheckMessageSideline,
-	sidelineChannel []chan ChannelObject, sinkChannel []chan ChannelObject, wg *sync.WaitGroup) {
-	for msg := range ch[index] {
+func mainChannelConsumption(in chan interface{}, source Source, sideline Sideline, sidelineImpl sideline_module.CheckMessageSideline,
+	sidelineChannel chan ChannelObject, sinkChannel chan ChannelObject, conn connection) {
+	for msg := range in {
+		if f, ok := msg.(fence); ok {
+			sinkChannel <- ChannelObject{Msg: f}
+			continue
+		}
 		key := source.GetKey(msg)
 		partition := source.GetPartition(msg)
 		value := source.GetValue(msg)
@@ -415,7 +494,7 @@ func mainChannelConsumption(ch []chan interface{}, index int, source Source, sid
 		expBackOff := backoff.NewExponentialBackOff()
 		//expBackOff.MaxElapsedTime = math.MaxInt32 * time.Minute
 		retryError := backoff.Retry(func() error {
-			log.Printf("Checking if the message is already sidelined %d, %d from channel \n", partition, offset)
+			conn.logger.SampledDebugf("Checking if the message is already sidelined %d, %d from channel", partition, offset)
 			checkSidelineMessage := sideline_module.SidelineMessage{
 				GroupId:           string(key),
 				Partition:         partition,
@@ -428,38 +507,40 @@ func mainChannelConsumption(ch []chan interface{}, index int, source Source, sid
 			}
 			checkSidelineMessageBytes, checkSidelineMessageErr := json.Marshal(checkSidelineMessage)
 			if checkSidelineMessageErr != nil {
-				log.Printf("error in serde of checkSidelineMessage " + checkSidelineMessageErr.Error() + "\n")
+				conn.logger.Errorf("error in serde of checkSidelineMessage %s", checkSidelineMessageErr.Error())
 				return errors.New("error in serde of checkSidelineMessage " + checkSidelineMessageErr.Error())
 			}
 			checkBytes, checkErr := sidelineImpl.CheckMessageSideline(checkSidelineMessageBytes)
 			err := json.Unmarshal(checkBytes, &check)
 			if err != nil {
-				log.Printf("error in serde of CheckMessageSidelineResponse \n" + err.Error())
+				conn.logger.Errorf("error in serde of CheckMessageSidelineResponse %s", err.Error())
 				return errors.New("error in serde of CheckMessageSidelineResponse " + err.Error())
 			}
 			if checkErr != nil {
-				log.Printf("Error in checking if message is sidelined \n" + checkErr.Error())
+				conn.logger.Errorf("Error in checking if message is sidelined %s", checkErr.Error())
 				return errors.New("Error in checking if message is sidelined " + checkErr.Error())
 			}
-			log.Printf("Message if already sidelined %t %d %d \n", check.MessagePresentInSideline, partition, offset)
+			conn.logger.SampledDebugf("Message if already sidelined %t %d %d", check.MessagePresentInSideline, partition, offset)
 			if check.MessagePresentInSideline {
+				markSidelined(msg)
+				ingestMetric(metrics.AlreadySidelined, conn.name, 1)
 				return nil
 			}
-			log.Printf("SidelineMessage %t %d %d \n", check.SidelineMessage, partition, offset)
+			conn.logger.SampledDebugf("SidelineMessage %t %d %d", check.SidelineMessage, partition, offset)
 			if check.SidelineMessage {
 				sendToSidelineChannel := ChannelObject{
 					Msg:      msg,
 					Sideline: sideline,
 					Version:  check.Version,
 				}
-				sidelineChannel[index] <- sendToSidelineChannel
+				sidelineChannel <- sendToSidelineChannel
 				return nil
 			} else {
 				sendToSinkChannel := ChannelObject{
 					Msg:      msg,
 					Sideline: sideline,
 				}
-				sinkChannel[index] <- sendToSinkChannel
+				sinkChannel <- sendToSinkChannel
 				return nil
 			}
 		}, expBackOff)
@@ -467,11 +548,14 @@ func mainChannelConsumption(ch []chan interface{}, index int, source Source, sid
 			log.Fatal("Ideally this should not happen in mainChannelConsumption" + retryError.Error())
 		}
 	}
-	wg.Done()
 }
 
-func pushToSideline(sidelineChannel []chan ChannelObject, index int, source Source, sideline Sideline, sidelineMetaByteArray []byte, sidelineImpl sideline_module.CheckMessageSideline) {
-	for channelObject := range sidelineChannel[index] {
+func pushToSideline(sidelineChannel chan ChannelObject, source Source, sideline Sideline, sidelineMetaByteArray []byte, sidelineImpl sideline_module.CheckMessageSideline, conn connection) {
+	for channelObject := range sidelineChannel {
+		if f, ok := channelObject.Msg.(fence); ok {
+			close(f)
+			continue
+		}
 		expBackOff := backoff.NewExponentialBackOff()
 		//expBackOff.MaxElapsedTime = math.MaxInt32 * time.Minute
 		retryError := backoff.Retry(
@@ -480,7 +564,7 @@ func pushToSideline(sidelineChannel []chan ChannelObject, index int, source Sour
 				key := source.GetKey(channelObject.Msg)
 				partition := source.GetPartition(channelObject.Msg)
 				offset := source.GetOffset(channelObject.Msg)
-				log.Printf("Inside sideline channel for partition %d offset %d \n", partition, offset)
+				conn.logger.SampledDebugf("Inside sideline channel for partition %d offset %d", partition, offset)
 				kafkaSidelineMessage := sideline_module.SidelineMessage{
 					GroupId:           string(key),
 					Partition:         partition,
@@ -496,13 +580,16 @@ func pushToSideline(sidelineChannel []chan ChannelObject, index int, source Sour
 
 				sidelineByteArray, err := json.Marshal(kafkaSidelineMessage)
 				if err != nil {
-					log.Printf("error in serde of kafkaSidelineMessage " + err.Error() + "\n")
+					conn.logger.Errorf("error in serde of kafkaSidelineMessage %s", err.Error())
 					return errors.New("error in serde of kafkaSidelineMessage " + err.Error())
 				}
 				sidelineMessageResponse := sidelineImpl.SidelineMessage(sidelineByteArray)
-				if !sidelineMessageResponse.Success {
+				if sidelineMessageResponse.Success {
+					markSidelined(channelObject.Msg)
+					ingestMetric(metrics.Sidelined, conn.name, 1)
+				} else {
 					var check sideline_module.CheckMessageSidelineResponse
-					log.Printf(sidelineMessageResponse.ErrorMessage + " \n")
+					conn.logger.Warn(sidelineMessageResponse.ErrorMessage)
 					if sidelineMessageResponse.ConcurrentModificationError != nil {
 						checkSidelineMessage := sideline_module.SidelineMessage{
 							GroupId:           string(key),
@@ -516,19 +603,19 @@ func pushToSideline(sidelineChannel []chan ChannelObject, index int, source Sour
 						}
 						checkSidelineMessageBytes, checkSidelineMessageErr := json.Marshal(checkSidelineMessage)
 						if checkSidelineMessageErr != nil {
-							log.Printf("error in serde of checkSidelineMessage \n")
+							conn.logger.Error("error in serde of checkSidelineMessage")
 							return errors.New("error in serde of checkSidelineMessage \n")
 						}
 						checkBytes, checkErr := sidelineImpl.(sideline_module.CheckMessageSideline).
 							CheckMessageSideline(checkSidelineMessageBytes)
 						err := json.Unmarshal(checkBytes, &check)
 						if err != nil {
-							log.Printf("error in serde of CheckMessageSidelineResponse \n")
+							conn.logger.Error("error in serde of CheckMessageSidelineResponse")
 							return errors.New("error in serde of CheckMessageSidelineResponse \n")
 
 						}
 						if checkErr != nil {
-							log.Printf("Error in checking if message is sidelined " + checkErr.Error() + "\n")
+							conn.logger.Errorf("Error in checking if message is sidelined %s", checkErr.Error())
 							return errors.New("Error in checking if message is sidelined " + checkErr.Error() + "\n")
 						}
 						channelObject.Version = check.Version
@@ -544,30 +631,34 @@ func pushToSideline(sidelineChannel []chan ChannelObject, index int, source Sour
 	}
 }
 
-func simpleSetupWithSideline(size, qsize int, sink Sink, source Source, sideline Sideline, sidelineImpl sideline_module.CheckMessageSideline) ([]chan interface{}, *sync.WaitGroup) {
-	wg := new(sync.WaitGroup)
-	wg.Add(size)
-	ch := make([]chan interface{}, size)
-	sidelineChannel := make([]chan ChannelObject, size)
-	sinkChannel := make([]chan ChannelObject, size)
-	log.Printf("Inside simpleSetupWithSideline \n")
-	for i := 0; i < size; i++ {
-		sinkChannel[i] = make(chan ChannelObject, qsize)
-		go sinkConsume(sink, sinkChannel, i, sideline, sidelineChannel)
-	}
-
-	for i := 0; i < size; i++ {
-		sidelineChannel[i] = make(chan ChannelObject, qsize)
-		sidelineMetaByteArray, sidelineMetaByteArrayErr := json.Marshal(sideline.SidelineMeta)
-		if sidelineMetaByteArrayErr != nil {
-			log.Fatal("error in serde of SidelineMeta")
-		}
-		go pushToSideline(sidelineChannel, i, source, sideline, sidelineMetaByteArray, sidelineImpl)
+// markSidelined lets msg know it was sidelined, if it cares
+func markSidelined(msg interface{}) {
+	if m, ok := msg.(SidelineMarker); ok {
+		m.MarkSidelined()
 	}
+}
 
-	for i := 0; i < size; i++ {
-		ch[i] = make(chan interface{}, qsize)
-		go mainChannelConsumption(ch, i, source, sideline, sidelineImpl, sidelineChannel, sinkChannel, wg)
+// simpleSetupWithSideline runs a pipeline per worker: the main go routine
+// checks if a message is already sidelined and passes it to the sink or the
+// sideline go routine, the sink go routine passes messages to sideline once
+// they fail. Each go routine returns once the one before it returned
+func simpleSetupWithSideline(size, qsize int, sink Sink, source Source, sideline Sideline, sidelineImpl sideline_module.CheckMessageSideline, conn connection) workers {
+	conn.logger.Debug("Inside simpleSetupWithSideline")
+	sidelineMetaByteArray, sidelineMetaByteArrayErr := json.Marshal(sideline.SidelineMeta)
+	if sidelineMetaByteArrayErr != nil {
+		log.Fatal("error in serde of SidelineMeta")
 	}
-	return ch, wg
+	return newQueueWorkers(size, qsize, func(in chan interface{}) {
+		sinkChannel := make(chan ChannelObject, qsize)
+		sidelineChannel := make(chan ChannelObject, qsize)
+		go func() {
+			mainChannelConsumption(in, source, sideline, sidelineImpl, sidelineChannel, sinkChannel, conn)
+			close(sinkChannel)
+		}()
+		go func() {
+			sinkConsume(sink, sinkChannel, sideline, sidelineChannel, conn)
+			close(sidelineChannel)
+		}()
+		pushToSideline(sidelineChannel, source, sideline, sidelineMetaByteArray, sidelineImpl, conn)
+	})
 }
@@ -0,0 +1,59 @@
+package core
+
+import (
+	"time"
+
+	"github.com/flipkart-incubator/go-dmux/metrics"
+)
+
+const metricsInterval = 1 * time.Second
+
+// dmuxMetrics publishes the distribution metrics of a running Dmux. The
+// distribution loop only counts locally, counts and queue depths are flushed to
+// the registry every metricsInterval so the hot path never touches the registry
+type dmuxMetrics struct {
+	connection  string
+	distributed []int64 // messages distributed per worker since the last flush
+	exported    int     // workers whose queue depth was exported by the last flush
+}
+
+func newDmuxMetrics(connection string, workers int) *dmuxMetrics {
+	return &dmuxMetrics{
+		connection:  connection,
+		distributed: make([]int64, workers),
+	}
+}
+
+func (m *dmuxMetrics) distribute(worker int) {
+	m.distributed[worker]++
+}
+
+// flush exports the pending counts and the queue depth of every worker. Queue
+// depths of workers removed by a resize are reset to 0
+func (m *dmuxMetrics) flush(ch []chan interface{}) {
+	for i, c := range ch {
+		labels := metrics.Labels{Connection: m.connection, Worker: i}
+		if m.distributed[i] > 0 {
+			metrics.Ingest(metrics.Metric{Type: metrics.Distributed, Value: m.distributed[i], Labels: labels})
+			m.distributed[i] = 0
+		}
+		metrics.Ingest(metrics.Metric{Type: metrics.QueueDepth, Value: int64(len(c)), Labels: labels})
+	}
+	for i := len(ch); i < m.exported; i++ {
+		labels := metrics.Labels{Connection: m.connection, Worker: i}
+		metrics.Ingest(metrics.Metric{Type: metrics.QueueDepth, Value: 0, Labels: labels})
+	}
+	m.exported = len(ch)
+}
+
+// resize flushes what was counted for the old workers and starts counting for
+// the new ones
+func (m *dmuxMetrics) resize(old []chan interface{}, workers int) {
+	m.flush(old)
+	m.distributed = make([]int64, workers)
+}
+
+// ingestMetric publishes a metric of connection that has no other label
+func ingestMetric(metricType metrics.MetricType, connection string, value int64) {
+	metrics.Ingest(metrics.Metric{Type: metricType, Value: value, Labels: metrics.Labels{Connection: connection}})
+}
@@ -2,6 +2,7 @@ package core
 
 import (
 	"hash/fnv"
+	"log"
 )
 
 // MockSource and MockSink used for testing
@@ -85,14 +86,15 @@ func (m *MockSink) Clone() Sink {
 	return sink
 }
 
-func (m *MockSink) Consume(msg interface{}) {
+func (m *MockSink) Consume(msg interface{}, retries int, sidelineResponseCodes []int) error {
 	data := msg.(MockData)
 	m.buffer[data.key] = data
+	return nil
 }
 
 func (m *MockSink) BatchConsume(msgs []interface{}, version int) {
 	for _, msg := range msgs {
-		m.Consume(msg)
+		m.Consume(msg, 0, nil)
 	}
 }
 
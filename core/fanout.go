@@ -0,0 +1,195 @@
+package core
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/flipkart-incubator/go-dmux/autoscale"
+	"github.com/flipkart-incubator/go-dmux/metrics"
+)
+
+// FanOutMsg is implemented by messages a FanOut can pass to several sinks
+type FanOutMsg interface {
+	// Copy returns the message a branch gets, each sink works on a copy of its
+	// own. The copy calls delivered once its sink processed or sidelined it
+	Copy(delivered func()) interface{}
+	// MarkDone is called once every required branch delivered the message
+	MarkDone()
+}
+
+// FanOut reads a Source once and passes a copy of every message to each of
+// its branches. A Branch is the Source of a Dmux of its own, so every sink has
+// its own workers, retries and sideline. A message is marked done once every
+// required branch delivered it. A required branch blocks the FanOut while it
+// is full, an optional branch that is full skips the message
+type FanOut struct {
+	source     Source
+	connection string
+	branches   []*Branch
+
+	ready   sync.WaitGroup // till every branch was generated
+	started sync.Once
+	stopped sync.Once
+	done    chan struct{} // closed once the source is stopped
+}
+
+// Branch of a FanOut, the Source of the Dmux of one sink
+type Branch struct {
+	f        *FanOut
+	name     string
+	required bool
+	out      chan<- interface{}
+
+	pending   int64 // copies handed to the branch and not delivered yet
+	delivered int64 // copies delivered since the last flush
+	skipped   int64 // messages skipped since the last flush
+}
+
+// GetFanOut returns a FanOut reading source for connection, branches are
+// added with Branch before any of them is generated
+func GetFanOut(source Source, connection string) *FanOut {
+	return &FanOut{source: source, connection: connection, done: make(chan struct{})}
+}
+
+// Branch adds the branch of the sink named name, its messages are counted as
+// done only if it is required. The autoscale signals of the branch get the
+// lag of the connection
+func (f *FanOut) Branch(name string, required bool) *Branch {
+	b := &Branch{f: f, name: name, required: required}
+	f.branches = append(f.branches, b)
+	f.ready.Add(1)
+	autoscale.ForConnection(f.connection).Forward(autoscale.ForConnection(b.Connection()))
+	return b
+}
+
+// Connection returns the name the dmux and sink of b label their metrics and
+// are resized with, <connection>.<sink>
+func (b *Branch) Connection() string {
+	return b.f.connection + "." + b.name
+}
+
+// Generate implements Source, the FanOut starts reading its source once every
+// branch was generated
+func (b *Branch) Generate(out chan<- interface{}) {
+	b.out = out
+	b.f.ready.Done()
+	b.f.started.Do(func() {
+		go b.f.run()
+	})
+}
+
+// Stop implements Source, it stops the source of the FanOut and the FanOut
+func (b *Branch) Stop() {
+	b.f.stopped.Do(func() {
+		b.f.source.Stop()
+		close(b.f.done)
+	})
+}
+
+// GetKey implements Source
+func (b *Branch) GetKey(msg interface{}) []byte {
+	return b.f.source.GetKey(msg)
+}
+
+// GetPartition implements Source
+func (b *Branch) GetPartition(msg interface{}) int32 {
+	return b.f.source.GetPartition(msg)
+}
+
+// GetValue implements Source
+func (b *Branch) GetValue(msg interface{}) []byte {
+	return b.f.source.GetValue(msg)
+}
+
+// GetOffset implements Source
+func (b *Branch) GetOffset(msg interface{}) int64 {
+	return b.f.source.GetOffset(msg)
+}
+
+func (f *FanOut) run() {
+	f.ready.Wait()
+	in := make(chan interface{})
+	go f.source.Generate(in)
+
+	ticker := time.NewTicker(metricsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case msg := <-in:
+			f.pass(msg.(FanOutMsg))
+		case <-ticker.C:
+			f.flush()
+		case <-f.done:
+			return
+		}
+	}
+}
+
+// pass hands a copy of msg to every branch, optional ones first so a full
+// required branch does not hold them back
+func (f *FanOut) pass(msg FanOutMsg) {
+	required := int32(0)
+	for _, b := range f.branches {
+		if b.required {
+			required++
+		}
+	}
+	if required == 0 {
+		msg.MarkDone()
+	}
+	for _, b := range f.branches {
+		if !b.required {
+			atomic.AddInt64(&b.pending, 1)
+			select {
+			case b.out <- msg.Copy(b.deliver(nil)):
+			default:
+				atomic.AddInt64(&b.pending, -1)
+				atomic.AddInt64(&b.skipped, 1)
+			}
+		}
+	}
+	for _, b := range f.branches {
+		if b.required {
+			atomic.AddInt64(&b.pending, 1)
+			select {
+			case b.out <- msg.Copy(b.deliver(func() {
+				if atomic.AddInt32(&required, -1) == 0 {
+					msg.MarkDone()
+				}
+			})):
+			case <-f.done:
+				return
+			}
+		}
+	}
+}
+
+// deliver returns the delivered callback of a copy handed to b, then is
+// called once even if the copy is delivered more than once
+func (b *Branch) deliver(then func()) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			atomic.AddInt64(&b.pending, -1)
+			atomic.AddInt64(&b.delivered, 1)
+			if then != nil {
+				then()
+			}
+		})
+	}
+}
+
+// flush exports the lag, deliveries and skips of every branch
+func (f *FanOut) flush() {
+	for _, b := range f.branches {
+		labels := metrics.Labels{Connection: f.connection, Sink: b.name}
+		metrics.Ingest(metrics.Metric{Type: metrics.FanOutLag, Value: atomic.LoadInt64(&b.pending), Labels: labels})
+		if delivered := atomic.SwapInt64(&b.delivered, 0); delivered > 0 {
+			metrics.Ingest(metrics.Metric{Type: metrics.FanOutDelivered, Value: delivered, Labels: labels})
+		}
+		if skipped := atomic.SwapInt64(&b.skipped, 0); skipped > 0 {
+			metrics.Ingest(metrics.Metric{Type: metrics.FanOutSkipped, Value: skipped, Labels: labels})
+		}
+	}
+}
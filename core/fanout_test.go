@@ -0,0 +1,175 @@
+package core
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fanOutMsg is done once every required sink delivered a copy of it
+type fanOutMsg struct {
+	id   string
+	done int32
+}
+
+func (m *fanOutMsg) Copy(delivered func()) interface{} {
+	return &fanOutCopy{m, delivered}
+}
+
+func (m *fanOutMsg) MarkDone() {
+	atomic.StoreInt32(&m.done, 1)
+}
+
+func (m *fanOutMsg) isDone() bool {
+	return atomic.LoadInt32(&m.done) == 1
+}
+
+type fanOutCopy struct {
+	msg       *fanOutMsg
+	delivered func()
+}
+
+type fanOutSource struct {
+	msgs []*fanOutMsg
+}
+
+func (s *fanOutSource) Generate(out chan<- interface{}) {
+	for _, msg := range s.msgs {
+		out <- msg
+	}
+}
+
+func (s *fanOutSource) Stop()                              {}
+func (s *fanOutSource) GetKey(msg interface{}) []byte      { return []byte(msg.(*fanOutCopy).msg.id) }
+func (s *fanOutSource) GetPartition(msg interface{}) int32 { return 0 }
+func (s *fanOutSource) GetValue(msg interface{}) []byte    { return nil }
+func (s *fanOutSource) GetOffset(msg interface{}) int64    { return 0 }
+
+// fanOutSink delivers copies once its gate is open
+type fanOutSink struct {
+	gate chan struct{}
+
+	l         sync.Mutex
+	delivered []string
+}
+
+func (s *fanOutSink) Clone() Sink { return s }
+
+func (s *fanOutSink) Consume(msg interface{}, retries int, sidelineResponseCodes []int) error {
+	<-s.gate
+	c := msg.(*fanOutCopy)
+	s.l.Lock()
+	s.delivered = append(s.delivered, c.msg.id)
+	s.l.Unlock()
+	c.delivered()
+	return nil
+}
+
+func (s *fanOutSink) BatchConsume(msgs []interface{}, version int) {}
+
+func (s *fanOutSink) count() int {
+	s.l.Lock()
+	defer s.l.Unlock()
+	return len(s.delivered)
+}
+
+func openSink() *fanOutSink {
+	s := &fanOutSink{gate: make(chan struct{})}
+	close(s.gate)
+	return s
+}
+
+type firstWorker struct{}
+
+func (firstWorker) Distribute(data interface{}, size int) int { return 0 }
+
+func fanOutTo(f *FanOut, name string, required bool, sink Sink) {
+	d := GetDmux(DmuxConf{Size: 1, SinkQSize: 1}, firstWorker{})
+	d.ConnectWithSideline(f.Branch(name, required), sink, nil, DmuxOptionalParams{Connection: "orders." + name})
+}
+
+func TestFanOutRequired(t *testing.T) {
+	src := &fanOutSource{}
+	for _, id := range []string{"a", "b", "c"} {
+		src.msgs = append(src.msgs, &fanOutMsg{id: id})
+	}
+	f := GetFanOut(src, "orders")
+	fast, slow := openSink(), &fanOutSink{gate: make(chan struct{})}
+	fanOutTo(f, "fast", true, fast)
+	fanOutTo(f, "slow", true, slow)
+
+	// the slow sink holds back every message
+	assert.Eventually(t, func() bool { return fast.count() == 3 }, time.Second, time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	for _, msg := range src.msgs {
+		assert.False(t, msg.isDone())
+	}
+
+	close(slow.gate)
+	assert.Eventually(t, func() bool {
+		return src.msgs[0].isDone() && src.msgs[1].isDone() && src.msgs[2].isDone()
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, []string{"a", "b", "c"}, fast.delivered)
+	assert.Equal(t, []string{"a", "b", "c"}, slow.delivered)
+	for _, b := range f.branches {
+		assert.Equal(t, int64(0), atomic.LoadInt64(&b.pending))
+	}
+}
+
+func TestFanOutOptional(t *testing.T) {
+	src := &fanOutSource{}
+	for i := 0; i < 20; i++ {
+		src.msgs = append(src.msgs, &fanOutMsg{id: string(rune('a' + i))})
+	}
+	f := GetFanOut(src, "orders")
+	required, optional := openSink(), &fanOutSink{gate: make(chan struct{})}
+	fanOutTo(f, "required", true, required)
+	fanOutTo(f, "optional", false, optional)
+
+	// the optional sink neither holds back messages nor the required sink
+	assert.Eventually(t, func() bool {
+		for _, msg := range src.msgs {
+			if !msg.isDone() {
+				return false
+			}
+		}
+		return true
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, 20, required.count())
+
+	// and skips the messages it was too far behind for
+	close(optional.gate)
+	assert.Eventually(t, func() bool { return atomic.LoadInt64(&f.branches[1].pending) == 0 }, time.Second, time.Millisecond)
+	assert.Less(t, optional.count(), 20)
+}
+
+func TestFanOutWithoutRequired(t *testing.T) {
+	msg := &fanOutMsg{id: "a"}
+	f := GetFanOut(&fanOutSource{msgs: []*fanOutMsg{msg}}, "orders")
+	sink := openSink()
+	fanOutTo(f, "optional", false, sink)
+	assert.Eventually(t, func() bool { return msg.isDone() && sink.count() == 1 }, time.Second, time.Millisecond)
+}
+
+func TestFanOutStop(t *testing.T) {
+	f := GetFanOut(&fanOutSource{msgs: []*fanOutMsg{{id: "a"}}}, "orders")
+	b := f.Branch("required", true)
+	b.out = make(chan interface{}) // never read, the fan-out blocks on it
+	f.ready.Done()
+	exited := make(chan struct{})
+	go func() {
+		f.run()
+		close(exited)
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	b.Stop()
+	select {
+	case <-exited:
+	case <-time.After(time.Second):
+		t.Fatal("fan-out still running after its source stopped")
+	}
+}
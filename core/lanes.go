@@ -0,0 +1,163 @@
+package core
+
+import (
+	"math"
+	"sync"
+)
+
+// lane holds the messages of a key in order, it exists while the key has
+// messages in flight
+type lane struct {
+	key  string
+	msgs []interface{}
+}
+
+// lanePool runs lanes on a number of workers. A lane is handed to one
+// worker at a time, which consumes it till it is empty, so messages of a key
+// are consumed in order while different keys never wait behind each other
+// for anything but a free worker. A resize changes the number of workers
+type lanePool struct {
+	l       sync.Mutex
+	cond    *sync.Cond
+	lanes   map[string]*lane
+	ready   []*lane // lanes waiting for a worker
+	pending int     // messages in all lanes
+	limit   int     // pending messages before add blocks
+	qsize   int     // pending messages per worker
+	closed  bool
+
+	in      chan interface{}
+	sink    Sink
+	wg      sync.WaitGroup
+	running int // workers
+	target  int // workers after a resize, running workers beyond it return
+}
+
+// laneSetup returns workers with a single queue whose messages are consumed
+// in lanes by key on size workers, at most size*qsize messages are held in
+// lanes
+func laneSetup(size, qsize int, sink Sink, source Source) workers {
+	p := &lanePool{
+		lanes: make(map[string]*lane),
+		qsize: qsize,
+		in:    make(chan interface{}, qsize),
+		sink:  sink,
+	}
+	p.cond = sync.NewCond(&p.l)
+	go func() {
+		for msg := range p.in {
+			p.add(string(source.GetKey(msg)), msg)
+		}
+		p.close()
+	}()
+	p.resize(size)
+	return p
+}
+
+func (p *lanePool) queues() []chan interface{} {
+	return []chan interface{}{p.in}
+}
+
+// resize starts workers or lets the ones beyond size return once they are
+// done with their lane, lanes don't move between workers so there is
+// nothing to wait for. The limit of pending messages follows the workers
+func (p *lanePool) resize(size int) []<-chan struct{} {
+	p.l.Lock()
+	defer p.l.Unlock()
+	p.target = size
+	p.limit = size * p.qsize
+	for ; p.running < size; p.running++ {
+		p.wg.Add(1)
+		go func() {
+			p.work(p.sink.Clone())
+			p.wg.Done()
+		}()
+	}
+	p.cond.Broadcast()
+	return nil
+}
+
+func (p *lanePool) stop() {
+	close(p.in)
+	p.wg.Wait()
+}
+
+// add appends msg to the lane of key, creating the lane if key has nothing in
+// flight. It blocks while limit messages are pending
+func (p *lanePool) add(key string, msg interface{}) {
+	p.l.Lock()
+	defer p.l.Unlock()
+	for p.pending >= p.limit {
+		p.cond.Wait()
+	}
+	l, ok := p.lanes[key]
+	if !ok {
+		l = &lane{key: key}
+		p.lanes[key] = l
+		p.ready = append(p.ready, l)
+		p.cond.Broadcast()
+	}
+	l.msgs = append(l.msgs, msg)
+	p.pending++
+}
+
+// close lets the workers return once every lane was consumed
+func (p *lanePool) close() {
+	p.l.Lock()
+	p.closed = true
+	p.cond.Broadcast()
+	p.l.Unlock()
+}
+
+// work consumes ready lanes till the pool is closed and no lane is left
+func (p *lanePool) work(sk Sink) {
+	var responseCodes []int
+	for {
+		l := p.next()
+		if l == nil {
+			return
+		}
+		for msg := p.pop(l, false); msg != nil; msg = p.pop(l, true) {
+			sk.Consume(msg, math.MaxInt32, responseCodes)
+		}
+	}
+}
+
+// next waits for a ready lane, nil once the pool is closed and drained or
+// the worker is beyond the target of a resize
+func (p *lanePool) next() *lane {
+	p.l.Lock()
+	defer p.l.Unlock()
+	for len(p.ready) == 0 || p.running > p.target {
+		if p.running > p.target || p.closed && len(p.ready) == 0 {
+			p.running--
+			return nil
+		}
+		p.cond.Wait()
+	}
+	l := p.ready[0]
+	p.ready[0] = nil
+	p.ready = p.ready[1:]
+	return l
+}
+
+// pop returns the next message of l, releasing the lane if it is empty.
+// consumed is true if the previous message of l was consumed
+func (p *lanePool) pop(l *lane, consumed bool) interface{} {
+	p.l.Lock()
+	defer p.l.Unlock()
+	if consumed {
+		p.pending--
+		if p.pending == p.limit-1 {
+			p.cond.Broadcast() // add may be waiting
+		}
+	}
+	if len(l.msgs) == 0 {
+		delete(p.lanes, l.key)
+		return nil
+	}
+	msg := l.msgs[0]
+	l.msgs[0] = nil
+	l.msgs = l.msgs[1:]
+	return msg
+}
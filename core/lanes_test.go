@@ -0,0 +1,128 @@
+package core
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// laneSink records the order messages of every key were consumed in and the
+// most messages consumed at once
+type laneSink struct {
+	l        sync.Mutex
+	consumed map[string][]string
+	delay    time.Duration
+	running  int32
+	peak     int32
+}
+
+func (s *laneSink) Clone() Sink { return s }
+
+func (s *laneSink) Consume(msg interface{}, retries int, sidelineResponseCodes []int) error {
+	running := atomic.AddInt32(&s.running, 1)
+	for peak := atomic.LoadInt32(&s.peak); running > peak && !atomic.CompareAndSwapInt32(&s.peak, peak, running); {
+		peak = atomic.LoadInt32(&s.peak)
+	}
+	time.Sleep(s.delay)
+	atomic.AddInt32(&s.running, -1)
+	if s.consumed != nil {
+		key := string(parkingSource{}.GetKey(msg))
+		s.l.Lock()
+		s.consumed[key] = append(s.consumed[key], msg.(string))
+		s.l.Unlock()
+	}
+	return nil
+}
+
+func (s *laneSink) BatchConsume(msgs []interface{}, version int) {}
+
+func TestLanes(t *testing.T) {
+	sink := &laneSink{consumed: make(map[string][]string), delay: time.Millisecond}
+	w := laneSetup(4, 2, sink, parkingSource{})
+	ch := w.queues()
+	assert.Len(t, ch, 1)
+
+	expected := make(map[string][]string)
+	for i := 0; i < 50; i++ {
+		for _, key := range []string{"a", "b", "c", "d", "e", "f"} {
+			msg := key + "-" + strconv.Itoa(i)
+			expected[key] = append(expected[key], msg)
+			ch[0] <- msg
+		}
+	}
+	assert.LessOrEqual(t, atomic.LoadInt32(&sink.peak), int32(4))
+	assert.Nil(t, w.resize(6))
+	for i := 50; i < 100; i++ {
+		for _, key := range []string{"a", "b", "c", "d", "e", "f"} {
+			msg := key + "-" + strconv.Itoa(i)
+			expected[key] = append(expected[key], msg)
+			ch[0] <- msg
+		}
+	}
+	w.stop()
+
+	assert.Equal(t, expected, sink.consumed)
+	assert.Equal(t, int32(6), sink.peak)
+}
+
+func TestLanesResizeLimit(t *testing.T) {
+	sink := &laneSink{delay: 50 * time.Millisecond}
+	w := laneSetup(1, 1, sink, parkingSource{})
+	ch := w.queues()
+	assert.Nil(t, w.resize(4))
+
+	// the grown pool holds a message of every key, not just of one
+	for _, key := range []string{"a", "b", "c", "d"} {
+		ch[0] <- key + "-0"
+	}
+	w.stop()
+	assert.Equal(t, int32(4), sink.peak)
+}
+
+// skewedMessages returns n messages with zipf distributed keys, few keys
+// are hot while most are rare
+func skewedMessages(n int) []interface{} {
+	zipf := rand.NewZipf(rand.New(rand.NewSource(1)), 1.1, 1, 10000)
+	msgs := make([]interface{}, n)
+	for i := range msgs {
+		msgs[i] = strconv.FormatUint(zipf.Uint64(), 10) + "-" + strconv.Itoa(i)
+	}
+	return msgs
+}
+
+type laneKeyHasher struct{}
+
+func (laneKeyHasher) ComputeHash(data interface{}) int {
+	h := fnv.New32a()
+	h.Write(parkingSource{}.GetKey(data))
+	return int(h.Sum32())
+}
+
+func BenchmarkSimpleSetupSkewed(b *testing.B) {
+	msgs := skewedMessages(b.N)
+	d := GetHashDistribution(laneKeyHasher{})
+	w := simpleSetup(16, 100, &laneSink{delay: 100 * time.Microsecond})
+	ch := w.queues()
+	b.ResetTimer()
+	for _, msg := range msgs {
+		ch[d.Distribute(msg, len(ch))] <- msg
+	}
+	w.stop()
+}
+
+func BenchmarkLanesSkewed(b *testing.B) {
+	msgs := skewedMessages(b.N)
+	w := laneSetup(16, 100, &laneSink{delay: 100 * time.Microsecond}, parkingSource{})
+	ch := w.queues()
+	b.ResetTimer()
+	for _, msg := range msgs {
+		ch[0] <- msg
+	}
+	w.stop()
+}
@@ -0,0 +1,120 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// OrderingKeyConf selects the ordering key of a message, the key it is
+// distributed, sidelined and substituted in __KEY_NAME__ urls by. At most one
+// of the options can be set, without any the key of the record is used. A
+// message the option finds nothing in falls back to the key of the record
+type OrderingKeyConf struct {
+	JSONPath string `json:"json_path"` // dot separated path of a field of a json value, e.g. order.id or items.0.sku
+	Header   string `json:"header"`    // name of a record header, a pulsar property
+	KeyRegex string `json:"key_regex"` // regex on the key of the record, its first capture group or else the whole match
+}
+
+// KeyExtractor extracts the ordering key of a message as configured by
+// OrderingKeyConf. A nil *KeyExtractor returns the key of the record
+type KeyExtractor struct {
+	path   []string
+	header string
+	regex  *regexp.Regexp
+}
+
+// OrderingKeyMsg is implemented by messages which know their ordering key
+type OrderingKeyMsg interface {
+	GetOrderingKey() []byte
+}
+
+// GetKeyExtractor returns the KeyExtractor of conf, nil if conf sets no
+// option. It panics if conf is invalid
+func GetKeyExtractor(conf OrderingKeyConf) *KeyExtractor {
+	set := 0
+	for _, option := range []string{conf.JSONPath, conf.Header, conf.KeyRegex} {
+		if option != "" {
+			set++
+		}
+	}
+	if set == 0 {
+		return nil
+	}
+	if set > 1 {
+		panic("only one of json_path, header and key_regex can be set in ordering_key")
+	}
+
+	e := &KeyExtractor{header: conf.Header}
+	if conf.JSONPath != "" {
+		e.path = strings.Split(strings.TrimPrefix(conf.JSONPath, "$."), ".")
+	}
+	if conf.KeyRegex != "" {
+		e.regex = regexp.MustCompile(conf.KeyRegex)
+	}
+	return e
+}
+
+// Extract returns the ordering key of a record with key and value, header
+// looks up a header of the record returning nil if it has none
+func (e *KeyExtractor) Extract(key, value []byte, header func(name string) []byte) []byte {
+	if e == nil {
+		return key
+	}
+	var extracted []byte
+	switch {
+	case e.path != nil:
+		extracted = extractJSON(value, e.path)
+	case e.header != "":
+		extracted = header(e.header)
+	case e.regex != nil:
+		if match := e.regex.FindSubmatch(key); len(match) > 1 {
+			extracted = match[1]
+		} else if len(match) == 1 {
+			extracted = match[0]
+		}
+	}
+	if extracted == nil {
+		return key
+	}
+	return extracted
+}
+
+// extractJSON returns the field at path of the json value, strings without
+// quotes and anything else as json. It returns nil if value is not json or
+// has no such field
+func extractJSON(value []byte, path []string) []byte {
+	decoder := json.NewDecoder(bytes.NewReader(value))
+	decoder.UseNumber()
+	var node interface{}
+	if err := decoder.Decode(&node); err != nil {
+		return nil
+	}
+	for _, field := range path {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			node = n[field]
+		case []interface{}:
+			i, err := strconv.Atoi(field)
+			if err != nil || i < 0 || i >= len(n) {
+				return nil
+			}
+			node = n[i]
+		default:
+			return nil
+		}
+	}
+	switch n := node.(type) {
+	case nil:
+		return nil
+	case string:
+		return []byte(n)
+	case json.Number:
+		return []byte(n)
+	default:
+		extracted, _ := json.Marshal(n)
+		return extracted
+	}
+}
@@ -0,0 +1,46 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyExtractor(t *testing.T) {
+	value := []byte(`{"order": {"id": "o-1", "seq": 12345678901234567890, "tags": ["a", "b"], "meta": {"x": 1}}}`)
+	headers := map[string]string{"entity-id": "e-1"}
+	header := func(name string) []byte {
+		if v, ok := headers[name]; ok {
+			return []byte(v)
+		}
+		return nil
+	}
+	key := []byte("tenant-7:order-42")
+
+	assert.Nil(t, GetKeyExtractor(OrderingKeyConf{}))
+	assert.Equal(t, key, GetKeyExtractor(OrderingKeyConf{}).Extract(key, value, header))
+
+	for conf, expected := range map[OrderingKeyConf]string{
+		{JSONPath: "order.id"}:         "o-1",
+		{JSONPath: "$.order.id"}:       "o-1",
+		{JSONPath: "order.seq"}:        "12345678901234567890",
+		{JSONPath: "order.tags.1"}:     "b",
+		{JSONPath: "order.meta"}:       `{"x":1}`,
+		{JSONPath: "order.missing"}:    string(key),
+		{JSONPath: "order.tags.5"}:     string(key),
+		{JSONPath: "order.id.nested"}:  string(key),
+		{Header: "entity-id"}:          "e-1",
+		{Header: "missing"}:            string(key),
+		{KeyRegex: `order-(\d+)`}:      "42",
+		{KeyRegex: `tenant-\d+`}:       "tenant-7",
+		{KeyRegex: `^customer-(\d+)$`}: string(key),
+	} {
+		assert.Equal(t, expected, string(GetKeyExtractor(conf).Extract(key, value, header)), "%+v", conf)
+	}
+
+	// a value which is not json falls back to the key
+	assert.Equal(t, key, GetKeyExtractor(OrderingKeyConf{JSONPath: "order.id"}).Extract(key, []byte("not json"), header))
+
+	assert.Panics(t, func() { GetKeyExtractor(OrderingKeyConf{JSONPath: "order.id", Header: "entity-id"}) })
+	assert.Panics(t, func() { GetKeyExtractor(OrderingKeyConf{KeyRegex: "("}) })
+}
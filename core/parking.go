@@ -0,0 +1,253 @@
+package core
+
+import (
+	"log"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/flipkart-incubator/go-dmux/metrics"
+)
+
+// ParkingConf holds configuration parameters to park failing keys. Parking
+// replaces the infinite retries of a worker without sideline: a message that
+// fails Retries times is parked with the key of its source and retried with
+// backoff, later messages of the key queue behind it while the other keys of
+// the worker keep flowing. Offsets are not committed past a parked message
+type ParkingConf struct {
+	Enabled    bool   `json:"enabled"`
+	Retries    int    `json:"retries"`     // retries of a sink call before its key is parked, defaults to 3
+	Size       int    `json:"size"`        // messages parked per worker before the worker stops reading, defaults to 1000
+	MinBackoff string `json:"min_backoff"` // first retry of a parked key, defaults to 1s
+	MaxBackoff string `json:"max_backoff"` // longest wait between retries of a parked key, defaults to 1m
+}
+
+const (
+	defaultParkingRetries    = 3
+	defaultParkingSize       = 1000
+	defaultParkingMinBackoff = time.Second
+	defaultParkingMaxBackoff = time.Minute
+)
+
+// parking is a ParkingConf with defaults applied
+type parking struct {
+	retries                int
+	size                   int
+	minBackoff, maxBackoff time.Duration
+}
+
+func getParking(conf ParkingConf) parking {
+	p := parking{
+		retries:    defaultParkingRetries,
+		size:       defaultParkingSize,
+		minBackoff: parseParkingDuration("min_backoff", conf.MinBackoff, defaultParkingMinBackoff),
+		maxBackoff: parseParkingDuration("max_backoff", conf.MaxBackoff, defaultParkingMaxBackoff),
+	}
+	if conf.Retries > 0 {
+		p.retries = conf.Retries
+	}
+	if conf.Size > 0 {
+		p.size = conf.Size
+	}
+	return p
+}
+
+func parseParkingDuration(name, value string, fallback time.Duration) time.Duration {
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatal("invalid dmux.parking." + name + " " + err.Error())
+	}
+	return d
+}
+
+// ParkingSink is implemented by sinks whose calls that fail without a
+// response, e.g. timeouts, count toward the retries before a key is parked.
+// Parking consumes with Park if the sink implements it, else with Consume
+type ParkingSink interface {
+	Park(msg interface{}, retries int) error
+}
+
+// parkedKey holds the messages of a key in order, the first one failed
+type parkedKey struct {
+	msgs    []interface{}
+	backoff *backoff.ExponentialBackOff
+	retryAt time.Time
+}
+
+// parkingWorker consumes one queue of a Dmux, parking failing keys
+type parkingWorker struct {
+	sink   Sink
+	source Source
+	conf   parking
+	conn   connection
+	parked map[string]*parkedKey
+	count  int           // messages parked over all keys
+	fences []parkedFence // waiting for keys parked when they were queued
+}
+
+// parkedFence is closed once every key parked when it was queued is unparked
+type parkedFence struct {
+	f    fence
+	keys map[string]bool
+}
+
+func parkingSetup(size, qsize int, sink Sink, source Source, conf parking, conn connection) workers {
+	return newQueueWorkers(size, qsize, func(in chan interface{}) {
+		w := &parkingWorker{
+			sink:   sink.Clone(),
+			source: source,
+			conf:   conf,
+			conn:   conn,
+			parked: make(map[string]*parkedKey),
+		}
+		w.run(in)
+	})
+}
+
+// run consumes in till it is closed and every parked message was consumed.
+// While Size messages are parked it only retries them, blocking the Dmux
+func (w *parkingWorker) run(in chan interface{}) {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		queue := in
+		if w.count >= w.conf.size {
+			queue = nil
+		}
+		if next, ok := w.nextRetry(); ok {
+			resetTimer(timer, time.Until(next))
+		} else if in == nil {
+			return
+		} else {
+			resetTimer(timer, time.Hour)
+		}
+
+		select {
+		case msg, more := <-queue:
+			if !more {
+				in = nil
+				continue
+			}
+			w.consume(msg)
+		case <-timer.C:
+			w.retry(time.Now())
+		}
+	}
+}
+
+// consume hands msg to the sink unless its key is parked, parking the key if
+// the sink fails
+func (w *parkingWorker) consume(msg interface{}) {
+	if f, ok := msg.(fence); ok {
+		w.fence(f)
+		return
+	}
+	key := string(w.source.GetKey(msg))
+	if p, ok := w.parked[key]; ok {
+		p.msgs = append(p.msgs, msg)
+		w.count++
+		return
+	}
+	if w.call(msg) == nil {
+		return
+	}
+	p := &parkedKey{msgs: []interface{}{msg}, backoff: w.newBackoff()}
+	wait := p.backoff.NextBackOff()
+	p.retryAt = time.Now().Add(wait)
+	w.parked[key] = p
+	w.count++
+	ingestMetric(metrics.Parked, w.conn.name, 1)
+	w.conn.logger.Warnf("parked key %s at offset %d of partition %d, retrying in %s",
+		key, w.source.GetOffset(msg), w.source.GetPartition(msg), wait)
+}
+
+// call hands msg to the sink with the retries of parking
+func (w *parkingWorker) call(msg interface{}) error {
+	if sink, ok := w.sink.(ParkingSink); ok {
+		return sink.Park(msg, w.conf.retries)
+	}
+	return w.sink.Consume(msg, w.conf.retries, nil)
+}
+
+// retry consumes the messages of the keys due at now in order, till one
+// fails again
+func (w *parkingWorker) retry(now time.Time) {
+	for key, p := range w.parked {
+		if p.retryAt.After(now) {
+			continue
+		}
+		for len(p.msgs) > 0 && w.call(p.msgs[0]) == nil {
+			p.msgs[0] = nil
+			p.msgs = p.msgs[1:]
+			w.count--
+		}
+		if len(p.msgs) == 0 {
+			delete(w.parked, key)
+			w.unparked(key)
+			w.conn.logger.Infof("unparked key %s", key)
+			continue
+		}
+		p.retryAt = time.Now().Add(p.backoff.NextBackOff())
+	}
+}
+
+// fence closes f once the messages consumed before it are, at once unless
+// a key is parked
+func (w *parkingWorker) fence(f fence) {
+	if len(w.parked) == 0 {
+		close(f)
+		return
+	}
+	keys := make(map[string]bool, len(w.parked))
+	for key := range w.parked {
+		keys[key] = true
+	}
+	w.fences = append(w.fences, parkedFence{f, keys})
+}
+
+// unparked closes the fences that only waited for key
+func (w *parkingWorker) unparked(key string) {
+	waiting := w.fences[:0]
+	for _, pf := range w.fences {
+		delete(pf.keys, key)
+		if len(pf.keys) == 0 {
+			close(pf.f)
+		} else {
+			waiting = append(waiting, pf)
+		}
+	}
+	w.fences = waiting
+}
+
+// nextRetry returns when the next parked key is due, false if none is parked
+func (w *parkingWorker) nextRetry() (time.Time, bool) {
+	var next time.Time
+	for _, p := range w.parked {
+		if next.IsZero() || p.retryAt.Before(next) {
+			next = p.retryAt
+		}
+	}
+	return next, !next.IsZero()
+}
+
+func (w *parkingWorker) newBackoff() *backoff.ExponentialBackOff {
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = w.conf.minBackoff
+	b.MaxInterval = w.conf.maxBackoff
+	b.MaxElapsedTime = 0 // parked keys are retried forever
+	b.Reset()
+	return b
+}
+
+// resetTimer resets a timer that may have fired without being received from
+func resetTimer(t *time.Timer, d time.Duration) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+	t.Reset(d)
+}
@@ -0,0 +1,76 @@
+package core
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/flipkart-incubator/go-dmux/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+// parkingSource reads the key of messages "key-n"
+type parkingSource struct{}
+
+func (s parkingSource) Generate(out chan<- interface{}) {}
+func (s parkingSource) Stop()                           {}
+func (s parkingSource) GetKey(msg interface{}) []byte {
+	return []byte(strings.Split(msg.(string), "-")[0])
+}
+func (s parkingSource) GetPartition(msg interface{}) int32 { return 0 }
+func (s parkingSource) GetValue(msg interface{}) []byte    { return []byte(msg.(string)) }
+func (s parkingSource) GetOffset(msg interface{}) int64    { return 0 }
+
+// failingSink fails the first failures calls of every message
+type failingSink struct {
+	l        sync.Mutex
+	failures map[string]int
+	consumed []string
+}
+
+func (s *failingSink) Clone() Sink { return s }
+
+func (s *failingSink) Consume(msg interface{}, retries int, sidelineResponseCodes []int) error {
+	s.l.Lock()
+	defer s.l.Unlock()
+	if s.failures[msg.(string)] > 0 {
+		s.failures[msg.(string)]--
+		return errors.New(SidelineMessage)
+	}
+	s.consumed = append(s.consumed, msg.(string))
+	return nil
+}
+
+func (s *failingSink) BatchConsume(msgs []interface{}, version int) {}
+
+func TestParking(t *testing.T) {
+	conn := connection{name: "orders", logger: logging.ForConnection("orders")}
+	conf := getParking(ParkingConf{Enabled: true, MinBackoff: "1ms", MaxBackoff: "5ms"})
+
+	// a parked key keeps its order, other keys flow past it
+	sink := &failingSink{failures: map[string]int{"bad-1": 3}}
+	w := parkingSetup(1, 10, sink, parkingSource{}, conf, conn)
+	ch := w.queues()
+	for _, msg := range []string{"bad-1", "good-1", "bad-2", "good-2"} {
+		ch[0] <- msg
+	}
+	w.stop()
+	assert.Equal(t, []string{"good-1", "good-2", "bad-1", "bad-2"}, sink.consumed)
+
+	// a worker with Size messages parked stops reading
+	conf.size = 1
+	sink = &failingSink{failures: map[string]int{"bad-1": 3}}
+	w = parkingSetup(1, 10, sink, parkingSource{}, conf, conn)
+	ch = w.queues()
+	for _, msg := range []string{"bad-1", "good-1"} {
+		ch[0] <- msg
+	}
+	w.stop()
+	assert.Equal(t, []string{"bad-1", "good-1"}, sink.consumed)
+}
+
+func TestGetParking(t *testing.T) {
+	conf := getParking(ParkingConf{Enabled: true})
+	assert.Equal(t, parking{retries: 3, size: 1000, minBackoff: defaultParkingMinBackoff, maxBackoff: defaultParkingMaxBackoff}, conf)
+}
@@ -0,0 +1,257 @@
+package core
+
+import (
+	"encoding/json"
+	"runtime"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/flipkart-incubator/go-dmux/autoscale"
+	"github.com/flipkart-incubator/go-dmux/logging"
+	sideline_module "github.com/flipkart-incubator/go-dmux/sideline"
+	"github.com/stretchr/testify/assert"
+)
+
+// feedSource generates the messages sent to feed
+type feedSource struct {
+	parkingSource
+	feed chan interface{}
+}
+
+func (s *feedSource) Generate(out chan<- interface{}) {
+	for msg := range s.feed {
+		out <- msg
+	}
+}
+
+func TestResizeKeepsOrder(t *testing.T) {
+	source := &feedSource{feed: make(chan interface{})}
+	sink := &laneSink{consumed: make(map[string][]string), delay: 100 * time.Microsecond}
+	d := GetDmux(DmuxConf{Size: 4}, GetHashDistribution(laneKeyHasher{}))
+	d.ConnectWithSideline(source, sink, nil, DmuxOptionalParams{Connection: "orders"})
+
+	expected := make(map[string][]string)
+	send := func(from, to int) {
+		for i := from; i < to; i++ {
+			key := strconv.Itoa(i % 10)
+			msg := key + "-" + strconv.Itoa(i)
+			expected[key] = append(expected[key], msg)
+			source.feed <- msg
+		}
+	}
+	send(0, 300)
+	d.Resize(7)
+	send(300, 600)
+	d.Resize(2)
+	send(600, 900)
+	close(source.feed)
+
+	count := func() int {
+		sink.l.Lock()
+		defer sink.l.Unlock()
+		n := 0
+		for _, msgs := range sink.consumed {
+			n += len(msgs)
+		}
+		return n
+	}
+	assert.Eventually(t, func() bool { return count() == 900 }, 10*time.Second, 10*time.Millisecond)
+	d.Stop()
+	assert.Equal(t, expected, sink.consumed)
+}
+
+func TestGatedSink(t *testing.T) {
+	ready := make(chan struct{})
+	sink := &laneSink{consumed: make(map[string][]string)}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		(&gatedSink{sink, ready}).Clone().Consume("a-1", 0, nil)
+		wg.Done()
+	}()
+	time.Sleep(10 * time.Millisecond)
+	assert.Empty(t, sink.consumed)
+	close(ready)
+	wg.Wait()
+	assert.Equal(t, []string{"a-1"}, sink.consumed["a"])
+}
+
+// blockingSink holds the message block till release is closed
+type blockingSink struct {
+	laneSink
+	block   string
+	release chan struct{}
+}
+
+func (s *blockingSink) Clone() Sink { return s }
+
+func (s *blockingSink) Consume(msg interface{}, retries int, sidelineResponseCodes []int) error {
+	if msg == s.block {
+		<-s.release
+	}
+	return s.laneSink.Consume(msg, retries, sidelineResponseCodes)
+}
+
+func TestResizeHoldsOnlyMovedKeys(t *testing.T) {
+	d := GetConsistentHashDistribution(laneKeyHasher{})
+	sink := &blockingSink{laneSink: laneSink{consumed: make(map[string][]string)}, block: "0-0", release: make(chan struct{})}
+	conn := connection{name: "orders", logger: logging.ForConnection("orders")}
+	r := newRouter(d, simpleSetup(2, 10, sink), 10, conn)
+
+	// keys moving from the blocked worker and from the other one
+	blocked := d.Distribute("0-0", 2)
+	var fromBlocked, fromOther string
+	for k := 1; fromBlocked == "" || fromOther == ""; k++ {
+		msg := strconv.Itoa(k) + "-1"
+		if d.Distribute(msg, 3) != 2 {
+			continue
+		}
+		if d.Distribute(msg, 2) == blocked {
+			fromBlocked = msg
+		} else {
+			fromOther = msg
+		}
+	}
+
+	r.route("0-0")
+	r.resize(3)
+	assert.Equal(t, 1-blocked, <-r.passed())
+	r.pass(1 - blocked)
+
+	r.route(fromBlocked)
+	r.route(fromOther)
+	assert.Equal(t, []interface{}{fromBlocked}, r.moving.held[blocked])
+	assert.Eventually(t, func() bool {
+		sink.l.Lock()
+		defer sink.l.Unlock()
+		return len(sink.consumed[string(parkingSource{}.GetKey(fromOther))]) == 1
+	}, time.Second, time.Millisecond)
+
+	close(sink.release)
+	r.stop()
+	assert.Nil(t, r.moving)
+	assert.Equal(t, []string{fromBlocked}, sink.consumed[string(parkingSource{}.GetKey(fromBlocked))])
+}
+
+// noSideline never sidelines
+type noSideline struct{}
+
+func (noSideline) CheckMessageSideline(key []byte) ([]byte, error) {
+	return json.Marshal(sideline_module.CheckMessageSidelineResponse{})
+}
+func (noSideline) SidelineMessage(msg []byte) sideline_module.SidelineMessageResponse {
+	return sideline_module.SidelineMessageResponse{Success: true}
+}
+func (noSideline) InitialisePlugin(conf []byte) error { return nil }
+
+func TestResizeWithSidelineStopsWorkers(t *testing.T) {
+	before := runtime.NumGoroutine()
+	sink := &laneSink{consumed: make(map[string][]string)}
+	conn := connection{name: "orders", logger: logging.ForConnection("orders")}
+	r := newRouter(GetHashDistribution(laneKeyHasher{}), simpleSetupWithSideline(4, 10, sink, parkingSource{}, Sideline{}, noSideline{}, conn), 10, conn)
+
+	expected := make(map[string][]string)
+	for i := 0; i < 100; i++ {
+		msg := strconv.Itoa(i%10) + "-" + strconv.Itoa(i)
+		expected[string(parkingSource{}.GetKey(msg))] = append(expected[string(parkingSource{}.GetKey(msg))], msg)
+		r.route(msg)
+		if i == 50 {
+			r.resize(1)
+		}
+	}
+	r.stop()
+
+	assert.Equal(t, expected, sink.consumed)
+	for deadline := time.Now().Add(time.Second); runtime.NumGoroutine() > before && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	assert.LessOrEqual(t, runtime.NumGoroutine(), before)
+}
+
+func TestAutoscaleWithSidelineKeepsSourceFlowing(t *testing.T) {
+	source := &feedSource{feed: make(chan interface{})}
+	sink := &blockingSink{laneSink: laneSink{consumed: make(map[string][]string)}, block: "0-0", release: make(chan struct{})}
+	d := GetDmux(DmuxConf{Size: 2, SinkQSize: 10, Autoscale: autoscale.Conf{Enabled: true, Max: 3, Interval: "5ms", Cooldown: "1ms"}},
+		GetConsistentHashDistribution(laneKeyHasher{}))
+	d.ConnectWithSideline(source, sink, noSideline{}, DmuxOptionalParams{Connection: "autoscaled"})
+
+	// the worker of key 0 is blocked while the lag makes the controller grow
+	source.feed <- "0-0"
+	autoscale.ForConnection("autoscaled").Lag("orders", 0, 5000)
+	time.Sleep(50 * time.Millisecond)
+
+	// keys that kept their worker or moved from the other one still flow
+	expected := make(map[string][]string)
+	for k := 1; k < 10; k++ {
+		msg := strconv.Itoa(k) + "-1"
+		expected[string(parkingSource{}.GetKey(msg))] = []string{msg}
+		source.feed <- msg
+	}
+	consumed := func() int {
+		sink.l.Lock()
+		defer sink.l.Unlock()
+		return len(sink.consumed)
+	}
+	assert.Eventually(t, func() bool { return consumed() > 0 }, time.Second, time.Millisecond)
+
+	close(sink.release)
+	close(source.feed)
+	expected["0"] = []string{"0-0"}
+	assert.Eventually(t, func() bool { return consumed() == 10 }, time.Second, time.Millisecond)
+	d.Stop()
+	assert.Equal(t, expected, sink.consumed)
+}
+
+func TestResizeWithSidelineDoesNotWaitForDrain(t *testing.T) {
+	source := &feedSource{feed: make(chan interface{})}
+	sink := &blockingSink{laneSink: laneSink{consumed: make(map[string][]string)}, block: "0-0", release: make(chan struct{})}
+	d := GetDmux(DmuxConf{Size: 2, SinkQSize: 10}, GetHashDistribution(laneKeyHasher{}))
+	d.ConnectWithSideline(source, sink, noSideline{}, DmuxOptionalParams{Connection: "orders"})
+
+	expected := make(map[string][]string)
+	send := func(msg string) {
+		key := string(parkingSource{}.GetKey(msg))
+		expected[key] = append(expected[key], msg)
+		source.feed <- msg
+	}
+	// the worker of key 0 is blocked with a backlog behind it
+	for i := 0; i < 15; i++ {
+		send("0-" + strconv.Itoa(i))
+	}
+
+	resized := make(chan struct{})
+	go func() {
+		d.Resize(3)
+		close(resized)
+	}()
+	if !assert.Eventually(t, func() bool {
+		select {
+		case <-resized:
+			return true
+		default:
+			return false
+		}
+	}, time.Second, time.Millisecond) {
+		close(sink.release)
+		return
+	}
+	for k := 0; k < 10; k++ {
+		send(strconv.Itoa(k) + "-15")
+	}
+
+	close(sink.release)
+	close(source.feed)
+	assert.Eventually(t, func() bool {
+		sink.l.Lock()
+		defer sink.l.Unlock()
+		n := 0
+		for _, msgs := range sink.consumed {
+			n += len(msgs)
+		}
+		return n == 25
+	}, 10*time.Second, 10*time.Millisecond)
+	d.Stop()
+	assert.Equal(t, expected, sink.consumed)
+}
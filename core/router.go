@@ -0,0 +1,142 @@
+package core
+
+// router distributes the messages of a Dmux to the queues of its workers.
+// On resize only the messages whose key moved to another worker wait, till
+// the old worker consumed what was queued to it before the resize, so keys
+// stay in order without draining every worker
+type router struct {
+	distribute Distributor
+	workers    workers
+	ch         []chan interface{}
+	qsize      int // messages held per worker before routing waits for a resize
+	m          *dmuxMetrics
+	conn       connection
+	moving     *moving // nil unless a resize is in progress
+}
+
+// moving is a resize whose fences did not all pass yet
+type moving struct {
+	from    int               // workers before the resize
+	keyed   bool              // the old worker of a message is known, else every message waits for every fence
+	fences  []<-chan struct{} // of the workers before the resize, nil once passed
+	held    [][]interface{}   // messages waiting for the fence of their old worker
+	count   int               // held messages
+	pending int               // fences not passed
+	passed  chan int          // index of every fence that passed
+}
+
+func newRouter(distribute Distributor, w workers, qsize int, conn connection) *router {
+	r := &router{
+		distribute: distribute,
+		workers:    w,
+		ch:         w.queues(),
+		qsize:      qsize,
+		conn:       conn,
+	}
+	watchQueues(distribute, r.ch)
+	r.m = newDmuxMetrics(conn.name, len(r.ch))
+	return r
+}
+
+// route queues data to its worker, or holds it if its key is moving
+func (r *router) route(data interface{}) {
+	i := r.distribute.Distribute(data, len(r.ch))
+	if mv := r.moving; mv != nil {
+		from := 0
+		if mv.keyed {
+			from = r.distribute.Distribute(data, mv.from)
+		}
+		if !mv.keyed || (from != i && mv.fences[from] != nil) {
+			mv.held[from] = append(mv.held[from], data)
+			mv.count++
+			if mv.count >= r.qsize*len(r.ch) {
+				r.conn.logger.Infof("resize holds %d messages, waiting for the old workers", mv.count)
+				r.settle()
+			}
+			return
+		}
+	}
+	r.conn.logger.SampledDebugf("writing to channel %d len %d", i, len(r.ch[i]))
+	r.ch[i] <- data
+	r.m.distribute(i)
+}
+
+// resize the workers to size, a resize still in progress is settled first
+func (r *router) resize(size int) {
+	r.settle()
+	old := r.ch
+	fences := r.workers.resize(size)
+	r.ch = r.workers.queues()
+	watchQueues(r.distribute, r.ch)
+	r.m.resize(old, len(r.ch))
+
+	order := orderOf(r.distribute)
+	if fences == nil || order == unordered {
+		return
+	}
+	mv := &moving{
+		from:   len(old),
+		keyed:  order == keyed,
+		fences: fences,
+		held:   make([][]interface{}, len(old)),
+		passed: make(chan int, len(old)),
+	}
+	for i, f := range fences {
+		if f == nil {
+			continue
+		}
+		mv.pending++
+		go func(i int, f <-chan struct{}) {
+			<-f
+			mv.passed <- i
+		}(i, f)
+	}
+	if mv.pending > 0 {
+		r.moving = mv
+	}
+}
+
+// passed returns the channel fences of the resize in progress pass on, nil
+// if there is none
+func (r *router) passed() <-chan int {
+	if r.moving == nil {
+		return nil
+	}
+	return r.moving.passed
+}
+
+// pass routes the messages that waited for the fence of worker i
+func (r *router) pass(i int) {
+	mv := r.moving
+	mv.fences[i] = nil
+	mv.pending--
+	var release [][]interface{}
+	if mv.keyed {
+		release = append(release, mv.held[i])
+		mv.count -= len(mv.held[i])
+		mv.held[i] = nil
+	}
+	if mv.pending == 0 {
+		release = append(release, mv.held...)
+		r.moving = nil
+	}
+	for _, held := range release {
+		for _, data := range held {
+			r.route(data)
+		}
+	}
+}
+
+// settle waits for every fence of the resize in progress
+func (r *router) settle() {
+	for r.moving != nil {
+		r.pass(<-r.moving.passed)
+	}
+}
+
+// stop routes what is held and stops the workers
+func (r *router) stop() {
+	r.settle()
+	r.workers.stop()
+	r.m.flush(r.ch)
+}
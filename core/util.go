@@ -95,6 +95,42 @@ func EncodePayload(key []byte, offset int64, data []byte) []byte {
 	return buffer
 }
 
+//RecordHeader is a header of a source record, such as a kafka record header
+type RecordHeader struct {
+	Key   []byte
+	Value []byte
+}
+
+//EncodePayloadV3 function is used to convert payload byte[] to 1d byte[] along with the key,
+//offset, timestamp and headers of the record
+//This function uses the following encoding scheme
+// first 4 bytes = data Size
+// next 8 bytes = offset
+// next 8 bytes = timestamp in epoch millis, -1 if unknown
+// next 4 bytes = key length
+// next n byte = key
+// next 4 bytes = header count
+// now for every header
+// 4 bytes = header key length followed by key, 4 bytes = header value length followed by value
+// followed by data[]
+func EncodePayloadV3(key []byte, offset int64, timestamp int64, headers []RecordHeader, data []byte) []byte {
+	var buffer []byte
+	buffer = append(buffer, bytesFromInt(len(data))...)
+	buffer = append(buffer, bytesFromInt64(offset)...)
+	buffer = append(buffer, bytesFromInt64(timestamp)...)
+	buffer = append(buffer, bytesFromInt(len(key))...)
+	buffer = append(buffer, key...)
+	buffer = append(buffer, bytesFromInt(len(headers))...)
+	for _, header := range headers {
+		buffer = append(buffer, bytesFromInt(len(header.Key))...)
+		buffer = append(buffer, header.Key...)
+		buffer = append(buffer, bytesFromInt(len(header.Value))...)
+		buffer = append(buffer, header.Value...)
+	}
+	buffer = append(buffer, data...)
+	return buffer
+}
+
 func bytesFromInt(val int) []byte {
 	buffer := make([]byte, 4)
 	binary.BigEndian.PutUint32(buffer, uint32(val))
@@ -1,6 +1,8 @@
 package core
 
 import (
+	"bytes"
+	"log"
 	"math/rand"
 	"testing"
 )
@@ -51,3 +53,22 @@ func TestContains(t *testing.T) {
 	}
 
 }
+
+func TestEncodePayloadV3(t *testing.T) {
+	headers := []RecordHeader{{Key: []byte("trace-id"), Value: []byte("abc")}}
+	payload := EncodePayloadV3([]byte("OD1"), 42, 1622548800000, headers, []byte("data"))
+
+	expected := []byte{
+		0, 0, 0, 4, // data size
+		0, 0, 0, 0, 0, 0, 0, 42, // offset
+		0, 0, 1, 121, 199, 113, 226, 0, // timestamp
+		0, 0, 0, 3, 'O', 'D', '1', // key
+		0, 0, 0, 1, // header count
+		0, 0, 0, 8, 't', 'r', 'a', 'c', 'e', '-', 'i', 'd',
+		0, 0, 0, 3, 'a', 'b', 'c',
+		'd', 'a', 't', 'a',
+	}
+	if !bytes.Equal(expected, payload) {
+		t.Errorf("expected %v got %v", expected, payload)
+	}
+}
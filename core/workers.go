@@ -0,0 +1,145 @@
+package core
+
+import (
+	"sync"
+)
+
+// workers consume the queues a Dmux distributes messages to
+type workers interface {
+	// queues returns the queues of the workers, a Dmux distributes to them by
+	// index
+	queues() []chan interface{}
+	// resize changes the number of workers. It returns a channel for every
+	// queue before the resize which is closed once the messages queued to it
+	// before the resize are consumed, nil if nothing needs to wait for them
+	resize(size int) []<-chan struct{}
+	// stop consumes every queued message and returns once every go routine
+	// of the workers returned
+	stop()
+}
+
+// fence is queued to a worker on resize, the worker closes it once every
+// message queued before the fence is consumed
+type fence chan struct{}
+
+// queueWorkers runs one worker per queue, a resize starts or retires single
+// workers while the others keep consuming
+type queueWorkers struct {
+	ch      []chan interface{}
+	done    []chan struct{} // closed once the worker of the queue returned
+	retired []chan struct{} // done of the workers retired by resize
+	qsize   int
+	work    func(in chan interface{}) // consumes in till it is closed, closing every fence of in
+}
+
+func newQueueWorkers(size, qsize int, work func(in chan interface{})) *queueWorkers {
+	w := &queueWorkers{qsize: qsize, work: work}
+	w.resize(size)
+	return w
+}
+
+func (w *queueWorkers) queues() []chan interface{} {
+	return w.ch
+}
+
+// resize queues a fence to the workers that remain and retires the last
+// workers, the fence of a retired worker is its return
+func (w *queueWorkers) resize(size int) []<-chan struct{} {
+	if size == len(w.ch) {
+		return nil
+	}
+	fences := make([]<-chan struct{}, len(w.ch))
+	for i := range w.ch {
+		if i < size {
+			f := make(fence)
+			w.ch[i] <- f
+			fences[i] = f
+		} else {
+			close(w.ch[i])
+			fences[i] = w.done[i]
+			w.retired = append(w.retired, w.done[i])
+		}
+	}
+	if size < len(w.ch) {
+		w.ch, w.done = w.ch[:size:size], w.done[:size:size]
+	}
+	for len(w.ch) < size {
+		in, done := make(chan interface{}, w.qsize), make(chan struct{})
+		w.ch, w.done = append(w.ch, in), append(w.done, done)
+		go func() {
+			w.work(in)
+			close(done)
+		}()
+	}
+	return fences
+}
+
+func (w *queueWorkers) stop() {
+	for _, c := range w.ch {
+		close(c)
+	}
+	for _, done := range append(w.done, w.retired...) {
+		<-done
+	}
+	w.ch, w.done, w.retired = nil, nil, nil
+}
+
+// batchWorkers are rebuilt on resize, the workers of the new batchSetup wait
+// for the old ones to drain in the background before consuming
+type batchWorkers struct {
+	ch    []chan interface{}
+	wg    *sync.WaitGroup
+	sink  Sink
+	setup func(size int, sink Sink) ([]chan interface{}, *sync.WaitGroup)
+}
+
+func newBatchWorkers(size int, sink Sink, setup func(size int, sink Sink) ([]chan interface{}, *sync.WaitGroup)) *batchWorkers {
+	w := &batchWorkers{sink: sink, setup: setup}
+	w.ch, w.wg = setup(size, sink)
+	return w
+}
+
+func (w *batchWorkers) queues() []chan interface{} {
+	return w.ch
+}
+
+func (w *batchWorkers) resize(size int) []<-chan struct{} {
+	drained := make(chan struct{})
+	go func(ch []chan interface{}, wg *sync.WaitGroup) {
+		shutdown(ch, wg)
+		close(drained)
+	}(w.ch, w.wg)
+	w.ch, w.wg = w.setup(size, &gatedSink{w.sink, drained})
+	return nil
+}
+
+func (w *batchWorkers) stop() {
+	shutdown(w.ch, w.wg)
+}
+
+// gatedSink holds every call of Sink till ready is closed
+type gatedSink struct {
+	Sink
+	ready <-chan struct{}
+}
+
+func (g *gatedSink) Clone() Sink {
+	return &gatedSink{g.Sink.Clone(), g.ready}
+}
+
+func (g *gatedSink) Consume(msg interface{}, retries int, sidelineResponseCodes []int) error {
+	<-g.ready
+	return g.Sink.Consume(msg, retries, sidelineResponseCodes)
+}
+
+func (g *gatedSink) BatchConsume(msg []interface{}, version int) {
+	<-g.ready
+	g.Sink.BatchConsume(msg, version)
+}
+
+func shutdown(ch []chan interface{}, wg *sync.WaitGroup) {
+	for _, c := range ch {
+		close(c)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,550 @@
+package filter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// node is a parsed expression, evaluated to nil, bool, float64, string,
+// json.Number, []interface{} or map[string]interface{}
+type node interface {
+	eval(r *Record) interface{}
+}
+
+// parse parses an expression of the filter language:
+//
+//	expr    = and { "||" and }
+//	and     = not { "&&" not }
+//	not     = "!" not | compare
+//	compare = operand [ op operand ], op is one of == != < <= > >= contains
+//	          startsWith endsWith matches in
+//	operand = "(" expr ")" | string | number | true | false | null
+//	          | "[" [ operand { "," operand } ] "]" | path
+//	path    = ( key | value | headers | topic | partition | offset )
+//	          { "." name | "." index | "[" string "]" | "[" index "]" }
+func parse(expression string) (node, error) {
+	tokens, err := lex(expression)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	n, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tEOF {
+		return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+	}
+	return n, nil
+}
+
+type tokenKind int
+
+const (
+	tEOF tokenKind = iota
+	tIdent
+	tString
+	tNumber
+	tSymbol
+)
+
+type token struct {
+	kind tokenKind
+	text string // unquoted for strings
+	pos  int
+}
+
+var symbols = []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "(", ")", "[", "]", ",", ".", "-"}
+
+func lex(s string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '\'' || c == '"':
+			j := i + 1
+			var b strings.Builder
+			for ; j < len(s) && rune(s[j]) != c; j++ {
+				if s[j] == '\\' && j+1 < len(s) && (rune(s[j+1]) == c || s[j+1] == '\\') {
+					j++ // other escapes are kept for regexes
+				}
+				b.WriteByte(s[j])
+			}
+			if j == len(s) {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			tokens = append(tokens, token{tString, b.String(), i})
+			i = j + 1
+		case isDigit(s[i]):
+			j := i
+			for j < len(s) && (isDigit(s[j]) || s[j] == '.' && j+1 < len(s) && isDigit(s[j+1]) || s[j] == 'e' || s[j] == 'E') {
+				j++
+			}
+			tokens = append(tokens, token{tNumber, s[i:j], i})
+			i = j
+		case c == '_' || unicode.IsLetter(c):
+			j := i
+			for j < len(s) && (s[j] == '_' || s[j] == '-' || unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j]))) {
+				j++
+			}
+			tokens = append(tokens, token{tIdent, s[i:j], i})
+			i = j
+		default:
+			matched := false
+			for _, symbol := range symbols {
+				if strings.HasPrefix(s[i:], symbol) {
+					tokens = append(tokens, token{tSymbol, symbol, i})
+					i += len(symbol)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected %q at %d", c, i)
+			}
+		}
+	}
+	return append(tokens, token{tEOF, "end", len(s)}), nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+type parser struct {
+	tokens []token
+	next   int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *parser) take() token {
+	t := p.tokens[p.next]
+	if t.kind != tEOF {
+		p.next++
+	}
+	return t
+}
+
+// accept takes the next token if it is the symbol or keyword text
+func (p *parser) accept(text string) bool {
+	if t := p.peek(); (t.kind == tSymbol || t.kind == tIdent) && t.text == text {
+		p.next++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(text string) error {
+	if !p.accept(text) {
+		t := p.peek()
+		return fmt.Errorf("expected %q at %d, got %q", text, t.pos, t.text)
+	}
+	return nil
+}
+
+func (p *parser) or() (node, error) {
+	left, err := p.and()
+	for err == nil && p.accept("||") {
+		var right node
+		if right, err = p.and(); err == nil {
+			left = orNode{left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *parser) and() (node, error) {
+	left, err := p.not()
+	for err == nil && p.accept("&&") {
+		var right node
+		if right, err = p.not(); err == nil {
+			left = andNode{left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *parser) not() (node, error) {
+	if p.accept("!") {
+		n, err := p.not()
+		return notNode{n}, err
+	}
+	return p.compare()
+}
+
+var operators = []string{"==", "!=", "<=", ">=", "<", ">", "contains", "startsWith", "endsWith", "matches", "in"}
+
+func (p *parser) compare() (node, error) {
+	left, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range operators {
+		if !p.accept(op) {
+			continue
+		}
+		right, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		if op != "matches" {
+			return compareNode{op, left, right}, nil
+		}
+		pattern, ok := right.(literal)
+		if s, isString := pattern.value.(string); ok && isString {
+			re, err := regexp.Compile(s)
+			return matchNode{left, re}, err
+		}
+		return nil, errors.New("matches needs a string regex")
+	}
+	return left, nil
+}
+
+func (p *parser) operand() (node, error) {
+	t := p.take()
+	switch t.kind {
+	case tString:
+		return literal{t.text}, nil
+	case tNumber:
+		return number(t)
+	case tSymbol:
+		switch t.text {
+		case "(":
+			n, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			return n, p.expect(")")
+		case "-":
+			n := p.take()
+			if n.kind != tNumber {
+				return nil, fmt.Errorf("expected a number at %d", n.pos)
+			}
+			n.text = "-" + n.text
+			return number(n)
+		case "[":
+			var items listNode
+			for !p.accept("]") {
+				if len(items) > 0 {
+					if err := p.expect(","); err != nil {
+						return nil, err
+					}
+				}
+				item, err := p.operand()
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, item)
+			}
+			return items, nil
+		}
+	case tIdent:
+		switch t.text {
+		case "true", "false":
+			return literal{t.text == "true"}, nil
+		case "null":
+			return literal{nil}, nil
+		case "key", "value", "headers", "topic", "partition", "offset":
+			return p.path(t)
+		}
+	}
+	return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+}
+
+func number(t token) (node, error) {
+	f, err := strconv.ParseFloat(t.text, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid number %q at %d", t.text, t.pos)
+	}
+	return literal{f}, nil
+}
+
+func (p *parser) path(root token) (node, error) {
+	n := pathNode{root: root.text}
+	for {
+		if p.accept(".") {
+			t := p.take()
+			if t.kind != tIdent && t.kind != tNumber {
+				return nil, fmt.Errorf("expected a field at %d", t.pos)
+			}
+			n.fields = append(n.fields, strings.Split(t.text, ".")...) // value.0.1 lexes as a number
+		} else if p.accept("[") {
+			t := p.take()
+			if t.kind != tString && t.kind != tNumber {
+				return nil, fmt.Errorf("expected a field at %d", t.pos)
+			}
+			n.fields = append(n.fields, t.text)
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+		} else {
+			break
+		}
+	}
+	switch {
+	case n.root == "headers" && len(n.fields) != 1:
+		return nil, fmt.Errorf("headers at %d needs one name", root.pos)
+	case n.root != "headers" && n.root != "value" && len(n.fields) > 0:
+		return nil, fmt.Errorf("%s at %d has no fields", n.root, root.pos)
+	}
+	return n, nil
+}
+
+type literal struct {
+	value interface{}
+}
+
+func (l literal) eval(r *Record) interface{} {
+	return l.value
+}
+
+type listNode []node
+
+func (l listNode) eval(r *Record) interface{} {
+	values := make([]interface{}, len(l))
+	for i, n := range l {
+		values[i] = n.eval(r)
+	}
+	return values
+}
+
+type pathNode struct {
+	root   string
+	fields []string
+}
+
+func (n pathNode) eval(r *Record) interface{} {
+	switch n.root {
+	case "key":
+		return string(r.Key)
+	case "topic":
+		return r.Topic
+	case "partition":
+		return float64(r.Partition)
+	case "offset":
+		return float64(r.Offset)
+	case "headers":
+		if r.Header == nil {
+			return nil
+		}
+		if h := r.Header(n.fields[0]); h != nil {
+			return string(h)
+		}
+		return nil
+	}
+	v := r.value()
+	for _, field := range n.fields {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			v = node[field]
+		case []interface{}:
+			i, err := strconv.Atoi(field)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil
+			}
+			v = node[i]
+		default:
+			return nil
+		}
+	}
+	return v
+}
+
+type notNode struct {
+	n node
+}
+
+func (n notNode) eval(r *Record) interface{} {
+	return !truthy(n.n.eval(r))
+}
+
+type andNode struct {
+	left, right node
+}
+
+func (n andNode) eval(r *Record) interface{} {
+	return truthy(n.left.eval(r)) && truthy(n.right.eval(r))
+}
+
+type orNode struct {
+	left, right node
+}
+
+func (n orNode) eval(r *Record) interface{} {
+	return truthy(n.left.eval(r)) || truthy(n.right.eval(r))
+}
+
+type matchNode struct {
+	n  node
+	re *regexp.Regexp
+}
+
+func (n matchNode) eval(r *Record) interface{} {
+	s, ok := n.n.eval(r).(string)
+	return ok && n.re.MatchString(s)
+}
+
+type compareNode struct {
+	op          string
+	left, right node
+}
+
+func (n compareNode) eval(r *Record) interface{} {
+	a, b := n.left.eval(r), n.right.eval(r)
+	switch n.op {
+	case "==":
+		return equal(a, b)
+	case "!=":
+		return !equal(a, b)
+	case "contains":
+		switch v := a.(type) {
+		case string:
+			s, ok := b.(string)
+			return ok && strings.Contains(v, s)
+		case []interface{}:
+			return in(b, v)
+		case map[string]interface{}:
+			s, ok := b.(string)
+			_, found := v[s]
+			return ok && found
+		}
+		return false
+	case "startsWith", "endsWith":
+		s, ok := a.(string)
+		prefix, isString := b.(string)
+		if !ok || !isString {
+			return false
+		}
+		if n.op == "startsWith" {
+			return strings.HasPrefix(s, prefix)
+		}
+		return strings.HasSuffix(s, prefix)
+	case "in":
+		list, ok := b.([]interface{})
+		return ok && in(a, list)
+	}
+	c, ok := compare(a, b)
+	if !ok {
+		return false
+	}
+	switch n.op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	default:
+		return c >= 0
+	}
+}
+
+// truthy is false for nil, false, 0, "" and empty lists and objects
+func truthy(v interface{}) bool {
+	switch t := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return t
+	case string:
+		return t != ""
+	case []interface{}:
+		return len(t) > 0
+	case map[string]interface{}:
+		return len(t) > 0
+	}
+	f, ok := toNumber(v)
+	return !ok || f != 0
+}
+
+// toNumber converts numbers and strings of numbers to float64
+func toNumber(v interface{}) (float64, bool) {
+	switch t := v.(type) {
+	case float64:
+		return t, true
+	case json.Number:
+		f, err := t.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(t, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func isNumber(v interface{}) bool {
+	switch v.(type) {
+	case float64, json.Number:
+		return true
+	}
+	return false
+}
+
+// equal compares numbers as numbers if either side is one, so headers can
+// be compared with numbers
+func equal(a, b interface{}) bool {
+	if isNumber(a) || isNumber(b) {
+		x, ok := toNumber(a)
+		y, isNum := toNumber(b)
+		return ok && isNum && x == y
+	}
+	switch t := a.(type) {
+	case nil, bool, string:
+		return a == b
+	case []interface{}:
+		u, ok := b.([]interface{})
+		if !ok || len(t) != len(u) {
+			return false
+		}
+		for i := range t {
+			if !equal(t[i], u[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// compare orders numbers if either side is one and strings otherwise
+func compare(a, b interface{}) (int, bool) {
+	if isNumber(a) || isNumber(b) {
+		x, ok := toNumber(a)
+		y, isNum := toNumber(b)
+		if !ok || !isNum {
+			return 0, false
+		}
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	}
+	x, ok := a.(string)
+	y, isString := b.(string)
+	if !ok || !isString {
+		return 0, false
+	}
+	return strings.Compare(x, y), true
+}
+
+func in(v interface{}, list []interface{}) bool {
+	for _, item := range list {
+		if equal(v, item) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+package filter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/flipkart-incubator/go-dmux/metrics"
+)
+
+// Conf holds the rules messages are filtered by before they are distributed.
+// A message matching an exclude rule is dropped, if there are include rules a
+// message is dropped unless it matches one of them
+type Conf struct {
+	Include []Rule `json:"include"`
+	Exclude []Rule `json:"exclude"`
+}
+
+// Rule is a named expression, see parse for its grammar. A message matches
+// if the expression is true, a path is true if it is present and not false,
+// 0, "" or empty
+type Rule struct {
+	Name string `json:"name"` //label of the rule in dmux_filter_matches_total, defaults to include.<index> or exclude.<index>
+	When string `json:"when"` //expression matched against each message
+}
+
+// Record is what rules are evaluated against
+type Record struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	Key       []byte
+	Value     []byte
+	Header    func(name string) []byte //value of the header name, nil if missing or the record has no headers
+
+	decoded      bool
+	decodedValue interface{}
+}
+
+// value returns Value decoded as json, or as a string if it is not json
+func (r *Record) value() interface{} {
+	if !r.decoded {
+		r.decoded = true
+		d := json.NewDecoder(bytes.NewReader(r.Value))
+		d.UseNumber()
+		if err := d.Decode(&r.decodedValue); err != nil || d.More() {
+			r.decodedValue = string(r.Value)
+		}
+	}
+	return r.decodedValue
+}
+
+type rule struct {
+	name string
+	expr node
+}
+
+// Filter decides which messages of a connection are distributed. A nil
+// *Filter keeps every message
+type Filter struct {
+	connection       string
+	include, exclude []rule
+}
+
+// GetFilter returns the Filter of conf for connection, nil if conf has no
+// rules. An invalid rule is fatal
+func GetFilter(connection string, conf Conf) *Filter {
+	f, err := compile(connection, conf)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	return f
+}
+
+func compile(connection string, conf Conf) (*Filter, error) {
+	if len(conf.Include) == 0 && len(conf.Exclude) == 0 {
+		return nil, nil
+	}
+	f := &Filter{connection: connection}
+	var err error
+	if f.include, err = compileRules("include", conf.Include); err != nil {
+		return nil, err
+	}
+	if f.exclude, err = compileRules("exclude", conf.Exclude); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func compileRules(kind string, rules []Rule) ([]rule, error) {
+	compiled := make([]rule, len(rules))
+	for i, r := range rules {
+		name := r.Name
+		if name == "" {
+			name = kind + "." + strconv.Itoa(i)
+		}
+		expr, err := parse(r.When)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter rule %s: %v", name, err)
+		}
+		compiled[i] = rule{name, expr}
+	}
+	return compiled, nil
+}
+
+// Keep returns false if r is to be dropped. The rule that decided is counted
+// in dmux_filter_matches_total and dropped messages in dmux_filtered_total
+func (f *Filter) Keep(r *Record) bool {
+	if f == nil {
+		return true
+	}
+	for _, ex := range f.exclude {
+		if truthy(ex.expr.eval(r)) {
+			f.match(ex)
+			f.drop()
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, in := range f.include {
+		if truthy(in.expr.eval(r)) {
+			f.match(in)
+			return true
+		}
+	}
+	f.drop()
+	return false
+}
+
+func (f *Filter) match(r rule) {
+	metrics.Ingest(metrics.Metric{Type: metrics.FilterMatches, Value: 1, Labels: metrics.Labels{Connection: f.connection, Rule: r.name}})
+}
+
+func (f *Filter) drop() {
+	metrics.Ingest(metrics.Metric{Type: metrics.Filtered, Value: 1, Labels: metrics.Labels{Connection: f.connection}})
+}
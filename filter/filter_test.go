@@ -0,0 +1,115 @@
+package filter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func record() *Record {
+	headers := map[string]string{"x-tenant": "acme", "version": "3"}
+	return &Record{
+		Topic:     "orders",
+		Partition: 2,
+		Offset:    42,
+		Key:       []byte("order-17"),
+		Value:     []byte(`{"type":"created","amount":120.5,"items":[{"sku":"a1"},{"sku":"b2"}],"tags":["new","vip"],"test":false}`),
+		Header: func(name string) []byte {
+			if v, ok := headers[name]; ok {
+				return []byte(v)
+			}
+			return nil
+		},
+	}
+}
+
+func TestExpressions(t *testing.T) {
+	cases := map[string]bool{
+		`value.type == "created"`:                       true,
+		`value.type != 'created'`:                       false,
+		`value.amount > 100 && value.amount <= 120.5`:   true,
+		`value.amount < -1`:                             false,
+		`value.items.1.sku == "b2"`:                     true,
+		`value["items"][0].sku == "a1"`:                 true,
+		`value.items.5.sku == null`:                     true,
+		`value.tags contains "vip"`:                     true,
+		`value contains "tags"`:                         true,
+		`value.type in ["created", "updated"]`:          true,
+		`!(value.type in ["deleted"])`:                  true,
+		`value.test`:                                    false,
+		`value.missing`:                                 false,
+		`value.items`:                                   true,
+		`key startsWith "order-" && key endsWith "17"`:  true,
+		`key matches '^order-\d+$'`:                     true,
+		`key contains "der"`:                            true,
+		`headers.x-tenant == "acme"`:                    true,
+		`headers["x-tenant"] == 'acme' || false`:        true,
+		`headers.version >= 3`:                          true,
+		`headers.version == "3"`:                        true,
+		`headers.missing`:                               false,
+		`topic == "orders" && partition == 2`:           true,
+		`offset > 41 && offset in [42, 43]`:             true,
+		`value.type == "created" && value.amount > 200`: false,
+		`value.amount > 200 || value.type == "created"`: true,
+	}
+	for expression, expected := range cases {
+		n, err := parse(expression)
+		if assert.NoError(t, err, expression) {
+			assert.Equal(t, expected, truthy(n.eval(record())), expression)
+		}
+	}
+
+	plain := &Record{Value: []byte("not json")}
+	n, _ := parse(`value == "not json" && value.a == null`)
+	assert.True(t, truthy(n.eval(plain)))
+	n, _ = parse(`headers.a == null`)
+	assert.True(t, truthy(n.eval(plain)))
+}
+
+func TestInvalidExpressions(t *testing.T) {
+	for _, expression := range []string{
+		``,
+		`value ==`,
+		`value.type == "created`,
+		`(key == "a"`,
+		`key.a == "a"`,
+		`headers == "a"`,
+		`key matches value`,
+		`key matches "("`,
+		`body == 1`,
+		`key == "a" key`,
+		`[1, 2`,
+	} {
+		_, err := parse(expression)
+		assert.Error(t, err, expression)
+	}
+}
+
+func TestKeep(t *testing.T) {
+	var none *Filter
+	assert.True(t, none.Keep(record()))
+	f, err := compile("orders", Conf{})
+	assert.NoError(t, err)
+	assert.Nil(t, f)
+
+	_, err = compile("orders", Conf{Include: []Rule{{Name: "broken", When: "value =="}}})
+	assert.EqualError(t, err, `invalid filter rule broken: unexpected "end" at 8`)
+
+	f = GetFilter("orders", Conf{
+		Include: []Rule{{Name: "created", When: `value.type == "created"`}, {When: `value.type == "updated"`}},
+		Exclude: []Rule{{Name: "tests", When: `value.test`}},
+	})
+	assert.Equal(t, "include.1", f.include[1].name)
+
+	keep := func(value string) bool {
+		return f.Keep(&Record{Value: []byte(value)})
+	}
+	assert.True(t, keep(`{"type":"created"}`))
+	assert.True(t, keep(`{"type":"updated"}`))
+	assert.False(t, keep(`{"type":"deleted"}`))
+	assert.False(t, keep(`{"type":"created","test":true}`))
+
+	f = GetFilter("orders", Conf{Exclude: []Rule{{When: `key == "skip"`}}})
+	assert.False(t, f.Keep(&Record{Key: []byte("skip")}))
+	assert.True(t, f.Keep(&Record{Key: []byte("other")}))
+}
@@ -3,13 +3,16 @@ module github.com/flipkart-incubator/go-dmux
 go 1.13
 
 require (
-	github.com/Shopify/sarama v1.20.1
+	github.com/Shopify/sarama v1.23.1
 	github.com/apache/pulsar-client-go v0.11.0
 	github.com/cenkalti/backoff v2.2.1+incompatible
 	github.com/gorilla/mux v1.7.4
 	github.com/prometheus/client_golang v1.12.1
 	github.com/samuel/go-zookeeper v0.0.0-20180130194729-c4fab1ac1bec
+	github.com/sirupsen/logrus v1.6.0
 	github.com/stretchr/testify v1.8.0
+	github.com/tetratelabs/wazero v1.2.1
+	github.com/xdg/scram v1.0.5
 	gopkg.in/natefinch/lumberjack.v2 v2.0.0
 )
 
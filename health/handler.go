@@ -0,0 +1,38 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+type liveBody struct {
+	Live bool `json:"live"`
+}
+
+type readyBody struct {
+	Ready       bool              `json:"ready"`
+	Connections map[string]Status `json:"connections"`
+}
+
+// LiveHandler serves liveness, it responds 200 as long as the process serves
+// requests
+func LiveHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(liveBody{Live: true})
+	})
+}
+
+// ReadyHandler serves readiness, it responds 200 if every connection is ready
+// and 503 otherwise, the body has the status of every connection with the
+// reasons it is not ready
+func ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ready, statuses := Ready()
+		w.Header().Set("Content-Type", "application/json")
+		if !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(readyBody{Ready: ready, Connections: statuses})
+	})
+}
@@ -0,0 +1,308 @@
+package health
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Conf holds the thresholds readiness is evaluated with
+type Conf struct {
+	MinSuccessRatio *float64 `json:"min_success_ratio"` //least ratio of successful sink calls, defaults to 0.5
+	MinCalls        int      `json:"min_calls"`         //sink calls in the window below which the ratio is not checked, defaults to 10
+	SuccessWindow   string   `json:"success_window"`    //window the success ratio is evaluated over, defaults to 1m
+	StallTimeout    string   `json:"stall_timeout"`     //longest the source may block or commits may not advance while messages are pending, defaults to 5m
+}
+
+const (
+	defaultMinSuccessRatio = 0.5
+	defaultMinCalls        = 10
+	defaultSuccessWindow   = time.Minute
+	defaultStallTimeout    = 5 * time.Minute
+)
+
+// thresholds is the parsed Conf
+type thresholds struct {
+	minSuccessRatio float64
+	minCalls        int
+	successWindow   time.Duration
+	stallTimeout    time.Duration
+}
+
+var (
+	l           sync.Mutex
+	connections = make(map[string]*Connection)
+	limits      = thresholds{defaultMinSuccessRatio, defaultMinCalls, defaultSuccessWindow, defaultStallTimeout}
+	now         = time.Now
+)
+
+// Start sets the thresholds of every connection from conf
+func Start(conf Conf) {
+	t := thresholds{defaultMinSuccessRatio, defaultMinCalls, defaultSuccessWindow, defaultStallTimeout}
+	if conf.MinSuccessRatio != nil {
+		t.minSuccessRatio = *conf.MinSuccessRatio
+	}
+	if conf.MinCalls > 0 {
+		t.minCalls = conf.MinCalls
+	}
+	t.successWindow = parseDuration("success_window", conf.SuccessWindow, t.successWindow)
+	t.stallTimeout = parseDuration("stall_timeout", conf.StallTimeout, t.stallTimeout)
+
+	l.Lock()
+	limits = t
+	l.Unlock()
+}
+
+func parseDuration(key, value string, fallback time.Duration) time.Duration {
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatal("invalid health " + key + " " + err.Error())
+	}
+	return d
+}
+
+// Connection collects the signals readiness of one connection is made of. A
+// nil *Connection is valid and ignores every signal
+type Connection struct {
+	l      sync.Mutex
+	checks []check
+
+	joined    bool
+	producing bool
+	blocked   time.Time // since when the source waits to push a message, zero if it does not
+
+	// sink calls of the current and the previous window
+	windowStart      time.Time
+	success, failure [2]int
+
+	pending  int
+	progress time.Time // last commit, or when messages became pending
+
+	expectSideline    bool
+	sidelineAvailable bool
+}
+
+// check is a probe registered by a component of the connection
+type check struct {
+	name  string
+	probe func() error
+}
+
+// ForConnection returns the Connection of name, creating it on first use
+func ForConnection(name string) *Connection {
+	l.Lock()
+	defer l.Unlock()
+	c, ok := connections[name]
+	if !ok {
+		c = &Connection{windowStart: now()}
+		connections[name] = c
+	}
+	return c
+}
+
+// AddCheck registers a probe evaluated on every readiness request, the
+// connection is not ready while probe returns an error
+func (c *Connection) AddCheck(name string, probe func() error) {
+	if c == nil {
+		return
+	}
+	c.l.Lock()
+	c.checks = append(c.checks, check{name, probe})
+	c.l.Unlock()
+}
+
+// Joined records whether the source is part of its consumer group or
+// subscription
+func (c *Connection) Joined(joined bool) {
+	if c == nil {
+		return
+	}
+	c.l.Lock()
+	c.joined = joined
+	c.l.Unlock()
+}
+
+// Producing records whether the source is reading messages
+func (c *Connection) Producing(producing bool) {
+	if c == nil {
+		return
+	}
+	c.l.Lock()
+	c.producing = producing
+	c.l.Unlock()
+}
+
+// Push records that the source starts to push a message into dmux
+func (c *Connection) Push() {
+	if c == nil {
+		return
+	}
+	c.l.Lock()
+	c.blocked = now()
+	c.l.Unlock()
+}
+
+// Pushed records that the message of the last Push was taken by dmux
+func (c *Connection) Pushed() {
+	if c == nil {
+		return
+	}
+	c.l.Lock()
+	c.blocked = time.Time{}
+	c.l.Unlock()
+}
+
+// SinkCall records the outcome of one call of the sink
+func (c *Connection) SinkCall(success bool) {
+	if c == nil {
+		return
+	}
+	c.l.Lock()
+	c.rotate(now())
+	if success {
+		c.success[0]++
+	} else {
+		c.failure[0]++
+	}
+	c.l.Unlock()
+}
+
+// rotate moves to a new window once the current one is over
+func (c *Connection) rotate(at time.Time) {
+	window := currentLimits().successWindow
+	elapsed := at.Sub(c.windowStart)
+	if elapsed < window {
+		return
+	}
+	if elapsed < 2*window {
+		c.success[1], c.failure[1] = c.success[0], c.failure[0]
+		c.windowStart = c.windowStart.Add(window)
+	} else {
+		c.success[1], c.failure[1] = 0, 0
+		c.windowStart = at
+	}
+	c.success[0], c.failure[0] = 0, 0
+}
+
+// Tracked records a message waiting for its offset to be committed
+func (c *Connection) Tracked() {
+	if c == nil {
+		return
+	}
+	c.l.Lock()
+	if c.pending == 0 {
+		c.progress = now()
+	}
+	c.pending++
+	c.l.Unlock()
+}
+
+// Committed records the commit of a tracked message
+func (c *Connection) Committed() {
+	if c == nil {
+		return
+	}
+	c.l.Lock()
+	if c.pending > 0 {
+		c.pending--
+	}
+	c.progress = now()
+	c.l.Unlock()
+}
+
+// ExpectSideline makes the connection wait for its sideline plugin to be
+// initialised before it is ready
+func (c *Connection) ExpectSideline() {
+	if c == nil {
+		return
+	}
+	c.l.Lock()
+	c.expectSideline = true
+	c.l.Unlock()
+}
+
+// SidelineInitialised records that the sideline plugin is initialised
+func (c *Connection) SidelineInitialised() {
+	if c == nil {
+		return
+	}
+	c.l.Lock()
+	c.sidelineAvailable = true
+	c.l.Unlock()
+}
+
+// Status is the readiness of a connection, Reasons explains why it is not
+// ready
+type Status struct {
+	Ready   bool     `json:"ready"`
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// status evaluates the readiness of c
+func (c *Connection) status() Status {
+	limits := currentLimits()
+	at := now()
+
+	c.l.Lock()
+	var reasons []string
+	if !c.joined {
+		reasons = append(reasons, "source has not joined its consumer group")
+	}
+	if !c.producing {
+		reasons = append(reasons, "source is not producing")
+	} else if blocked := at.Sub(c.blocked); !c.blocked.IsZero() && blocked > limits.stallTimeout {
+		reasons = append(reasons, fmt.Sprintf("source is blocked pushing into dmux for %s", blocked.Truncate(time.Second)))
+	}
+	c.rotate(at)
+	success, failure := c.success[0]+c.success[1], c.failure[0]+c.failure[1]
+	if calls := success + failure; calls >= limits.minCalls {
+		if ratio := float64(success) / float64(calls); ratio < limits.minSuccessRatio {
+			reasons = append(reasons, fmt.Sprintf("sink success ratio %.2f of %d calls is below %.2f", ratio, calls, limits.minSuccessRatio))
+		}
+	}
+	if stalled := at.Sub(c.progress); c.pending > 0 && stalled > limits.stallTimeout {
+		reasons = append(reasons, fmt.Sprintf("offset commits did not advance for %s with %d messages pending", stalled.Truncate(time.Second), c.pending))
+	}
+	if c.expectSideline && !c.sidelineAvailable {
+		reasons = append(reasons, "sideline plugin is not initialised")
+	}
+	checks := c.checks
+	c.l.Unlock()
+
+	for _, check := range checks {
+		if err := check.probe(); err != nil {
+			reasons = append(reasons, check.name+": "+err.Error())
+		}
+	}
+	return Status{Ready: len(reasons) == 0, Reasons: reasons}
+}
+
+func currentLimits() thresholds {
+	l.Lock()
+	defer l.Unlock()
+	return limits
+}
+
+// Ready evaluates the readiness of every connection, ready is true if all of
+// them are ready
+func Ready() (ready bool, statuses map[string]Status) {
+	l.Lock()
+	all := make(map[string]*Connection, len(connections))
+	for name, c := range connections {
+		all[name] = c
+	}
+	l.Unlock()
+
+	ready = true
+	statuses = make(map[string]Status, len(all))
+	for name, c := range all {
+		status := c.status()
+		ready = ready && status.Ready
+		statuses[name] = status
+	}
+	return ready, statuses
+}
@@ -0,0 +1,108 @@
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnectionStatus(t *testing.T) {
+	at := time.Unix(1000, 0)
+	now = func() time.Time { return at }
+	defer func() { now = time.Now }()
+	Start(Conf{SuccessWindow: "10s", StallTimeout: "1m"})
+	defer Start(Conf{})
+
+	c := &Connection{windowStart: at}
+	c.ExpectSideline()
+	assert.Equal(t, []string{
+		"source has not joined its consumer group",
+		"source is not producing",
+		"sideline plugin is not initialised",
+	}, c.status().Reasons)
+
+	c.Joined(true)
+	c.Producing(true)
+	c.SidelineInitialised()
+	assert.Equal(t, Status{Ready: true}, c.status())
+
+	// below min_calls the ratio is not checked
+	for i := 0; i < 9; i++ {
+		c.SinkCall(false)
+	}
+	assert.True(t, c.status().Ready)
+	c.SinkCall(true)
+	assert.Equal(t, []string{"sink success ratio 0.10 of 10 calls is below 0.50"}, c.status().Reasons)
+
+	// the failures age out after two windows
+	at = at.Add(15 * time.Second)
+	assert.False(t, c.status().Ready)
+	at = at.Add(10 * time.Second)
+	assert.True(t, c.status().Ready)
+
+	c.Tracked()
+	c.Tracked()
+	c.Push()
+	at = at.Add(2 * time.Minute)
+	assert.Equal(t, []string{
+		"source is blocked pushing into dmux for 2m0s",
+		"offset commits did not advance for 2m0s with 2 messages pending",
+	}, c.status().Reasons)
+
+	c.Pushed()
+	c.Committed()
+	assert.True(t, c.status().Ready)
+	at = at.Add(2 * time.Minute)
+	assert.False(t, c.status().Ready)
+	c.Committed()
+	assert.True(t, c.status().Ready)
+
+	probe := errors.New("closed")
+	c.AddCheck("consumer group", func() error { return probe })
+	assert.Equal(t, []string{"consumer group: closed"}, c.status().Reasons)
+	probe = nil
+	assert.True(t, c.status().Ready)
+
+	var disabled *Connection
+	disabled.SinkCall(false)
+	disabled.Tracked()
+}
+
+func TestReadyHandler(t *testing.T) {
+	defer func() {
+		l.Lock()
+		connections = make(map[string]*Connection)
+		l.Unlock()
+	}()
+
+	orders := ForConnection("orders")
+	orders.Joined(true)
+	orders.Producing(true)
+	assert.Same(t, orders, ForConnection("orders"))
+	ForConnection("payments").Joined(true)
+
+	recorder := httptest.NewRecorder()
+	ReadyHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/health/ready", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	var body readyBody
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+	assert.Equal(t, readyBody{Connections: map[string]Status{
+		"orders":   {Ready: true},
+		"payments": {Reasons: []string{"source is not producing"}},
+	}}, body)
+
+	ForConnection("payments").Producing(true)
+	recorder = httptest.NewRecorder()
+	ReadyHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/health/ready", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	LiveHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/health/live", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `{"live": true}`, recorder.Body.String())
+}
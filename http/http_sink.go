@@ -12,7 +12,14 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/flipkart-incubator/go-dmux/alerting"
+	"github.com/flipkart-incubator/go-dmux/autoscale"
 	core "github.com/flipkart-incubator/go-dmux/core"
+	"github.com/flipkart-incubator/go-dmux/health"
+	"github.com/flipkart-incubator/go-dmux/metrics"
+	"github.com/flipkart-incubator/go-dmux/plugin"
+	"github.com/flipkart-incubator/go-dmux/tracing"
+	"github.com/flipkart-incubator/go-dmux/transform"
 )
 
 // HTTPSink is Sink implementation which writes to HttpEndpoint
@@ -20,6 +27,12 @@ type HTTPSink struct {
 	client *http.Client
 	hook   HTTPSinkHook
 	conf   HTTPSinkConf
+
+	connection string                // name of the connection the metrics of the sink are labeled with
+	health     *health.Connection    // readiness signals of the connection, nil if not reported
+	alerts     *alerting.Connection  // alert signals of the connection, nil if not reported
+	scaling    *autoscale.Connection // autoscale signals of the connection, nil if not reported
+	transform  *transform.Pipeline   // reshapes payloads before they are posted, nil to post them as they are
 }
 
 // HTTPSinkConf  holds config to HTTPSink
@@ -30,6 +43,8 @@ type HTTPSinkConf struct {
 	Headers                     []map[string]string `json:"headers"`
 	Method                      string              `json:"method"`                    //GET,POST,PUT,DELETE
 	NonRetriableHttpStatusCodes []int               `json:nonRetriableHttpStatusCodes` //this is for handling customized errorCode thrown by sink
+	RecordHeaders               RecordHeadersConf   `json:"record_headers"`            //forwarding of source record headers
+	Transform                   transform.Conf      `json:"transform"`                 //reshaping of payloads before they are posted
 
 }
 
@@ -74,6 +89,9 @@ func getClientTimeout(conf HTTPSinkConf) time.Duration {
 
 // GetHTTPSink method is public method used to create Instance of HTTPSink
 func GetHTTPSink(size int, conf HTTPSinkConf) *HTTPSink {
+	if err := conf.RecordHeaders.validate(); err != nil {
+		panic(err)
+	}
 
 	client := &http.Client{
 		Transport: getHTTPClientTransport(size, conf),
@@ -81,8 +99,9 @@ func GetHTTPSink(size int, conf HTTPSinkConf) *HTTPSink {
 	}
 
 	sink := &HTTPSink{
-		client: client,
-		conf:   conf,
+		client:    client,
+		conf:      conf,
+		transform: transform.GetPipeline(conf.Transform),
 	}
 
 	return sink
@@ -92,6 +111,32 @@ func (h *HTTPSink) RegisterHook(hook HTTPSinkHook) {
 	h.hook = hook
 }
 
+// SetPlugin makes the sink transform payloads with the transform function of
+// p before the transform steps, p may be nil
+func (h *HTTPSink) SetPlugin(p *plugin.Plugin) {
+	if p != nil {
+		h.transform = h.transform.WithPlugin(p)
+	}
+}
+
+// SetConnection names the connection the sink metrics are labeled with and
+// reports the outcome of its calls to the readiness and alerts of that
+// connection
+func (h *HTTPSink) SetConnection(name string) {
+	h.connection = name
+	h.health = health.ForConnection(name)
+	h.alerts = alerting.ForConnection(name)
+	h.scaling = autoscale.ForConnection(name)
+}
+
+// SetBranch makes the sink the sink of the fan-out branch of its connection,
+// named as Branch.Connection returns it. Its metrics and autoscale signals are
+// those of the branch, health and alerts stay with the connection
+func (h *HTTPSink) SetBranch(branch string) {
+	h.connection = branch
+	h.scaling = autoscale.ForConnection(branch)
+}
+
 // HTTPMsg is an interface which incoming data should implment for HttpSink to
 // work
 type HTTPMsg interface {
@@ -115,21 +160,42 @@ func (h *HTTPSink) Clone() core.Sink {
 // BatchConsume is implementation of Sink interface Consume.
 func (h *HTTPSink) BatchConsume(msgs []interface{}, version int) {
 	// log.Println(msgs)
+	// batches are neither sidelined nor parked, a message that can't be
+	// transformed holds the batch back
+	for _, msg := range msgs {
+		h.retryTransform(msg, math.MaxInt32)
+	}
 	batchHelper := msgs[0].(HTTPMsg) // empty refrence to help call static methods
 	// data := msg.(HTTPMsg)
 
 	url := batchHelper.BatchURL(msgs, h.conf.Endpoint, version)
-	payload := batchHelper.BatchPayload(msgs, version)
 	headers := batchHelper.GetHeaders(h.conf)
+	payloads := make([][]byte, len(msgs))
+	for i, msg := range msgs {
+		payloads[i] = msg.(HTTPMsg).GetPayload()
+	}
+	payload, contentType, ok := h.transform.Batch(payloads)
+	if !ok {
+		payload, contentType = batchHelper.BatchPayload(msgs, version), h.transform.ContentType()
+	}
+	if contentType != "" {
+		headers["Content-Type"] = contentType
+	}
 
+	//the batch is a span of its own, linked to the trace of every message
+	span := tracing.StartSpan("dmux.batch", tracing.SpanContext{}, tracing.Int("dmux.batch.size", int64(len(msgs))))
 	//TODO introduce batchHookMethods
 	for _, msg := range msgs {
+		trace := tracing.TraceOf(msg)
+		trace.Dequeued()
+		span.AddLink(trace.Span().Context())
 		//retry Pre till you succede infinitely
 		h.retryPre(msg, url)
 	}
 	var respCodes []int
 	//retry Execute till you succede based on retry config
-	status, err := h.retryExecute(h.conf.Method, url, headers, payload, responseCodeEvaluation, math.MaxInt32, respCodes)
+	status, err := h.retryExecute(h.conf.Method, url, headers, payload, responseCodeEvaluation, math.MaxInt32, respCodes, false, span)
+	span.End()
 
 	if !status && err != nil {
 		log.Fatal("Error in executing " + err.Error())
@@ -138,30 +204,74 @@ func (h *HTTPSink) BatchConsume(msgs []interface{}, version int) {
 	for _, msg := range msgs {
 		//retry Post till you succede infinitely
 		h.retryPost(msg, status, url)
+		tracing.TraceOf(msg).Processed()
 	}
 
 }
 
+// retryTransform applies the transform of the sink to msg. A message that
+// can't be transformed fails like a sink call that is not retried: with
+// bounded retries, of sideline or parking, it returns false at once, else the
+// transform is retried as the message must not be left out
+func (h *HTTPSink) retryTransform(msg interface{}, retries int) bool {
+	for {
+		ok, err := h.transform.Transform(msg)
+		if err != nil {
+			log.Printf("failed to transform %s %s \n", msg.(HTTPMsg).GetDebugPath(), err.Error())
+			h.ingestMetric(metrics.TransformErrors, "", 1)
+		}
+		if ok {
+			return true
+		}
+		if retries != math.MaxInt32 {
+			return false
+		}
+		time.Sleep(h.conf.RetryInterval.Duration)
+	}
+}
+
 // Consume is implementation for Single message Consumption.
 // This infinitely retries pre and post hooks, but finetly retries HTTPCall
 // for status. status == true is determined by responseCode 2xx
 func (h *HTTPSink) Consume(msg interface{}, retries int, sidelineResponseCodes []int) error {
+	return h.consume(msg, retries, sidelineResponseCodes, false)
+}
+
+// Park implements core.ParkingSink, calls without response count toward
+// retries too so a key whose calls time out is parked
+func (h *HTTPSink) Park(msg interface{}, retries int) error {
+	return h.consume(msg, retries, nil, true)
+}
 
+// consume posts msg, noResponse tells if calls without response count
+// toward retries
+func (h *HTTPSink) consume(msg interface{}, retries int, sidelineResponseCodes []int, noResponse bool) error {
+	if !h.retryTransform(msg, retries) {
+		return errors.New(core.SidelineMessage)
+	}
 	data := msg.(HTTPMsg)
 	url := data.GetURL(h.conf.Endpoint)
 	// method := data.GetMethod(h.conf)
 	payload := data.GetPayload()
 	headers := data.GetHeaders(h.conf)
+	if contentType := h.transform.ContentType(); contentType != "" {
+		headers["Content-Type"] = contentType
+	}
+	h.conf.RecordHeaders.apply(msg, headers)
+	trace := tracing.TraceOf(msg)
+	trace.Dequeued()
 	//retry Pre till you succede infinitely
 	h.retryPre(msg, url)
 
 	//retry Execute till you succede based on retry config
-	status, err := h.retryExecute(h.conf.Method, url, headers, payload, responseCodeEvaluation, retries, sidelineResponseCodes)
+	status, err := h.retryExecute(h.conf.Method, url, headers, payload, responseCodeEvaluation, retries, sidelineResponseCodes, noResponse, trace.Span())
 	if !status && err != nil {
+		trace.Span().SetError(err.Error())
 		return err
 	}
 	//retry Post till you succede infinitely
 	h.retryPost(msg, status, url)
+	trace.Processed()
 	return nil
 }
 
@@ -192,13 +302,16 @@ func (h *HTTPSink) retryPost(msg interface{}, state bool,
 
 func (h *HTTPSink) retryExecute(method, url string, headers map[string]string,
 	data []byte, respEval func(respCode int, nonRetriableHttpStatusCodes []int) (error, bool),
-	retries int, sidelineResponseCodes []int) (bool, error) {
+	retries int, sidelineResponseCodes []int, noResponse bool, parent *tracing.Span) (bool, error) {
 	var count = 0
 	for {
-		status, respCode := h.execute(method, url, headers, bytes.NewReader(data))
+		status, respCode := h.execute(method, url, headers, bytes.NewReader(data), parent)
 		if status {
 			nonRetriableHttpStatusCodes := h.conf.NonRetriableHttpStatusCodes
 			err, outcome := respEval(respCode, nonRetriableHttpStatusCodes)
+			h.health.SinkCall(err == nil)
+			h.alerts.SinkCall(err == nil)
+			h.scaling.SinkCall(err == nil)
 			if err == nil {
 				return outcome, nil
 			}
@@ -206,8 +319,20 @@ func (h *HTTPSink) retryExecute(method, url string, headers map[string]string,
 			if core.Contains(sidelineResponseCodes, respCode) || (retries != 0 && retries != math.MaxInt32 && count > retries) {
 				return outcome, errors.New(core.SidelineMessage)
 			}
+		} else {
+			h.health.SinkCall(false)
+			h.alerts.SinkCall(false)
+			h.scaling.SinkCall(false)
+			//calls without response, e.g. timeouts or refused connections, count only toward the retries of parking
+			if noResponse {
+				count = count + 1
+				if retries != 0 && retries != math.MaxInt32 && count > retries {
+					return false, errors.New(core.SidelineMessage)
+				}
+			}
 		}
 		log.Printf("retry in execute %s \t %s \n", method, url)
+		h.ingestMetric(metrics.HTTPRetries, "", 1)
 		time.Sleep(h.conf.RetryInterval.Duration)
 	}
 
@@ -241,8 +366,13 @@ func (h *HTTPSink) post(hook HTTPSinkHook, msg interface{}, status bool, url str
 	return true
 }
 
+// execute makes one attempt of the http call, traced as a child of parent
 func (h *HTTPSink) execute(method, url string, headers map[string]string,
-	payload io.Reader) (bool, int) {
+	payload io.Reader, parent *tracing.Span) (bool, int) {
+	attempt := parent.Child("HTTP "+method, tracing.String("http.method", method), tracing.String("http.url", url))
+	attempt.SetKind(tracing.KindClient)
+	defer attempt.End()
+
 	//Never fail always recover
 	defer func() {
 		if r := recover(); r != nil {
@@ -254,6 +384,7 @@ func (h *HTTPSink) execute(method, url string, headers map[string]string,
 	request, err := http.NewRequest(method, url, payload)
 	if err != nil {
 		log.Printf("failed in request build %s %s \n", url, err.Error())
+		attempt.SetError(err.Error())
 		return false, 0
 	}
 
@@ -261,17 +392,32 @@ func (h *HTTPSink) execute(method, url string, headers map[string]string,
 	for key, val := range headers {
 		request.Header.Set(key, val)
 	}
+	//propagate the trace, overriding a forwarded traceparent record header
+	if c := attempt.Context(); c.IsValid() {
+		request.Header.Set(tracing.Header, c.Traceparent())
+	}
 
 	// if method != "GET" && !h.conf.CustomURL {
 	// 	request.Header.Set("Content-Type", "application/octet-stream")
 	// }
 
 	//make request
+	start := time.Now()
 	response, err := h.client.Do(request)
+	took := time.Since(start)
+	h.ingestMetric(metrics.HTTPRequestDuration, "", int64(took))
+	h.scaling.Latency(took)
 	if err != nil {
 		log.Printf("failed in http call invoke %s %s \n", url, err.Error())
+		h.ingestMetric(metrics.HTTPResponses, "error", 1)
+		attempt.SetError(err.Error())
 		return false, 0
 	}
+	h.ingestMetric(metrics.HTTPResponses, strconv.Itoa(response.StatusCode), 1)
+	attempt.SetAttributes(tracing.Int("http.status_code", int64(response.StatusCode)))
+	if response.StatusCode >= 300 {
+		attempt.SetError(strconv.Itoa(response.StatusCode))
+	}
 	//TODO check if this can be avoided
 	io.Copy(ioutil.Discard, response.Body)
 	defer response.Body.Close()
@@ -279,6 +425,14 @@ func (h *HTTPSink) execute(method, url string, headers map[string]string,
 	return true, response.StatusCode
 }
 
+func (h *HTTPSink) ingestMetric(metricType metrics.MetricType, code string, value int64) {
+	metrics.Ingest(metrics.Metric{
+		Type:   metricType,
+		Value:  value,
+		Labels: metrics.Labels{Connection: h.connection, Code: code},
+	})
+}
+
 func responseCodeEvaluation(respCode int, nonRetriableHttpStatusCodes []int) (error, bool) {
 	if (respCode < 300) || core.Contains(nonRetriableHttpStatusCodes, respCode) { //2xx or ay http status defined in nonRetriableHttpStatusCodes status implies sucess
 		return nil, true
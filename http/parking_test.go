@@ -0,0 +1,112 @@
+package http
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/flipkart-incubator/go-dmux/core"
+	"github.com/stretchr/testify/assert"
+)
+
+// keySource generates messages "key-n" keyed by key
+type keySource struct {
+	values []string
+}
+
+func (s *keySource) Generate(out chan<- interface{}) {
+	for _, value := range s.values {
+		out <- &transformMsg{value: value}
+	}
+}
+
+func (s *keySource) Stop() {}
+
+func (s *keySource) GetKey(msg interface{}) []byte {
+	return []byte(strings.Split(msg.(*transformMsg).value, "-")[0])
+}
+
+func (s *keySource) GetPartition(msg interface{}) int32 { return 0 }
+func (s *keySource) GetValue(msg interface{}) []byte    { return []byte(msg.(*transformMsg).value) }
+func (s *keySource) GetOffset(msg interface{}) int64    { return 0 }
+
+type firstWorker struct{}
+
+func (firstWorker) Distribute(data interface{}, size int) int { return 0 }
+
+func TestParkingTransportFailure(t *testing.T) {
+	var l sync.Mutex
+	var delivered []string
+	// calls of the bad key fail without a response
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if strings.HasPrefix(string(body), "bad") {
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		l.Lock()
+		delivered = append(delivered, string(body))
+		l.Unlock()
+	}))
+	t.Cleanup(server.Close)
+
+	sk := GetHTTPSink(1, HTTPSinkConf{
+		Endpoint:      server.URL,
+		Method:        "POST",
+		Timeout:       core.Duration{Duration: time.Second},
+		RetryInterval: core.Duration{Duration: time.Millisecond},
+	})
+	d := core.GetDmux(core.DmuxConf{Size: 1, Parking: core.ParkingConf{Enabled: true, Retries: 2, MinBackoff: "1h"}}, firstWorker{})
+	src := &keySource{values: []string{"bad-1", "good-1", "bad-2", "good-2"}}
+	d.ConnectWithSideline(src, sk, nil, core.DmuxOptionalParams{Connection: "orders"})
+
+	// the bad key is parked and the good key flows past it
+	assert.Eventually(t, func() bool {
+		l.Lock()
+		defer l.Unlock()
+		return len(delivered) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"good-1", "good-2"}, delivered)
+}
+
+func TestConsumeTransportFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Close()
+	sk := GetHTTPSink(1, HTTPSinkConf{
+		Endpoint:      server.URL,
+		Method:        "POST",
+		Timeout:       core.Duration{Duration: time.Second},
+		RetryInterval: core.Duration{Duration: time.Millisecond},
+	})
+	// the retries of parking end for calls that never get a response
+	err := sk.Park(&transformMsg{value: "v"}, 2)
+	assert.EqualError(t, err, core.SidelineMessage)
+}
+
+func TestConsumeRetriesTransportFailure(t *testing.T) {
+	var calls int32
+	// the first calls fail without a response
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= 5 {
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+		}
+	}))
+	t.Cleanup(server.Close)
+	sk := GetHTTPSink(1, HTTPSinkConf{
+		Endpoint:      server.URL,
+		Method:        "POST",
+		Timeout:       core.Duration{Duration: time.Second},
+		RetryInterval: core.Duration{Duration: time.Millisecond},
+	})
+	// the retries of sideline only count calls with a response, an outage
+	// holds messages back instead of sidelining them
+	assert.NoError(t, sk.Consume(&transformMsg{value: "v"}, 2, nil))
+	assert.Equal(t, int32(6), atomic.LoadInt32(&calls))
+}
@@ -0,0 +1,72 @@
+package http
+
+import (
+	"fmt"
+)
+
+// RecordHeadersConf holds config to forward the headers and metadata of the
+// source record behind a message, such as a kafka record, as http headers.
+// It applies to single message calls, batch version 3 carries every record
+// header in the payload instead.
+type RecordHeadersConf struct {
+	Mode      string   `json:"mode"`       // none (default), all or allow_list
+	AllowList []string `json:"allow_list"` // record headers forwarded in allow_list mode
+	Prefix    string   `json:"prefix"`     // prepended to the name of forwarded record headers
+	Metadata  bool     `json:"metadata"`   // forwards topic, partition, offset, key and timestamp of the record
+}
+
+const (
+	// RecordHeadersNone forwards no record header
+	RecordHeadersNone = "none"
+	// RecordHeadersAll forwards every record header
+	RecordHeadersAll = "all"
+	// RecordHeadersAllowList forwards the record headers of AllowList
+	RecordHeadersAllowList = "allow_list"
+)
+
+// RecordMsg is implemented by HTTPMsg whose source record has headers and
+// metadata which can be forwarded as http headers
+type RecordMsg interface {
+	// GetRecordHeaders returns the headers of the source record
+	GetRecordHeaders() map[string]string
+	// GetRecordMetadata returns http headers describing the source record
+	GetRecordMetadata() map[string]string
+}
+
+func (c RecordHeadersConf) validate() error {
+	switch c.Mode {
+	case "", RecordHeadersNone, RecordHeadersAll, RecordHeadersAllowList:
+		return nil
+	default:
+		return fmt.Errorf("invalid record_headers mode %s", c.Mode)
+	}
+}
+
+// apply adds the record headers and metadata of msg to headers. Record headers
+// take precedence over static headers of the same name.
+func (c RecordHeadersConf) apply(msg interface{}, headers map[string]string) {
+	record, ok := msg.(RecordMsg)
+	if !ok {
+		return
+	}
+
+	switch c.Mode {
+	case RecordHeadersAll:
+		for name, value := range record.GetRecordHeaders() {
+			headers[c.Prefix+name] = value
+		}
+	case RecordHeadersAllowList:
+		recordHeaders := record.GetRecordHeaders()
+		for _, name := range c.AllowList {
+			if value, ok := recordHeaders[name]; ok {
+				headers[c.Prefix+name] = value
+			}
+		}
+	}
+
+	if c.Metadata {
+		for name, value := range record.GetRecordMetadata() {
+			headers[name] = value
+		}
+	}
+}
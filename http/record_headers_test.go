@@ -0,0 +1,44 @@
+package http
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordMsg struct{}
+
+func (recordMsg) GetRecordHeaders() map[string]string {
+	return map[string]string{"trace-id": "abc", "tenant": "t1", "Content-Type": "application/json"}
+}
+
+func (recordMsg) GetRecordMetadata() map[string]string {
+	return map[string]string{"X-Kafka-Offset": "42"}
+}
+
+func TestRecordHeadersApply(t *testing.T) {
+	headers := map[string]string{"Content-Type": "application/octet-stream"}
+	RecordHeadersConf{}.apply(recordMsg{}, headers)
+	assert.Equal(t, map[string]string{"Content-Type": "application/octet-stream"}, headers)
+
+	headers = map[string]string{"Content-Type": "application/octet-stream"}
+	RecordHeadersConf{Mode: RecordHeadersAll}.apply(recordMsg{}, headers)
+	assert.Equal(t, "abc", headers["trace-id"])
+	assert.Equal(t, "t1", headers["tenant"])
+	assert.Equal(t, "application/json", headers["Content-Type"])
+
+	headers = map[string]string{}
+	conf := RecordHeadersConf{Mode: RecordHeadersAllowList, AllowList: []string{"trace-id", "missing"}, Prefix: "X-Record-", Metadata: true}
+	conf.apply(recordMsg{}, headers)
+	assert.Equal(t, map[string]string{"X-Record-trace-id": "abc", "X-Kafka-Offset": "42"}, headers)
+
+	headers = map[string]string{}
+	RecordHeadersConf{Mode: RecordHeadersAll}.apply("not a record", headers)
+	assert.Empty(t, headers)
+}
+
+func TestRecordHeadersValidate(t *testing.T) {
+	assert.Nil(t, RecordHeadersConf{}.validate())
+	assert.Nil(t, RecordHeadersConf{Mode: RecordHeadersAllowList}.validate())
+	assert.NotNil(t, RecordHeadersConf{Mode: "some"}.validate())
+}
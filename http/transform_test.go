@@ -0,0 +1,160 @@
+package http
+
+import (
+	"errors"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flipkart-incubator/go-dmux/core"
+	"github.com/flipkart-incubator/go-dmux/transform"
+	"github.com/stretchr/testify/assert"
+)
+
+type transformMsg struct {
+	value   string
+	payload []byte
+}
+
+func (m *transformMsg) GetPayload() []byte {
+	if m.payload != nil {
+		return m.payload
+	}
+	return []byte(m.value)
+}
+
+func (m *transformMsg) GetDebugPath() string {
+	return "/orders/0/" + m.value
+}
+
+func (m *transformMsg) GetURL(endpoint string) string {
+	return endpoint + "/orders"
+}
+
+func (m *transformMsg) GetHeaders(conf HTTPSinkConf) map[string]string {
+	return map[string]string{"Content-Type": "application/octet-stream"}
+}
+
+func (m *transformMsg) BatchURL(msgs []interface{}, endpoint string, version int) string {
+	return endpoint + "/bulk"
+}
+
+func (m *transformMsg) BatchPayload(msgs []interface{}, version int) []byte {
+	var payloads []string
+	for _, msg := range msgs {
+		payloads = append(payloads, string(msg.(HTTPMsg).GetPayload()))
+	}
+	return []byte(strings.Join(payloads, "|"))
+}
+
+func (m *transformMsg) GetTransformRecord() transform.Record {
+	return transform.Record{Topic: "orders", Key: []byte("k"), Value: []byte(m.value)}
+}
+
+func (m *transformMsg) SetPayload(payload []byte) {
+	m.payload = payload
+}
+
+type doneHook map[interface{}]bool
+
+func (h doneHook) PreHTTPCall(msg interface{}) {}
+
+func (h doneHook) PostHTTPCall(msg interface{}, success bool) {
+	h[msg] = success
+}
+
+type request struct {
+	path, contentType, body string
+}
+
+func transformSink(t *testing.T, conf transform.Conf) (*HTTPSink, doneHook, chan request) {
+	requests := make(chan request, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests <- request{r.URL.Path, r.Header.Get("Content-Type"), string(body)}
+	}))
+	t.Cleanup(server.Close)
+	sk := GetHTTPSink(1, HTTPSinkConf{
+		Endpoint:      server.URL,
+		Method:        "POST",
+		Timeout:       core.Duration{Duration: time.Second},
+		RetryInterval: core.Duration{Duration: time.Millisecond},
+		Transform:     conf,
+	})
+	hook := doneHook{}
+	sk.RegisterHook(hook)
+	return sk, hook, requests
+}
+
+func TestTransformConsume(t *testing.T) {
+	sk, hook, requests := transformSink(t, transform.Conf{
+		Steps:       []transform.Step{{Type: transform.Envelope, Metadata: []string{"key"}}},
+		ContentType: "application/json",
+	})
+	msg := &transformMsg{value: `{"id":1}`}
+	assert.NoError(t, sk.Consume(msg, 0, nil))
+	r := <-requests
+	assert.Equal(t, "/orders", r.path)
+	assert.Equal(t, "application/json", r.contentType)
+	assert.JSONEq(t, `{"key":"k","value":{"id":1}}`, r.body)
+	assert.True(t, hook[msg])
+
+	// a message that can't be transformed is sidelined or parked, never
+	// acknowledged
+	sk, hook, requests = transformSink(t, transform.Conf{Steps: []transform.Step{{Type: transform.Project, Fields: []string{"id"}}}})
+	msg = &transformMsg{value: `not json`}
+	assert.EqualError(t, sk.Consume(msg, 0, nil), core.SidelineMessage)
+	assert.EqualError(t, sk.Consume(msg, 3, nil), core.SidelineMessage)
+	assert.NotContains(t, hook, msg)
+	assert.Len(t, requests, 0)
+
+	// and retried without either
+	sk, hook, requests = transformSink(t, transform.Conf{})
+	sk.transform = sk.transform.WithPlugin(&flakyTransformer{failures: 3})
+	msg = &transformMsg{value: `{"id":1}`}
+	assert.NoError(t, sk.Consume(msg, math.MaxInt32, nil))
+	assert.Equal(t, `{"id":1}`, (<-requests).body)
+	assert.True(t, hook[msg])
+}
+
+// flakyTransformer fails its first calls
+type flakyTransformer struct {
+	failures int
+}
+
+func (f *flakyTransformer) Transform(r transform.Record) ([]byte, error) {
+	if f.failures > 0 {
+		f.failures--
+		return nil, errors.New("not yet")
+	}
+	return r.Value, nil
+}
+
+func TestTransformBatchConsume(t *testing.T) {
+	project := []transform.Step{{Type: transform.Project, Fields: []string{"id"}}}
+	sk, hook, requests := transformSink(t, transform.Conf{Steps: project})
+	msgs := []interface{}{&transformMsg{value: `{"id":1,"a":1}`}, &transformMsg{value: `{"id":2,"a":2}`}}
+	sk.BatchConsume(msgs, 1)
+	r := <-requests
+	assert.Equal(t, "/bulk", r.path)
+	assert.Equal(t, `{"id":1}|{"id":2}`, r.body)
+	assert.Len(t, hook, 2)
+
+	sk, _, requests = transformSink(t, transform.Conf{Steps: project, Batch: transform.NDJSON})
+	sk.BatchConsume([]interface{}{&transformMsg{value: `{"id":1,"a":1}`}, &transformMsg{value: `{"id":2}`}}, 1)
+	r = <-requests
+	assert.Equal(t, "application/x-ndjson", r.contentType)
+	assert.Equal(t, "{\"id\":1}\n{\"id\":2}\n", r.body)
+
+	// a message that can't be transformed holds back the batch, it is not
+	// left out
+	sk, hook, requests = transformSink(t, transform.Conf{Steps: project})
+	sk.transform = sk.transform.WithPlugin(&flakyTransformer{failures: 2})
+	sk.BatchConsume([]interface{}{&transformMsg{value: `{"id":1}`}, &transformMsg{value: `{"id":2}`}}, 1)
+	assert.Equal(t, `{"id":1}|{"id":2}`, (<-requests).body)
+	assert.Len(t, hook, 2)
+}
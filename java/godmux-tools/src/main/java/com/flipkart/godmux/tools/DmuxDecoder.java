@@ -7,7 +7,9 @@ import org.slf4j.LoggerFactory;
 
 import java.nio.ByteBuffer;
 import java.util.ArrayList;
+import java.util.LinkedHashMap;
 import java.util.List;
+import java.util.Map;
 
 public class DmuxDecoder {
 
@@ -38,6 +40,39 @@ public class DmuxDecoder {
         return new DmuxRequest(key, zkOffset, data);
     }
 
+    /**
+     * Decodes a single record of a batch version 3 payload, which also carries the record timestamp and headers.
+     */
+    public DmuxRequest decodeV3(byte[] payload) {
+        int len = readInteger(payload);
+        long zkOffset = readLong(payload);
+        long timestamp = readLong(payload);
+        int keySize = readInteger(payload);
+        String key = new String(readByteArray(payload, keySize));
+        int headerCount = readInteger(payload);
+        Map<String, byte[]> headers = new LinkedHashMap<>();
+        for (int i = 0; i < headerCount; i++) {
+            String name = new String(readByteArray(payload, readInteger(payload)));
+            headers.put(name, readByteArray(payload, readInteger(payload)));
+        }
+        byte[] data = readByteArray(payload, len);
+        logger.debug("got individual payload of sizes {}", len);
+        return new DmuxRequest(key, zkOffset, timestamp, headers, data);
+    }
+
+    public BatchRequest batchDecodeV3(byte[] payload) {
+        logger.debug("got payload len = {} ", payload.length);
+        resetOffset();
+        int partition = readInteger(payload);
+        int size = readInteger(payload);
+        logger.debug("got batch size {}", size);
+        List<DmuxRequest> dmuxRequestList = new ArrayList<>();
+        for (int i = 0; i < size; i++) {
+            dmuxRequestList.add(decodeV3(payload));
+        }
+        return new BatchRequest(partition, dmuxRequestList);
+    }
+
     public BatchRequest batchDecode(byte[] payload) {
         logger.debug("got payload len = {} ", payload.length);
         resetOffset();
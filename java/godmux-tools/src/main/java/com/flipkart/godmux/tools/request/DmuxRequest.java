@@ -1,14 +1,25 @@
 package com.flipkart.godmux.tools.request;
 
+import java.util.Collections;
+import java.util.Map;
+
 public class DmuxRequest {
 
     private String key;
     private long offset;
     private byte[] data;
+    private long timestamp;
+    private Map<String, byte[]> headers;
 
     public DmuxRequest(String key, long offset, byte[] data) {
+        this(key, offset, -1, Collections.<String, byte[]>emptyMap(), data);
+    }
+
+    public DmuxRequest(String key, long offset, long timestamp, Map<String, byte[]> headers, byte[] data) {
         this.key = key;
         this.offset = offset;
+        this.timestamp = timestamp;
+        this.headers = headers;
         this.data = data;
     }
 
@@ -23,4 +34,18 @@ public class DmuxRequest {
     public byte[] getData() {
         return data;
     }
+
+    /**
+     * @return record timestamp in epoch millis, -1 if unknown or not sent (batch version < 3)
+     */
+    public long getTimestamp() {
+        return timestamp;
+    }
+
+    /**
+     * @return record headers, empty if not sent (batch version < 3)
+     */
+    public Map<String, byte[]> getHeaders() {
+        return headers;
+    }
 }
@@ -5,11 +5,13 @@ import (
 	"fmt"
 	"github.com/Shopify/sarama"
 	"github.com/flipkart-incubator/go-dmux/metrics"
+	"regexp"
 	"strconv"
 	"sync"
 	"time"
 
 	"github.com/flipkart-incubator/go-dmux/kafka/kazoo-go"
+	"github.com/samuel/go-zookeeper/zk"
 )
 
 var (
@@ -21,11 +23,25 @@ type Config struct {
 
 	Zookeeper *kazoo.Config
 
+	Ephemeral bool // Deletes the consumergroup from Zookeeper on Close, for one-off consumers such as replays.
+
+	Connection string // Name of the dmux connection consuming, to label metrics.
+
+	TopicPattern *regexp.Regexp // Also consumes every topic matching the pattern. Topics created later are picked up with a rebalance, unless Offsets.Bounded is set.
+
 	Offsets struct {
 		Initial           int64         // The initial offset method to use if the consumer has no previously stored offset. Must be either sarama.OffsetOldest (default) or sarama.OffsetNewest.
 		ProcessingTimeout time.Duration // Time to wait for all the offsets for a partition to be processed after stopping to consume from it. Defaults to 1 minute.
 		CommitInterval    time.Duration // The interval between which the processed offsets are commited.
 		ResetOffsets      bool          // Resets the offsets for the consumergroup so that it won't resume from where it left off previously.
+
+		StartTimestamp time.Time                  // Moves the consumergroup to the first offset produced at or after this time when it joins.
+		StartOffsets   map[string]map[int32]int64 // Moves partitions to explicit offsets when the consumergroup joins, by topic. The empty topic applies to every topic. Takes precedence over StartTimestamp.
+		StartMarker    string                     // Identifies the start position above, which is applied only once per consumergroup for a given marker. Derived from the position if empty.
+
+		Bounded       bool                       // Stops every partition at StopOffsets, StopTimestamp or else at its newest offset when joining. Finished is closed once all partitions have stopped.
+		StopTimestamp time.Time                  // Bounded partitions stop at the first offset produced at or after this time.
+		StopOffsets   map[string]map[int32]int64 // Bounded partitions stop at these offsets, exclusive, by topic. The empty topic applies to every topic. Takes precedence over StopTimestamp.
 	}
 }
 
@@ -53,6 +69,14 @@ func (cgc *Config) Validate() error {
 		return errors.New("Offsets.Initial should be sarama.OffsetOldest or sarama.OffsetNewest.")
 	}
 
+	if !cgc.Offsets.StartTimestamp.IsZero() && cgc.Config != nil && !cgc.Version.IsAtLeast(sarama.V0_10_1_0) {
+		return sarama.ConfigurationError("Offsets.StartTimestamp needs Kafka version >= 0.10.1")
+	}
+
+	if !cgc.Offsets.StopTimestamp.IsZero() && cgc.Config != nil && !cgc.Version.IsAtLeast(sarama.V0_10_1_0) {
+		return sarama.ConfigurationError("Offsets.StopTimestamp needs Kafka version >= 0.10.1")
+	}
+
 	if cgc.Config != nil {
 		if err := cgc.Config.Validate(); err != nil {
 			return err
@@ -67,6 +91,7 @@ func (cgc *Config) Validate() error {
 type ConsumerGroup struct {
 	config *Config
 
+	client   sarama.Client
 	consumer sarama.Consumer
 	kazoo    *kazoo.Kazoo
 	group    *kazoo.Consumergroup
@@ -84,6 +109,18 @@ type ConsumerGroup struct {
 	offsetManager OffsetManager
 
 	brokerList []string
+
+	// topics consumed right now, which change with TopicPattern
+	subscription subscription
+	topics       []string
+	topicsLock   sync.RWMutex
+
+	// bounded consumption
+	stopOffsets        map[string]map[int32]int64
+	finishedPartitions map[string]bool
+	pendingPartitions  int
+	finished           chan struct{}
+	finishedLock       sync.Mutex
 }
 
 // Connects to a consumer group, using Zookeeper for auto-discovery
@@ -93,8 +130,8 @@ func JoinConsumerGroup(name string, topics []string, zookeeper []string, config
 		return nil, sarama.ConfigurationError("Empty consumergroup name")
 	}
 
-	if len(topics) == 0 {
-		return nil, sarama.ConfigurationError("No topics provided")
+	if len(topics) == 0 && config.TopicPattern == nil {
+		return nil, sarama.ConfigurationError("No topics or topic pattern provided")
 	}
 
 	if len(zookeeper) == 0 {
@@ -116,12 +153,20 @@ func JoinConsumerGroup(name string, topics []string, zookeeper []string, config
 		return
 	}
 
-	brokers, err := kz.BrokerList(config.Net.SASL.Enable)
+	brokers, err := kz.BrokerList(kazoo.SecurityProtocol(config.Net.SASL.Enable, config.Net.TLS.Enable))
 	if err != nil {
 		kz.Close()
 		return
 	}
 
+	sub := subscription{topics: topics, pattern: config.TopicPattern}
+	if sub.pattern != nil {
+		if topics, _, err = sub.watch(kz); err != nil {
+			kz.Close()
+			return
+		}
+	}
+
 	group := kz.Consumergroup(name)
 
 	if config.Offsets.ResetOffsets {
@@ -132,16 +177,29 @@ func JoinConsumerGroup(name string, topics []string, zookeeper []string, config
 		}
 	}
 
+	if err = applyStartOffsets(kz, group, brokers, topics, config); err != nil {
+		kz.Close()
+		return
+	}
+
 	instance := group.NewInstance()
 
+	var client sarama.Client
+	if client, err = sarama.NewClient(brokers, config.Config); err != nil {
+		kz.Close()
+		return
+	}
+
 	var consumer sarama.Consumer
-	if consumer, err = sarama.NewConsumer(brokers, config.Config); err != nil {
+	if consumer, err = sarama.NewConsumerFromClient(client); err != nil {
+		_ = client.Close()
 		kz.Close()
 		return
 	}
 
 	cg = &ConsumerGroup{
 		config:   config,
+		client:   client,
 		consumer: consumer,
 
 		kazoo:    kz,
@@ -153,12 +211,28 @@ func JoinConsumerGroup(name string, topics []string, zookeeper []string, config
 		stopper:  make(chan struct{}),
 
 		brokerList: brokers,
+
+		subscription: sub,
+		topics:       topics,
+
+		finished: make(chan struct{}),
+	}
+
+	if config.Offsets.Bounded {
+		if err = cg.resolveStopOffsets(topics); err != nil {
+			cg.Logf("FAILED to resolve stop offsets: %s!\n", err)
+			_ = consumer.Close()
+			_ = client.Close()
+			_ = kz.Close()
+			return nil, err
+		}
 	}
 
 	// Register consumer group
 	if exists, err := cg.group.Exists(); err != nil {
 		cg.Logf("FAILED to check for existence of consumergroup: %s!\n", err)
 		_ = consumer.Close()
+		_ = client.Close()
 		_ = kz.Close()
 		return nil, err
 	} else if !exists {
@@ -166,6 +240,7 @@ func JoinConsumerGroup(name string, topics []string, zookeeper []string, config
 		if err := cg.group.Create(); err != nil {
 			cg.Logf("FAILED to create consumergroup in Zookeeper: %s!\n", err)
 			_ = consumer.Close()
+			_ = client.Close()
 			_ = kz.Close()
 			return nil, err
 		}
@@ -187,6 +262,13 @@ func JoinConsumerGroup(name string, topics []string, zookeeper []string, config
 	return
 }
 
+// Topics returns the topics the consumergroup consumes right now
+func (cg *ConsumerGroup) Topics() []string {
+	cg.topicsLock.RLock()
+	defer cg.topicsLock.RUnlock()
+	return cg.topics
+}
+
 // Returns a channel that you can read to obtain events from Kafka to process.
 func (cg *ConsumerGroup) Messages() <-chan *sarama.ConsumerMessage {
 	return cg.messages
@@ -222,9 +304,21 @@ func (cg *ConsumerGroup) Close() error {
 		}
 
 		if shutdownError = cg.consumer.Close(); shutdownError != nil {
+			cg.Logf("FAILED closing the Sarama consumer: %s\n", shutdownError)
+		}
+
+		if shutdownError = cg.client.Close(); shutdownError != nil {
 			cg.Logf("FAILED closing the Sarama client: %s\n", shutdownError)
 		}
 
+		if cg.config.Ephemeral {
+			if err := cg.group.Delete(); err != nil {
+				cg.Logf("FAILED deleting ephemeral consumergroup: %s\n", err)
+			} else {
+				cg.Logf("Deleted ephemeral consumergroup %s.\n", cg.group.Name)
+			}
+		}
+
 		close(cg.messages)
 		close(cg.errors)
 		cg.instance = nil
@@ -257,6 +351,10 @@ func (cg *ConsumerGroup) FlushOffsets() error {
 }
 
 func (cg *ConsumerGroup) topicListConsumer(name string, topics []string) {
+	// new topics matching the pattern are not consumed by a bounded consumergroup,
+	// it has no stop offsets for them
+	watchTopics := cg.subscription.pattern != nil && !cg.config.Offsets.Bounded
+
 	for {
 		select {
 		case <-cg.stopper:
@@ -273,6 +371,19 @@ func (cg *ConsumerGroup) topicListConsumer(name string, topics []string) {
 		cg.consumers = consumers
 		cg.Logf("Currently registered consumers: %d\n", len(cg.consumers))
 
+		var topicChanges <-chan zk.Event
+		if watchTopics {
+			var subscribed []string
+			if subscribed, topicChanges, err = cg.subscription.watch(cg.kazoo); err != nil {
+				cg.Logf("FAILED to get list of topics: %s\n", err)
+				return
+			}
+			if !sameTopics(subscribed, topics) {
+				topics = subscribed
+				cg.updateTopics(topics)
+			}
+		}
+
 		stopper := make(chan struct{})
 
 		for _, topic := range topics {
@@ -280,28 +391,59 @@ func (cg *ConsumerGroup) topicListConsumer(name string, topics []string) {
 			go cg.topicConsumer(name, topic, cg.messages, cg.errors, stopper)
 		}
 
-		select {
-		case <-cg.stopper:
-			close(stopper)
-			return
+	waitForChange:
+		for {
+			select {
+			case <-cg.stopper:
+				close(stopper)
+				return
 
-		case <-consumerChanges:
-			registered, err := cg.instance.Registered()
-			if err != nil {
-				cg.Logf("FAILED to get register status: %s\n", err)
-			} else if !registered {
-				err = cg.instance.Register(topics)
+			case <-consumerChanges:
+				registered, err := cg.instance.Registered()
 				if err != nil {
-					cg.Logf("FAILED to register consumer instance: %s!\n", err)
-				} else {
-					cg.Logf("Consumer instance registered (%s).", cg.instance.ID)
+					cg.Logf("FAILED to get register status: %s\n", err)
+				} else if !registered {
+					err = cg.instance.Register(topics)
+					if err != nil {
+						cg.Logf("FAILED to register consumer instance: %s!\n", err)
+					} else {
+						cg.Logf("Consumer instance registered (%s).", cg.instance.ID)
+					}
 				}
-			}
 
-			cg.Logf("Triggering rebalance due to consumer list change\n")
-			close(stopper)
-			cg.wg.Wait()
+				cg.Logf("Triggering rebalance due to consumer list change\n")
+				break waitForChange
+
+			case <-topicChanges:
+				subscribed, changes, err := cg.subscription.watch(cg.kazoo)
+				if err != nil {
+					cg.Logf("FAILED to get list of topics: %s\n", err)
+				} else if sameTopics(subscribed, topics) {
+					// some other topic changed, keep watching
+					topicChanges = changes
+					continue waitForChange
+				}
+
+				cg.Logf("Triggering rebalance due to topic list change\n")
+				break waitForChange
+			}
 		}
+
+		close(stopper)
+		cg.wg.Wait()
+	}
+}
+
+// updateTopics switches the consumergroup over to topics and updates its
+// registration, so other instances can see the new subscription
+func (cg *ConsumerGroup) updateTopics(topics []string) {
+	cg.topicsLock.Lock()
+	cg.topics = topics
+	cg.topicsLock.Unlock()
+
+	cg.Logf("Consuming topics %v\n", topics)
+	if err := cg.instance.UpdateRegistration(topics); err != nil {
+		cg.Logf("FAILED to update consumer instance registration: %s!\n", err)
 	}
 }
 
@@ -346,12 +488,14 @@ func (cg *ConsumerGroup) topicConsumer(name string, topic string, messages chan<
 	// Consume all the assigned partitions
 	var wg sync.WaitGroup
 	metric := metrics.Metric{
-		Type: metrics.Offset,
+		Type:   metrics.PartitionOwned,
+		Labels: metrics.Labels{Connection: cg.config.Connection, ConsumerGroup: name, Topic: topic},
 	}
 	for _, pid := range myPartitions {
 		//Create PartitionInfo and send it for ingestion through the partition channel
 		//In case of re-balancing this function will be triggered again and the latest information will be sent
 		metric.Name = "partition_owned." + name + "." + topic + "." + strconv.Itoa(int(pid.ID))
+		metric.Labels.Partition = pid.ID
 		metric.Value = int64(1)
 		metrics.Ingest(metric)
 
@@ -360,6 +504,14 @@ func (cg *ConsumerGroup) topicConsumer(name string, topic string, messages chan<
 	}
 
 	wg.Wait()
+
+	//partitions are released, another instance may own them after the rebalance
+	for _, pid := range myPartitions {
+		metric.Name = "partition_owned." + name + "." + topic + "." + strconv.Itoa(int(pid.ID))
+		metric.Labels.Partition = pid.ID
+		metric.Value = int64(0)
+		metrics.Ingest(metric)
+	}
 	cg.Logf("%s :: Stopped topic consumer\n", topic)
 }
 
@@ -452,6 +604,26 @@ partitionClaimLoop:
 		}
 	}
 
+	var stopOffset int64 = -1 // aka unbounded
+	if cg.config.Offsets.Bounded {
+		stopOffset = cg.stopOffsets[topic][partition]
+		if nextOffset < 0 {
+			if nextOffset, err = cg.client.GetOffset(topic, partition, nextOffset); err != nil {
+				cg.Logf("%s/%d :: FAILED to resolve initial offset: %s\n", topic, partition, err)
+				return
+			}
+		}
+		if nextOffset >= stopOffset {
+			cg.Logf("%s/%d :: Partition consumer has nothing to consume before stop offset %d.\n", topic, partition, stopOffset)
+			cg.finishPartition(topic, partition)
+			if err := cg.offsetManager.FinalizePartition(topic, partition, -1, cg.config.Offsets.ProcessingTimeout); err != nil {
+				cg.Logf("%s/%d :: %s\n", topic, partition, err)
+			}
+			return
+		}
+		cg.Logf("%s/%d :: Partition consumer stopping at offset %d.\n", topic, partition, stopOffset)
+	}
+
 	consumer, err := cg.consumePartition(topic, partition, nextOffset)
 
 	if err != nil {
@@ -506,6 +678,11 @@ partitionConsumerLoop:
 
 			}
 
+			if stopOffset >= 0 && message.Offset >= stopOffset {
+				cg.finishPartition(topic, partition)
+				break partitionConsumerLoop
+			}
+
 			for {
 				select {
 				case <-stopper:
@@ -513,6 +690,10 @@ partitionConsumerLoop:
 
 				case messages <- message:
 					lastOffset = message.Offset
+					if stopOffset >= 0 && lastOffset+1 >= stopOffset {
+						cg.finishPartition(topic, partition)
+						break partitionConsumerLoop
+					}
 					continue partitionConsumerLoop
 				}
 			}
@@ -536,6 +717,77 @@ func (c *ConsumerGroup) GetConsumerOffset(topic string, partition int32) (int64,
 	return -1, errors.New("could not get offset")
 }
 
+// GetProcessedOffset returns the offset after the last one this instance
+// processed of a partition, false if the partition is not consumed by it
+func (c *ConsumerGroup) GetProcessedOffset(topic string, partition int32) (int64, bool) {
+	if zom, ok := c.offsetManager.(*zookeeperOffsetManager); ok {
+		return zom.processed(topic, partition)
+	}
+	return -1, false
+}
+
 func (c *ConsumerGroup) GetBrokerList() []string {
 	return c.brokerList
 }
+
+// GetSaramaConfig returns the sarama config the consumer group connects with,
+// for other clients of the same cluster
+func (c *ConsumerGroup) GetSaramaConfig() *sarama.Config {
+	return c.config.Config
+}
+
+// Finished returns a channel that is closed once every partition of a bounded
+// consumergroup has been consumed up to its stop offset
+func (cg *ConsumerGroup) Finished() <-chan struct{} {
+	return cg.finished
+}
+
+// resolveStopOffsets determines where each partition of a bounded consumergroup stops
+func (cg *ConsumerGroup) resolveStopOffsets(topics []string) error {
+	cg.stopOffsets = make(map[string]map[int32]int64)
+	cg.finishedPartitions = make(map[string]bool)
+	for _, topic := range topics {
+		partitions, err := cg.client.Partitions(topic)
+		if err != nil {
+			return err
+		}
+		cg.stopOffsets[topic] = make(map[int32]int64)
+		for _, partition := range partitions {
+			offset, ok := lookupOffset(cg.config.Offsets.StopOffsets, topic, partition)
+			if !ok || offset < 0 {
+				if !ok && !cg.config.Offsets.StopTimestamp.IsZero() {
+					offset, err = offsetForTime(cg.client, topic, partition, cg.config.Offsets.StopTimestamp)
+				} else if !ok {
+					offset, err = cg.client.GetOffset(topic, partition, sarama.OffsetNewest)
+				} else {
+					offset, err = cg.client.GetOffset(topic, partition, offset)
+				}
+				if err != nil {
+					return err
+				}
+			}
+			cg.stopOffsets[topic][partition] = offset
+			cg.pendingPartitions++
+		}
+	}
+	if cg.pendingPartitions == 0 {
+		close(cg.finished)
+	}
+	return nil
+}
+
+func (cg *ConsumerGroup) finishPartition(topic string, partition int32) {
+	cg.finishedLock.Lock()
+	defer cg.finishedLock.Unlock()
+
+	key := topic + "/" + strconv.Itoa(int(partition))
+	if cg.finishedPartitions[key] {
+		return
+	}
+	cg.finishedPartitions[key] = true
+	cg.pendingPartitions--
+	cg.Logf("%s/%d :: Partition reached its stop offset, %d partitions left.\n", topic, partition, cg.pendingPartitions)
+	if cg.pendingPartitions == 0 {
+		close(cg.finished)
+	}
+}
@@ -165,6 +165,20 @@ func (zom *zookeeperOffsetManager) MarkAsProcessed(topic string, partition int32
 	}
 }
 
+// processed returns the offset after the highest processed one of a partition
+// this instance consumes, false if it does not consume it
+func (zom *zookeeperOffsetManager) processed(topic string, partition int32) (int64, bool) {
+	zom.l.RLock()
+	tracker, ok := zom.offsets[topic][partition]
+	zom.l.RUnlock()
+	if !ok {
+		return -1, false
+	}
+	tracker.l.Lock()
+	defer tracker.l.Unlock()
+	return tracker.highestProcessedOffset + 1, true
+}
+
 func (zom *zookeeperOffsetManager) Flush() error {
 	zom.flush <- struct{}{}
 	return <-zom.flushErr
@@ -0,0 +1,133 @@
+package consumergroup
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/flipkart-incubator/go-dmux/kafka/kazoo-go"
+)
+
+// applyStartOffsets moves the consumergroup to the start position described by
+// Offsets.StartOffsets and Offsets.StartTimestamp by committing the resolved
+// offsets to Zookeeper. This happens only once per start marker, so restarts and
+// instances joining later resume from the committed offsets instead of seeking again.
+// While other instances of the group are registered they own its partitions and
+// commit over the seek, so it waits until an instance starts the group on its own.
+func applyStartOffsets(kz *kazoo.Kazoo, group *kazoo.Consumergroup, brokers []string, topics []string, config *Config) error {
+	if config.Offsets.StartTimestamp.IsZero() && len(config.Offsets.StartOffsets) == 0 {
+		return nil
+	}
+
+	marker := config.Offsets.StartMarker
+	if marker == "" {
+		marker = defaultStartMarker(config)
+	}
+	applied, err := group.StartMarker()
+	if err != nil {
+		return err
+	}
+	if applied == marker {
+		sarama.Logger.Printf("[%s] start position %q already applied, resuming from committed offsets\n", group.Name, marker)
+		return nil
+	}
+	instances, err := group.Instances()
+	if err != nil {
+		return err
+	}
+	if len(instances) > 0 {
+		sarama.Logger.Printf("[%s] %d other instances registered, start position %q not applied until the group starts without them\n", group.Name, len(instances), marker)
+		return nil
+	}
+
+	var client sarama.Client
+	defer func() {
+		if client != nil {
+			client.Close()
+		}
+	}()
+	getClient := func() (sarama.Client, error) {
+		if client == nil {
+			var err error
+			if client, err = sarama.NewClient(brokers, config.Config); err != nil {
+				return nil, err
+			}
+		}
+		return client, nil
+	}
+
+	for _, topic := range topics {
+		partitions, err := kz.Topic(topic).Partitions()
+		if err != nil {
+			return err
+		}
+		for _, partition := range partitions {
+			offset, ok := lookupOffset(config.Offsets.StartOffsets, topic, partition.ID)
+			if !ok && config.Offsets.StartTimestamp.IsZero() {
+				continue
+			}
+
+			if !ok || offset < 0 {
+				c, err := getClient()
+				if err != nil {
+					return err
+				}
+				if ok {
+					// sarama.OffsetNewest or sarama.OffsetOldest
+					offset, err = c.GetOffset(topic, partition.ID, offset)
+				} else {
+					offset, err = offsetForTime(c, topic, partition.ID, config.Offsets.StartTimestamp)
+				}
+				if err != nil {
+					return err
+				}
+			}
+
+			if err := group.CommitOffset(topic, partition.ID, offset); err != nil {
+				return err
+			}
+			sarama.Logger.Printf("[%s] %s/%d :: start offset set to %d\n", group.Name, topic, partition.ID, offset)
+		}
+	}
+
+	return group.SetStartMarker(marker)
+}
+
+// lookupOffset looks up the explicit offset configured for a partition. Offsets listed
+// under the empty topic apply to every topic.
+func lookupOffset(offsets map[string]map[int32]int64, topic string, partition int32) (int64, bool) {
+	if offset, ok := offsets[topic][partition]; ok {
+		return offset, true
+	}
+	offset, ok := offsets[""][partition]
+	return offset, ok
+}
+
+// offsetForTime returns the first offset produced at or after t, or the newest
+// offset if nothing was produced since then
+func offsetForTime(client sarama.Client, topic string, partition int32, t time.Time) (int64, error) {
+	offset, err := client.GetOffset(topic, partition, t.UnixNano()/int64(time.Millisecond))
+	if err != nil {
+		return -1, err
+	}
+	if offset < 0 {
+		return client.GetOffset(topic, partition, sarama.OffsetNewest)
+	}
+	return offset, nil
+}
+
+func defaultStartMarker(config *Config) string {
+	var parts []string
+	if !config.Offsets.StartTimestamp.IsZero() {
+		parts = append(parts, config.Offsets.StartTimestamp.UTC().Format(time.RFC3339Nano))
+	}
+	for topic, partitions := range config.Offsets.StartOffsets {
+		for partition, offset := range partitions {
+			parts = append(parts, fmt.Sprintf("%s:%d=%d", topic, partition, offset))
+		}
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
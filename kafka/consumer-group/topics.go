@@ -0,0 +1,60 @@
+package consumergroup
+
+import (
+	"regexp"
+	"sort"
+
+	"github.com/flipkart-incubator/go-dmux/kafka/kazoo-go"
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// subscription holds the topics a consumergroup consumes: the topics it was
+// joined with and every topic of the cluster matching pattern
+type subscription struct {
+	topics  []string
+	pattern *regexp.Regexp
+}
+
+// watch returns the subscribed topics and a channel which fires once the
+// topic list of the cluster changes
+func (s subscription) watch(kz *kazoo.Kazoo) ([]string, <-chan zk.Event, error) {
+	all, changes, err := kz.WatchTopics()
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.match(all), changes, nil
+}
+
+// match returns the sorted, distinct topics of the subscription out of all
+func (s subscription) match(all kazoo.TopicList) []string {
+	seen := make(map[string]bool)
+	result := make([]string, 0, len(s.topics))
+	for _, topic := range s.topics {
+		if !seen[topic] {
+			seen[topic] = true
+			result = append(result, topic)
+		}
+	}
+	if s.pattern != nil {
+		for _, topic := range all {
+			if !seen[topic.Name] && s.pattern.MatchString(topic.Name) {
+				seen[topic.Name] = true
+				result = append(result, topic.Name)
+			}
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func sameTopics(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
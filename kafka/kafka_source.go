@@ -2,8 +2,14 @@ package kafka
 
 import (
 	"context"
+	"errors"
+	"github.com/flipkart-incubator/go-dmux/alerting"
+	"github.com/flipkart-incubator/go-dmux/core"
+	"github.com/flipkart-incubator/go-dmux/filter"
+	"github.com/flipkart-incubator/go-dmux/health"
 	"github.com/flipkart-incubator/go-dmux/offset_monitor"
-	"os"
+	"github.com/flipkart-incubator/go-dmux/plugin"
+	"log"
 	"time"
 
 	"github.com/Shopify/sarama"
@@ -35,6 +41,12 @@ type KafkaSource struct {
 	hook       KafkaSourceHook
 	factory    KafkaMsgFactory
 	offMonitor offset_monitor.OffMonitor
+	finished   chan struct{}
+
+	health *health.Connection   // readiness signals of the connection, nil if not reported
+	alerts *alerting.Connection // alert signals of the connection, nil if not reported
+	filter *filter.Filter       // drops messages before they are pushed, nil to push every message
+	plugin *plugin.Plugin       // drops messages its filter returns 0 for after filter, nil to push every message
 }
 
 //KafkaConf holds configuration options for KafkaSource
@@ -48,17 +60,61 @@ type KafkaConf struct {
 	SASLEnabled       bool   `json:"sasl_enabled"`
 	SASLUsername      string `json:"username"`
 	SASLPasswordKey   string `json:"passwordKey"`
+	SASLMechanism     string `json:"sasl_mechanism"` // PLAIN (default), SCRAM-SHA-256 or SCRAM-SHA-512
+
+	TLS TLSConf `json:"tls"`
+
+	Topics       []string `json:"topics"`        // consumed along with topic
+	TopicPattern string   `json:"topic_pattern"` // regex matching whole topic names, new matching topics are picked up
+
+	StartFromTimestamp string           `json:"start_from_timestamp"` // RFC3339, epoch millis or relative to now e.g. -2h
+	StartOffsets       map[string]int64 `json:"start_offsets"`        // partition or topic:partition to offset
+
+	Replay *ReplayConf `json:"replay"` // bounded replay, read with an ephemeral consumer group
 }
 
 //GetKafkaSource method is used to get instance of KafkaSource.
 func GetKafkaSource(conf KafkaConf, factory KafkaMsgFactory, offMonitor offset_monitor.OffMonitor) *KafkaSource {
+	if conf.Replay != nil {
+		conf.ConsumerGroupName = replayGroupName(conf.ConsumerGroupName, time.Now())
+	}
 	return &KafkaSource{
 		conf:       conf,
 		factory:    factory,
 		offMonitor: offMonitor,
+		finished:   make(chan struct{}),
 	}
 }
 
+// Finished returns a channel that is closed once a replay source has pushed
+// every message of its range
+func (k *KafkaSource) Finished() <-chan struct{} {
+	return k.finished
+}
+
+// SetHealth makes the source report readiness signals to h
+func (k *KafkaSource) SetHealth(h *health.Connection) {
+	k.health = h
+}
+
+// SetAlerts makes the source and its offset tracker report alert signals to
+// a, it has to be called before the tracker is created
+func (k *KafkaSource) SetAlerts(a *alerting.Connection) {
+	k.alerts = a
+}
+
+// SetFilter makes the source drop the messages f does not keep, they are
+// marked done without being pushed
+func (k *KafkaSource) SetFilter(f *filter.Filter) {
+	k.filter = f
+}
+
+// SetPlugin makes the source drop the messages the filter function of p
+// drops, they are marked done without being pushed
+func (k *KafkaSource) SetPlugin(p *plugin.Plugin) {
+	k.plugin = p
+}
+
 //RegisterHook used to registerHook with KafkSource
 func (k *KafkaSource) RegisterHook(hook KafkaSourceHook) {
 	k.hook = hook
@@ -71,7 +127,28 @@ func (k *KafkaSource) RegisterHook(hook KafkaSourceHook) {
 // }
 
 func (k *KafkaSource) GetKey(msg interface{}) []byte {
-	return msg.(KafkaMsg).GetRawMsg().Key
+	return OrderingKey(msg.(KafkaMsg))
+}
+
+// OrderingKey returns the ordering key of msg if it knows it, the key of the
+// record otherwise
+func OrderingKey(msg KafkaMsg) []byte {
+	if k, ok := msg.(core.OrderingKeyMsg); ok {
+		return k.GetOrderingKey()
+	}
+	return msg.GetRawMsg().Key
+}
+
+// RecordHeader looks up the headers of msg
+func RecordHeader(msg *sarama.ConsumerMessage) func(name string) []byte {
+	return func(name string) []byte {
+		for _, h := range msg.Headers {
+			if h != nil && string(h.Key) == name {
+				return h.Value
+			}
+		}
+		return nil
+	}
 }
 
 func (k *KafkaSource) GetPartition(msg interface{}) int32 {
@@ -102,21 +179,42 @@ func (k *KafkaSource) Generate(out chan<- interface{}) {
 		config.Offsets.Initial = sarama.OffsetNewest
 	}
 
-	if kconf.SASLEnabled {
-		//sarama config plain by default
-		config.Net.SASL.User = kconf.SASLUsername
-		config.Net.SASL.Password = os.Getenv(kconf.SASLPasswordKey)
-		config.Net.SASL.Enable = true
+	if err := kconf.applySecurity(config.Config); err != nil {
+		panic(err)
 	}
 
 	config.Offsets.ProcessingTimeout = 10 * time.Second
+	config.Connection = k.offMonitor.Connection()
+
+	//start position, applied once per consumer group
+	startTime, err := parseStartTimestamp(kconf.StartFromTimestamp, time.Now())
+	if err != nil {
+		panic(err)
+	}
+	startOffsets, err := parseStartOffsets(kconf.StartOffsets)
+	if err != nil {
+		panic(err)
+	}
+	config.Offsets.StartTimestamp = startTime
+	config.Offsets.StartOffsets = startOffsets
+	config.Offsets.StartMarker = startMarker(kconf)
+
+	if kconf.Replay != nil {
+		if err := kconf.Replay.apply(config, time.Now()); err != nil {
+			panic(err)
+		}
+		log.Printf("replaying with ephemeral consumer group %s \n", kconf.ConsumerGroupName)
+	}
 
 	//parse zookeeper
 	zookeeperNodes, chroot := kazoo.ParseConnectionString(kconf.ZkPath)
 	config.Zookeeper.Chroot = chroot
 
 	//get topics
-	kafkaTopics := []string{kconf.Topic}
+	kafkaTopics := kconf.topics()
+	if config.TopicPattern, err = compileTopicPattern(kconf.TopicPattern); err != nil {
+		panic(err)
+	}
 
 	// create consumer
 	consumer, err := consumergroup.JoinConsumerGroup(kconf.ConsumerGroupName, kafkaTopics, zookeeperNodes, config)
@@ -125,25 +223,77 @@ func (k *KafkaSource) Generate(out chan<- interface{}) {
 	}
 
 	k.consumer = consumer
+	k.health.Joined(true)
+	k.health.AddCheck("consumer group", func() error {
+		if consumer.Closed() {
+			return errors.New("closed")
+		}
+		registered, err := consumer.InstanceRegistered()
+		if err == nil && !registered {
+			err = errors.New("instance is not registered")
+		}
+		return err
+	})
+	k.health.Producing(true)
+	defer k.health.Producing(false)
 
 	//context for gracefully shutting down the producerConsumer offset reader goroutine
 	ctx, cancelFunc := context.WithCancel(context.Background())
 	defer cancelFunc()
 
-	k.offMonitor.StartProducerConsumerMonitor(consumer.GetBrokerList(), kconf.Topic, k.conf.ConsumerGroupName, consumer, ctx)
-
-	for message := range k.consumer.Messages() {
-		//TODO handle Create failure
-		kafkaMsg := k.factory.Create(message)
+	k.offMonitor.StartProducerConsumerMonitor(consumer.GetBrokerList(), k.conf.ConsumerGroupName, consumer, ctx)
 
-		if k.hook != nil {
-			//TODO handle PreHook failure
-			k.hook.Pre(kafkaMsg)
+	messages := k.consumer.Messages()
+	for {
+		select {
+		case message, ok := <-messages:
+			if !ok {
+				return
+			}
+			k.push(message, out)
+		case <-consumer.Finished():
+			//every partition reached its end, forward what is still buffered
+			for {
+				select {
+				case message, ok := <-messages:
+					if !ok {
+						return
+					}
+					k.push(message, out)
+				default:
+					log.Printf("consumer group %s reached the end of its range \n", kconf.ConsumerGroupName)
+					close(k.finished)
+					return
+				}
+			}
 		}
+	}
+}
+
+func (k *KafkaSource) push(message *sarama.ConsumerMessage, out chan<- interface{}) {
+	//TODO handle Create failure
+	kafkaMsg := k.factory.Create(message)
+
+	if k.hook != nil {
+		//TODO handle PreHook failure
+		k.hook.Pre(kafkaMsg)
+	}
 
-		out <- kafkaMsg
+	if !k.filter.Keep(&filter.Record{
+		Topic:     message.Topic,
+		Partition: message.Partition,
+		Offset:    message.Offset,
+		Key:       message.Key,
+		Value:     message.Value,
+		Header:    RecordHeader(message),
+	}) || !k.plugin.Keep(kafkaMsg) {
+		kafkaMsg.MarkDone()
+		return
 	}
 
+	k.health.Push()
+	out <- kafkaMsg
+	k.health.Pushed()
 }
 
 //Stop method implements Source interface stop method, to Stop the KafkaConsumer
@@ -2,10 +2,12 @@ package kafka
 
 import (
 	"hash/fnv"
+	"log"
 	"testing"
 
 	"github.com/Shopify/sarama"
 	"github.com/flipkart-incubator/go-dmux/core"
+	"github.com/flipkart-incubator/go-dmux/offset_monitor"
 	"github.com/stretchr/testify/assert"
 	// "hash/fnv"
 	// "time"
@@ -14,14 +16,15 @@ import (
 type ConsoleSink struct {
 }
 
-func (c *ConsoleSink) Consume(msg interface{}) {
+func (c *ConsoleSink) Consume(msg interface{}, retries int, sidelineResponseCodes []int) error {
 	data := msg.(KafkaMsg)
 	log.Println(string(data.GetRawMsg().Key))
+	return nil
 }
 
 func (c *ConsoleSink) BatchConsume(msgs []interface{}, version int) {
 	for _, msg := range msgs {
-		c.Consume(msg)
+		c.Consume(msg, 0, nil)
 	}
 }
 
@@ -90,7 +93,7 @@ func TestKafkaSource(t *testing.T) {
 	}
 
 	kfactory := &KafkaMsgFactoryImpl{}
-	source := GetKafkaSource(kconf, kfactory)
+	source := GetKafkaSource(kconf, kfactory, offset_monitor.GetOffMonitor(offset_monitor.OffMonitorConf{}, "test"))
 	sink := new(ConsoleSink)
 	dconf := core.DmuxConf{
 		Size:        4,
@@ -489,6 +489,25 @@ func (cg *Consumergroup) ResetOffsets() error {
 	return nil
 }
 
+// StartMarker retrieves the marker of the start position that was last applied
+// to the consumergroup. It returns an empty string if none was ever applied.
+func (cg *Consumergroup) StartMarker() (string, error) {
+	node := fmt.Sprintf("%s/consumers/%s/start", cg.kz.conf.Chroot, cg.Name)
+	val, _, err := cg.kz.conn.Get(node)
+	if err == zk.ErrNoNode {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return string(val), nil
+}
+
+// SetStartMarker stores the marker of the start position applied to the consumergroup
+func (cg *Consumergroup) SetStartMarker(marker string) error {
+	node := fmt.Sprintf("%s/consumers/%s/start", cg.kz.conf.Chroot, cg.Name)
+	return cg.kz.createOrUpdate(node, []byte(marker), false)
+}
+
 // generateUUID Generates a UUIDv4.
 func generateUUID() (string, error) {
 	uuid := make([]byte, 16)
@@ -98,9 +98,35 @@ func NewKazooFromConnectionString(connectionString string, conf *Config) (*Kazoo
 	return NewKazoo(nodes, conf)
 }
 
+// Kafka security protocols, as used to name broker listeners
+const (
+	ProtocolPlaintext     = "PLAINTEXT"
+	ProtocolSSL           = "SSL"
+	ProtocolSASLPlaintext = "SASL_PLAINTEXT"
+	ProtocolSASLSSL       = "SASL_SSL"
+)
+
+// SecurityProtocol returns the kafka security protocol a client with the given
+// SASL and TLS settings connects with
+func SecurityProtocol(saslEnabled, tlsEnabled bool) string {
+	switch {
+	case saslEnabled && tlsEnabled:
+		return ProtocolSASLSSL
+	case saslEnabled:
+		return ProtocolSASLPlaintext
+	case tlsEnabled:
+		return ProtocolSSL
+	default:
+		return ProtocolPlaintext
+	}
+}
+
 // Brokers returns a map of all the brokers that make part of the
-// Kafka cluster that is registered in Zookeeper.
-func (kz *Kazoo) Brokers(saslEnabled bool) (map[int32]string, error) {
+// Kafka cluster that is registered in Zookeeper. Brokers with several listeners
+// are reached through the listener of securityProtocol, which is resolved through
+// listener_security_protocol_map for named listeners. An empty securityProtocol
+// picks any listener.
+func (kz *Kazoo) Brokers(securityProtocol string) (map[int32]string, error) {
 	root := fmt.Sprintf("%s/brokers/ids", kz.conf.Chroot)
 	children, _, err := kz.conn.Children(root)
 	if err != nil {
@@ -108,9 +134,10 @@ func (kz *Kazoo) Brokers(saslEnabled bool) (map[int32]string, error) {
 	}
 
 	type brokerEntry struct {
-		Host string `json:"host"`
-		Port int    `json:"port"`
-		Endpoints []string `json:"endpoints"`
+		Host                        string            `json:"host"`
+		Port                        int               `json:"port"`
+		Endpoints                   []string          `json:"endpoints"`
+		ListenerSecurityProtocolMap map[string]string `json:"listener_security_protocol_map"`
 	}
 
 	result := make(map[int32]string)
@@ -130,15 +157,20 @@ func (kz *Kazoo) Brokers(saslEnabled bool) (map[int32]string, error) {
 			return nil, err
 		}
 
-		if (brokerNode.Endpoints!=nil) && (len(brokerNode.Endpoints)>0) {
-			for i := 0; i < len(brokerNode.Endpoints); i++ {
-				mechanism := strings.Split(brokerNode.Endpoints[i],"://")[0]
-				hostAndPortString := strings.Split(brokerNode.Endpoints[i],"://")[1]
-				hostAndPort := strings.Split(hostAndPortString, ":")
-				if ((mechanism == "SASL_PLAINTEXT") && (saslEnabled == true)) || ((mechanism == "PLAINTEXT") && (saslEnabled == false)) {
-					result[int32(brokerID)] = fmt.Sprintf("%s:%s", hostAndPort[0], hostAndPort[1])
+		if len(brokerNode.Endpoints) > 0 {
+			for _, endpoint := range brokerNode.Endpoints {
+				listenerAndAddress := strings.SplitN(endpoint, "://", 2)
+				if len(listenerAndAddress) != 2 {
+					continue
+				}
+				protocol, ok := brokerNode.ListenerSecurityProtocolMap[listenerAndAddress[0]]
+				if !ok {
+					protocol = listenerAndAddress[0]
+				}
+				if securityProtocol == "" || protocol == securityProtocol {
+					result[int32(brokerID)] = listenerAndAddress[1]
+					break
 				}
-
 			}
 		} else {
 			result[int32(brokerID)] = fmt.Sprintf("%s:%d", brokerNode.Host, brokerNode.Port)
@@ -150,8 +182,8 @@ func (kz *Kazoo) Brokers(saslEnabled bool) (map[int32]string, error) {
 
 // BrokerList returns a slice of broker addresses that can be used to connect to
 // the Kafka cluster, e.g. using `sarama.NewAsyncProducer()`.
-func (kz *Kazoo) BrokerList(saslEnabled bool) ([]string, error) {
-	brokers, err := kz.Brokers(saslEnabled)
+func (kz *Kazoo) BrokerList(securityProtocol string) ([]string, error) {
+	brokers, err := kz.Brokers(securityProtocol)
 	if err != nil {
 		return nil, err
 	}
@@ -166,7 +198,7 @@ func (kz *Kazoo) BrokerList(saslEnabled bool) ([]string, error) {
 
 // BrokerIDList returns a sorted slice of broker ids that can be used for manipulating topics and partitions.`.
 func (kz *Kazoo) brokerIDList() ([]int32, error) {
-	brokers, err := kz.Brokers(false)
+	brokers, err := kz.Brokers("")
 	if err != nil {
 		return nil, err
 	}
@@ -3,6 +3,9 @@ package kafka
 import (
 	"log"
 	"time"
+
+	"github.com/flipkart-incubator/go-dmux/metrics"
+	"github.com/flipkart-incubator/go-dmux/tracing"
 )
 
 // OffsetTracker is interface which defines methods to track Messages which
@@ -11,12 +14,20 @@ type OffsetTracker interface {
 	TrackMe(kmsg KafkaMsg)
 }
 
+// SidelinedMsg is implemented by KafkaMsg which can tell if they were sidelined
+// instead of being processed by the Sink
+type SidelinedMsg interface {
+	IsSidelined() bool
+}
+
 // KafkaOffsetTracker is implementation of OffsetTracker to track offsets for
 // KafkaSource, KafkaMessage
 type KafkaOffsetTracker struct {
 	ch     chan KafkaMsg
 	source *KafkaSource
 	size   int
+	stats  *ReplayStats
+	done   chan struct{}
 }
 
 // TrackMe method ensures messages to track are enqued for tracking
@@ -25,30 +36,65 @@ func (k *KafkaOffsetTracker) TrackMe(kmsg KafkaMsg) {
 		log.Printf("warning: pending_acks threshold %d reached, please increase pending_acks size \n", k.size)
 	}
 
-	k.source.offMonitor.IngestSrcSkMetric("source_offset"+"."+k.source.conf.ConsumerGroupName, kmsg.GetRawMsg())
+	k.source.offMonitor.IngestSrcSkMetric(metrics.SourceOffset, k.source.conf.ConsumerGroupName, kmsg.GetRawMsg())
+	k.source.health.Tracked()
+	raw := kmsg.GetRawMsg()
+	k.source.alerts.Read(raw.Topic, raw.Partition, raw.Offset)
 	k.ch <- kmsg
 }
 
+// CountInto makes the tracker count delivered, failed and sidelined messages
+// into stats
+func (k *KafkaOffsetTracker) CountInto(stats *ReplayStats) {
+	k.stats = stats
+}
+
+// Close waits for every tracked message to be processed and committed. No
+// message should be tracked once Close is called.
+func (k *KafkaOffsetTracker) Close() {
+	close(k.ch)
+	<-k.done
+}
+
 // GetKafkaOffsetTracker is Global function to get instance of KafkaOffsetTracker
-func GetKafkaOffsetTracker(size int, source *KafkaSource) OffsetTracker {
+func GetKafkaOffsetTracker(size int, source *KafkaSource) *KafkaOffsetTracker {
 	k := &KafkaOffsetTracker{
 		ch:     make(chan KafkaMsg, size),
 		source: source,
 		size:   size,
+		done:   make(chan struct{}),
 	}
+	source.alerts.WatchPendingAcks(func() (int, int) {
+		return len(k.ch), k.size
+	})
 	go k.run()
 	return k
 }
 
 func (k *KafkaOffsetTracker) run() {
+	defer close(k.done)
 	for kmsg := range k.ch {
 		for !kmsg.IsProcessed() {
 			//log.Printf("waiting for url %s to process, queue_len %d", kmsg.GetURLPath(), len(k.ch))
 			time.Sleep(100 * time.Microsecond)
 		}
 
-		if isUpdated, err := k.source.CommitOffsets(kmsg); isUpdated && err == nil {
-			k.source.offMonitor.IngestSrcSkMetric("sink_offset"+"."+k.source.conf.ConsumerGroupName, kmsg.GetRawMsg())
+		if s, ok := kmsg.(SidelinedMsg); ok && s.IsSidelined() {
+			k.stats.Failed()
+			k.stats.Sidelined()
+		} else {
+			k.stats.Delivered()
+		}
+
+		isUpdated, err := k.source.CommitOffsets(kmsg)
+		if isUpdated && err == nil {
+			k.source.offMonitor.IngestSrcSkMetric(metrics.SinkOffset, k.source.conf.ConsumerGroupName, kmsg.GetRawMsg())
+		}
+		if err == nil {
+			k.source.health.Committed()
+			raw := kmsg.GetRawMsg()
+			k.source.alerts.Committed(raw.Topic, raw.Partition, raw.Offset)
 		}
+		tracing.TraceOf(kmsg).Committed()
 	}
 }
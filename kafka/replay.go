@@ -0,0 +1,90 @@
+package kafka
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/flipkart-incubator/go-dmux/kafka/consumer-group"
+)
+
+// ReplayConf bounds a KafkaSource to a range of offsets or time. The range is
+// read with an ephemeral consumer group, so the offsets of the production
+// consumer group are left untouched, and the source finishes once every
+// partition reaches its end.
+type ReplayConf struct {
+	From        string           `json:"from"`         // same format as start_from_timestamp, defaults to the oldest offset
+	To          string           `json:"to"`           // same format as start_from_timestamp, defaults to the newest offset at start
+	FromOffsets map[string]int64 `json:"from_offsets"` // partition or topic:partition to first offset, takes precedence over from
+	ToOffsets   map[string]int64 `json:"to_offsets"`   // partition or topic:partition to end offset (exclusive), takes precedence over to
+}
+
+// replayGroupName returns the name of the ephemeral consumer group of a replay
+func replayGroupName(name string, now time.Time) string {
+	return fmt.Sprintf("%s-replay-%d", name, now.Unix())
+}
+
+// apply configures the consumer group to read the replay range once
+func (r *ReplayConf) apply(config *consumergroup.Config, now time.Time) error {
+	from, err := parseStartTimestamp(r.From, now)
+	if err != nil {
+		return err
+	}
+	to, err := parseStartTimestamp(r.To, now)
+	if err != nil {
+		return err
+	}
+	fromOffsets, err := parseStartOffsets(r.FromOffsets)
+	if err != nil {
+		return err
+	}
+	toOffsets, err := parseStartOffsets(r.ToOffsets)
+	if err != nil {
+		return err
+	}
+
+	config.Ephemeral = true
+	config.Offsets.ResetOffsets = false
+	config.Offsets.Initial = sarama.OffsetOldest
+	config.Offsets.StartTimestamp = from
+	config.Offsets.StartOffsets = fromOffsets
+	config.Offsets.StartMarker = ""
+	config.Offsets.Bounded = true
+	config.Offsets.StopTimestamp = to
+	config.Offsets.StopOffsets = toOffsets
+	return nil
+}
+
+// ReplayStats counts how the messages of a replay were handled, every message
+// once when it is committed. Failed messages are the ones the sink gave up on,
+// sidelined ones are counted as failed too
+type ReplayStats struct {
+	delivered, failed, sidelined int64
+}
+
+// Delivered counts a message the sink processed
+func (s *ReplayStats) Delivered() {
+	if s != nil {
+		atomic.AddInt64(&s.delivered, 1)
+	}
+}
+
+// Failed counts a message the sink gave up on
+func (s *ReplayStats) Failed() {
+	if s != nil {
+		atomic.AddInt64(&s.failed, 1)
+	}
+}
+
+// Sidelined counts a message that was sidelined instead of being processed by the sink
+func (s *ReplayStats) Sidelined() {
+	if s != nil {
+		atomic.AddInt64(&s.sidelined, 1)
+	}
+}
+
+func (s *ReplayStats) String() string {
+	return fmt.Sprintf("delivered=%d failed=%d sidelined=%d",
+		atomic.LoadInt64(&s.delivered), atomic.LoadInt64(&s.failed), atomic.LoadInt64(&s.sidelined))
+}
@@ -0,0 +1,41 @@
+package kafka
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/flipkart-incubator/go-dmux/kafka/consumer-group"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplayConfApply(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	config := consumergroup.NewConfig()
+	config.Offsets.ResetOffsets = true
+
+	r := &ReplayConf{From: "-2h", To: "-1h", ToOffsets: map[string]int64{"orders:3": 500}}
+	assert.Nil(t, r.apply(config, now))
+	assert.True(t, config.Ephemeral)
+	assert.True(t, config.Offsets.Bounded)
+	assert.False(t, config.Offsets.ResetOffsets)
+	assert.Equal(t, sarama.OffsetOldest, config.Offsets.Initial)
+	assert.Equal(t, now.Add(-2*time.Hour), config.Offsets.StartTimestamp)
+	assert.Equal(t, now.Add(-1*time.Hour), config.Offsets.StopTimestamp)
+	assert.Equal(t, int64(500), config.Offsets.StopOffsets["orders"][3])
+
+	r = &ReplayConf{To: "tomorrow"}
+	assert.NotNil(t, r.apply(consumergroup.NewConfig(), now))
+}
+
+func TestReplayStats(t *testing.T) {
+	var none *ReplayStats
+	none.Delivered()
+
+	stats := new(ReplayStats)
+	stats.Delivered()
+	stats.Delivered()
+	stats.Failed()
+	stats.Sidelined()
+	assert.Equal(t, "delivered=2 failed=1 sidelined=1", stats.String())
+}
@@ -0,0 +1,104 @@
+package kafka
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/Shopify/sarama"
+	"github.com/xdg/scram"
+)
+
+// TLSConf holds TLS options to connect to the kafka brokers
+type TLSConf struct {
+	Enabled            bool   `json:"enabled"`
+	CAFile             string `json:"ca_file"`              // PEM CA bundle, system roots if empty
+	CertFile           string `json:"cert_file"`            // PEM client certificate, for mutual TLS
+	KeyFile            string `json:"key_file"`             // PEM client key, for mutual TLS
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"` // skips broker certificate verification, for dev only
+}
+
+// applySecurity sets the SASL and TLS options of conf on config
+func (conf KafkaConf) applySecurity(config *sarama.Config) error {
+	if conf.SASLEnabled {
+		//sarama config plain by default
+		config.Net.SASL.User = conf.SASLUsername
+		config.Net.SASL.Password = os.Getenv(conf.SASLPasswordKey)
+		config.Net.SASL.Enable = true
+
+		switch mechanism := sarama.SASLMechanism(conf.SASLMechanism); mechanism {
+		case "", sarama.SASLTypePlaintext:
+			config.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+		case sarama.SASLTypeSCRAMSHA256:
+			config.Net.SASL.Mechanism = mechanism
+			config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &scramClient{hashGen: sha256.New} }
+		case sarama.SASLTypeSCRAMSHA512:
+			config.Net.SASL.Mechanism = mechanism
+			config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &scramClient{hashGen: sha512.New} }
+		default:
+			return fmt.Errorf("unsupported sasl_mechanism %s", mechanism)
+		}
+	}
+
+	if conf.TLS.Enabled {
+		tlsConfig, err := conf.TLS.build()
+		if err != nil {
+			return err
+		}
+		config.Net.TLS.Enable = true
+		config.Net.TLS.Config = tlsConfig
+	}
+	return nil
+}
+
+func (t TLSConf) build() (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: t.InsecureSkipVerify}
+
+	if t.CAFile != "" {
+		ca, err := ioutil.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate found in ca_file %s", t.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if t.CertFile != "" || t.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// scramClient implements sarama.SCRAMClient over xdg/scram
+type scramClient struct {
+	*scram.ClientConversation
+	hashGen scram.HashGeneratorFcn
+}
+
+func (s *scramClient) Begin(userName, password, authzID string) error {
+	client, err := s.hashGen.NewClient(userName, password, authzID)
+	if err != nil {
+		return err
+	}
+	s.ClientConversation = client.NewConversation()
+	return nil
+}
+
+func (s *scramClient) Step(challenge string) (string, error) {
+	return s.ClientConversation.Step(challenge)
+}
+
+func (s *scramClient) Done() bool {
+	return s.ClientConversation.Done()
+}
@@ -0,0 +1,48 @@
+package kafka
+
+import (
+	"crypto/sha512"
+	"os"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplySecurity(t *testing.T) {
+	os.Setenv("DMUX_TEST_KAFKA_PASSWORD", "secret")
+	defer os.Unsetenv("DMUX_TEST_KAFKA_PASSWORD")
+
+	config := sarama.NewConfig()
+	conf := KafkaConf{SASLEnabled: true, SASLUsername: "dmux", SASLPasswordKey: "DMUX_TEST_KAFKA_PASSWORD"}
+	assert.Nil(t, conf.applySecurity(config))
+	assert.True(t, config.Net.SASL.Enable)
+	assert.Equal(t, sarama.SASLMechanism(sarama.SASLTypePlaintext), config.Net.SASL.Mechanism)
+	assert.Equal(t, "secret", config.Net.SASL.Password)
+	assert.False(t, config.Net.TLS.Enable)
+
+	config = sarama.NewConfig()
+	conf.SASLMechanism = "SCRAM-SHA-512"
+	conf.TLS = TLSConf{Enabled: true, InsecureSkipVerify: true}
+	assert.Nil(t, conf.applySecurity(config))
+	assert.Equal(t, sarama.SASLMechanism(sarama.SASLTypeSCRAMSHA512), config.Net.SASL.Mechanism)
+	assert.NotNil(t, config.Net.SASL.SCRAMClientGeneratorFunc())
+	assert.True(t, config.Net.TLS.Enable)
+	assert.True(t, config.Net.TLS.Config.InsecureSkipVerify)
+	assert.Nil(t, config.Validate())
+
+	conf.SASLMechanism = "GSSAPI"
+	assert.NotNil(t, conf.applySecurity(sarama.NewConfig()))
+
+	conf = KafkaConf{TLS: TLSConf{Enabled: true, CAFile: "/nonexistent/ca.pem"}}
+	assert.NotNil(t, conf.applySecurity(sarama.NewConfig()))
+}
+
+func TestScramClient(t *testing.T) {
+	client := &scramClient{hashGen: sha512.New}
+	assert.Nil(t, client.Begin("dmux", "secret", ""))
+	first, err := client.Step("")
+	assert.Nil(t, err)
+	assert.Contains(t, first, "n=dmux")
+	assert.False(t, client.Done())
+}
@@ -0,0 +1,70 @@
+package kafka
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseStartTimestamp parses start_from_timestamp. It accepts an RFC3339 time,
+// epoch milliseconds, or a negative duration relative to now such as -2h.
+func parseStartTimestamp(spec string, now time.Time) (time.Time, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return time.Time{}, nil
+	}
+	if strings.HasPrefix(spec, "-") {
+		d, err := time.ParseDuration(spec)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return now.Add(d), nil
+	}
+	if millis, err := strconv.ParseInt(spec, 10, 64); err == nil {
+		return time.Unix(0, millis*int64(time.Millisecond)), nil
+	}
+	return time.Parse(time.RFC3339, spec)
+}
+
+// parseStartOffsets converts start_offsets, keyed by partition or topic:partition,
+// to offsets by topic and partition. Unqualified partitions are listed under the
+// empty topic, which applies to every subscribed topic.
+func parseStartOffsets(offsets map[string]int64) (map[string]map[int32]int64, error) {
+	if len(offsets) == 0 {
+		return nil, nil
+	}
+	result := make(map[string]map[int32]int64)
+	for key, offset := range offsets {
+		topic := ""
+		partitionStr := key
+		if i := strings.LastIndex(key, ":"); i >= 0 {
+			topic = key[:i]
+			partitionStr = key[i+1:]
+		}
+		partition, err := strconv.ParseInt(partitionStr, 10, 32)
+		if err != nil || partition < 0 {
+			return nil, errors.New("invalid start_offsets partition " + key)
+		}
+		if result[topic] == nil {
+			result[topic] = make(map[int32]int64)
+		}
+		result[topic][int32(partition)] = offset
+	}
+	return result, nil
+}
+
+// startMarker identifies the configured start position by its raw settings, so
+// a relative start_from_timestamp is applied once rather than on every restart
+func startMarker(conf KafkaConf) string {
+	if conf.StartFromTimestamp == "" && len(conf.StartOffsets) == 0 {
+		return ""
+	}
+	parts := []string{"timestamp=" + conf.StartFromTimestamp}
+	for key, offset := range conf.StartOffsets {
+		parts = append(parts, key+"="+strconv.FormatInt(offset, 10))
+	}
+	sort.Strings(parts[1:])
+	return strings.Join(parts, ",")
+}
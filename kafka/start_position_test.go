@@ -0,0 +1,48 @@
+package kafka
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseStartTimestamp(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	ts, err := parseStartTimestamp("", now)
+	assert.Nil(t, err)
+	assert.True(t, ts.IsZero())
+
+	ts, err = parseStartTimestamp("-2h", now)
+	assert.Nil(t, err)
+	assert.Equal(t, now.Add(-2*time.Hour), ts)
+
+	ts, err = parseStartTimestamp("1622548800000", now)
+	assert.Nil(t, err)
+	assert.True(t, now.Equal(ts))
+
+	ts, err = parseStartTimestamp("2021-06-01T12:00:00Z", now)
+	assert.Nil(t, err)
+	assert.True(t, now.Equal(ts))
+
+	_, err = parseStartTimestamp("yesterday", now)
+	assert.NotNil(t, err)
+}
+
+func TestParseStartOffsets(t *testing.T) {
+	offsets, err := parseStartOffsets(map[string]int64{"0": 10, "orders:1": 20, "orders:2": -2})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), offsets[""][0])
+	assert.Equal(t, int64(20), offsets["orders"][1])
+	assert.Equal(t, int64(-2), offsets["orders"][2])
+
+	_, err = parseStartOffsets(map[string]int64{"orders:x": 1})
+	assert.NotNil(t, err)
+}
+
+func TestStartMarker(t *testing.T) {
+	assert.Equal(t, "", startMarker(KafkaConf{}))
+	conf := KafkaConf{StartFromTimestamp: "-2h", StartOffsets: map[string]int64{"1": 5, "0": 3}}
+	assert.Equal(t, "timestamp=-2h,0=3,1=5", startMarker(conf))
+}
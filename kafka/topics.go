@@ -0,0 +1,28 @@
+package kafka
+
+import (
+	"regexp"
+)
+
+// topics returns topic and topics of the conf, without duplicates
+func (conf KafkaConf) topics() []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, topic := range append([]string{conf.Topic}, conf.Topics...) {
+		if topic != "" && !seen[topic] {
+			seen[topic] = true
+			result = append(result, topic)
+		}
+	}
+	return result
+}
+
+// compileTopicPattern compiles pattern to match whole topic names, like the
+// pattern subscriptions of the java kafka consumer. Returns nil for an empty
+// pattern.
+func compileTopicPattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	return regexp.Compile("^(?:" + pattern + ")$")
+}
@@ -0,0 +1,31 @@
+package kafka
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKafkaConfTopics(t *testing.T) {
+	conf := KafkaConf{Topic: "orders", Topics: []string{"payments", "orders"}}
+	assert.Equal(t, []string{"orders", "payments"}, conf.topics())
+
+	conf = KafkaConf{TopicPattern: "orders-.*"}
+	assert.Empty(t, conf.topics())
+}
+
+func TestCompileTopicPattern(t *testing.T) {
+	pattern, err := compileTopicPattern("")
+	assert.Nil(t, err)
+	assert.Nil(t, pattern)
+
+	pattern, err = compileTopicPattern("orders-.*|payments")
+	assert.Nil(t, err)
+	assert.True(t, pattern.MatchString("orders-eu"))
+	assert.True(t, pattern.MatchString("payments"))
+	assert.False(t, pattern.MatchString("payments-dlq"))
+	assert.False(t, pattern.MatchString("old-orders-eu"))
+
+	_, err = compileTopicPattern("orders-(")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,42 @@
+package logging
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+)
+
+type levelBody struct {
+	Level string `json:"level"`
+}
+
+// LevelHandler serves the log level, GET returns it and PUT or POST of
+// {"level": "debug"} changes it
+func LevelHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			var body levelBody
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				http.Error(w, "invalid body "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			level, err := logrus.ParseLevel(body.Level)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if level != GetLevel() {
+				root.Warnf("log level changed from %s to %s", GetLevel(), level)
+				SetLevel(level)
+			}
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(levelBody{Level: GetLevel().String()})
+	})
+}
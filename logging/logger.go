@@ -0,0 +1,162 @@
+package logging
+
+import (
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Format of the log lines
+type Format string
+
+const (
+	Text Format = "text"
+	JSON Format = "json"
+)
+
+// SamplingConf limits per message logs of a connection to Initial lines per
+// second, after which only every Thereafter-th line of that second is written
+type SamplingConf struct {
+	Initial    int `json:"initial"`
+	Thereafter int `json:"thereafter"`
+}
+
+const (
+	defaultSamplingInitial    = 10
+	defaultSamplingThereafter = 100
+)
+
+var (
+	root     = logrus.New()
+	sampling = SamplingConf{Initial: defaultSamplingInitial, Thereafter: defaultSamplingThereafter}
+)
+
+// configure sets up the root logger and routes the standard log package
+// through it at info level
+func configure(out io.Writer, format Format, level logrus.Level, samplingConf SamplingConf) {
+	root.SetOutput(out)
+	root.SetLevel(level)
+	switch format {
+	case JSON:
+		root.SetFormatter(&logrus.JSONFormatter{})
+	case Text, "":
+		root.SetFormatter(&logrus.TextFormatter{FullTimestamp: true, DisableColors: true})
+	default:
+		panic("Invalid log format " + string(format))
+	}
+	if samplingConf.Initial > 0 {
+		sampling.Initial = samplingConf.Initial
+	}
+	if samplingConf.Thereafter > 0 {
+		sampling.Thereafter = samplingConf.Thereafter
+	}
+
+	log.SetFlags(0)
+	log.SetOutput(levelWriter{logrus.InfoLevel})
+}
+
+// levelWriter writes every line as a log of the root logger at level. It
+// writes synchronously so nothing is lost on log.Fatal
+type levelWriter struct {
+	level logrus.Level
+}
+
+func (w levelWriter) Write(p []byte) (int, error) {
+	if root.IsLevelEnabled(w.level) {
+		root.Log(w.level, strings.TrimSpace(string(p)))
+	}
+	return len(p), nil
+}
+
+// DebugWriter returns a writer for the standard log package of libraries,
+// its lines are debug logs of the root logger
+func DebugWriter() io.Writer {
+	return levelWriter{logrus.DebugLevel}
+}
+
+// GetLevel returns the current log level
+func GetLevel() logrus.Level {
+	return root.GetLevel()
+}
+
+// SetLevel changes the log level of every logger at runtime
+func SetLevel(level logrus.Level) {
+	root.SetLevel(level)
+}
+
+// Logger is the logger of a connection, every line carries the connection
+// name and, for loggers derived with WithPartition, the topic and partition
+type Logger struct {
+	*logrus.Entry
+	sampler *sampler
+}
+
+// ForConnection returns a child logger of the root logger for the connection
+// name. Per message logs of the connection are sampled together
+func ForConnection(name string) *Logger {
+	return &Logger{
+		Entry:   root.WithField("connection", name),
+		sampler: &sampler{},
+	}
+}
+
+// WithPartition returns a child logger that adds topic and partition
+func (l *Logger) WithPartition(topic string, partition int32) *Logger {
+	return &Logger{
+		Entry:   l.WithFields(logrus.Fields{"topic": topic, "partition": partition}),
+		sampler: l.sampler,
+	}
+}
+
+// DebugEnabled returns true if debug logs are written, to skip building
+// arguments of debug logs otherwise
+func (l *Logger) DebugEnabled() bool {
+	return l.Logger.IsLevelEnabled(logrus.DebugLevel)
+}
+
+// SampledDebugf is Debugf for high volume per message logs, only a sample of
+// them is written as configured by SamplingConf
+func (l *Logger) SampledDebugf(format string, args ...interface{}) {
+	if l.DebugEnabled() && l.sampler.allow(time.Now()) {
+		l.Debugf(format, args...)
+	}
+}
+
+// SampledInfof is Infof for high volume per message logs, only a sample of
+// them is written as configured by SamplingConf
+func (l *Logger) SampledInfof(format string, args ...interface{}) {
+	if l.Logger.IsLevelEnabled(logrus.InfoLevel) && l.sampler.allow(time.Now()) {
+		l.Infof(format, args...)
+	}
+}
+
+// sampler counts the lines of the current second
+type sampler struct {
+	l      sync.Mutex
+	second int64
+	count  int
+}
+
+func (s *sampler) allow(now time.Time) bool {
+	s.l.Lock()
+	defer s.l.Unlock()
+	if second := now.Unix(); second != s.second {
+		s.second = second
+		s.count = 0
+	}
+	s.count++
+	if s.count <= sampling.Initial {
+		return true
+	}
+	return (s.count-sampling.Initial)%sampling.Thereafter == 0
+}
+
+func init() {
+	root.SetOutput(os.Stderr)
+	root.SetFormatter(&logrus.TextFormatter{FullTimestamp: true, DisableColors: true})
+}
@@ -0,0 +1,83 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnectionLoggerFields(t *testing.T) {
+	var out bytes.Buffer
+	configure(&out, JSON, logrus.InfoLevel, SamplingConf{})
+
+	ForConnection("orders").WithPartition("orders-topic", 3).Info("started")
+	var line map[string]interface{}
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &line))
+	assert.Equal(t, "orders", line["connection"])
+	assert.Equal(t, "orders-topic", line["topic"])
+	assert.Equal(t, float64(3), line["partition"])
+	assert.Equal(t, "started", line["msg"])
+
+	out.Reset()
+	log.Printf("legacy %d \n", 1)
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &line))
+	assert.Equal(t, "legacy 1", line["msg"])
+	assert.Equal(t, "info", line["level"])
+}
+
+func TestSampler(t *testing.T) {
+	configure(&bytes.Buffer{}, Text, logrus.InfoLevel, SamplingConf{Initial: 2, Thereafter: 3})
+	s := &sampler{}
+	now := time.Unix(100, 0)
+
+	var allowed []bool
+	for i := 0; i < 8; i++ {
+		allowed = append(allowed, s.allow(now))
+	}
+	assert.Equal(t, []bool{true, true, false, false, true, false, false, true}, allowed)
+	assert.True(t, s.allow(now.Add(time.Second)), "a new second starts over")
+}
+
+func TestSampledDebugf(t *testing.T) {
+	var out bytes.Buffer
+	configure(&out, Text, logrus.InfoLevel, SamplingConf{Initial: 1, Thereafter: 1000})
+	l := ForConnection("orders")
+
+	l.SampledDebugf("dropped at info")
+	assert.Empty(t, out.String())
+
+	SetLevel(logrus.DebugLevel)
+	defer SetLevel(logrus.InfoLevel)
+	l.SampledDebugf("first")
+	l.SampledDebugf("second")
+	assert.Equal(t, 1, strings.Count(out.String(), "\n"))
+	assert.Contains(t, out.String(), "first")
+}
+
+func TestLevelHandler(t *testing.T) {
+	configure(&bytes.Buffer{}, Text, logrus.InfoLevel, SamplingConf{})
+	h := LevelHandler()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/admin/log/level", nil))
+	assert.JSONEq(t, `{"level": "info"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("PUT", "/admin/log/level", strings.NewReader(`{"level": "debug"}`)))
+	assert.JSONEq(t, `{"level": "debug"}`, w.Body.String())
+	assert.Equal(t, logrus.DebugLevel, GetLevel())
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("PUT", "/admin/log/level", strings.NewReader(`{"level": "loud"}`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, logrus.DebugLevel, GetLevel())
+	SetLevel(logrus.InfoLevel)
+}
@@ -2,9 +2,10 @@ package logging
 
 import (
 	"encoding/json"
-	"log"
+	"io"
 	"os"
 
+	"github.com/sirupsen/logrus"
 	"gopkg.in/natefinch/lumberjack.v2"
 )
 
@@ -20,6 +21,10 @@ const (
 type LogConf struct {
 	Type   AppenderType `json:"type"`
 	Config interface{}  `json:"config"`
+
+	Level    string       `json:"level"`    //debug, info, warn or error. Defaults to debug if enable_debug is set, info otherwise
+	Format   Format       `json:"format"`   //text or json, defaults to text
+	Sampling SamplingConf `json:"sampling"` //sampling of per message logs
 }
 
 type ConsoleBasedConf struct {
@@ -47,27 +52,40 @@ type DMuxLogging struct{
 
 //Start starting logging
 func (c *DMuxLogging) Start(logConf LogConf) {
+	var out io.Writer
 	switch logConf.Type {
 	case Console:
 		// handling for console
-		log.SetOutput(os.Stdout)
+		out = os.Stdout
 		data, _ := json.Marshal(logConf.Config)
 		var config *ConsoleBasedConf
 		json.Unmarshal(data, &config)
-		c.EnableDebug = config.EnableDebug
+		c.EnableDebug = config != nil && config.EnableDebug
 	case File:
 		data, _ := json.Marshal(logConf.Config)
 		var config *FileBasedConf
 		json.Unmarshal(data, &config)
-		log.SetOutput(&lumberjack.Logger{
+		out = &lumberjack.Logger{
 			Filename:   config.Path,
 			MaxSize:    config.Rotate.FileSize, // megabytes
 			MaxBackups: config.Rotate.NoOfFiles,
 			MaxAge:     config.Rotate.RotationDays, //days
 			Compress:   config.Rotate.Compress,     // disabled by default
-		})
+		}
 		c.EnableDebug = config.EnableDebug
 	default:
 		panic("Invalid logger type")
 	}
+
+	level := logrus.InfoLevel
+	if c.EnableDebug {
+		level = logrus.DebugLevel
+	}
+	if logConf.Level != "" {
+		var err error
+		if level, err = logrus.ParseLevel(logConf.Level); err != nil {
+			panic("Invalid log level " + logConf.Level)
+		}
+	}
+	configure(out, logConf.Format, level, logConf.Sampling)
 }
@@ -1,12 +1,18 @@
 package main
 
 import (
+	"flag"
+	"github.com/flipkart-incubator/go-dmux/admin"
+	"github.com/flipkart-incubator/go-dmux/alerting"
 	co "github.com/flipkart-incubator/go-dmux/config"
+	"github.com/flipkart-incubator/go-dmux/health"
 	"github.com/flipkart-incubator/go-dmux/metrics"
 	"log"
 	"os"
+	"sync"
 
 	"github.com/flipkart-incubator/go-dmux/logging"
+	"github.com/flipkart-incubator/go-dmux/tracing"
 )
 
 //
@@ -17,6 +23,11 @@ func main() {
 	args := os.Args[1:]
 	sz := len(args)
 
+	if sz > 0 && args[0] == "replay" {
+		replay(args[1:])
+		return
+	}
+
 	var path string
 
 	if sz == 1 {
@@ -34,14 +45,65 @@ func main() {
 	log.Printf("config: %v \n", conf)
 
 	//start showing metrics at the endpoint
-	metrics.Start(conf.MetricPort)
+	metrics.Start(conf.Metrics, conf.MetricPort, conf.LegacyOffsetMetrics)
+
+	//start tracing, if enabled
+	tracing.Start(conf.Tracing)
+
+	//start evaluating alerts
+	alerting.Start(conf.Alerting)
+
+	//start admin endpoints
+	health.Start(conf.Health)
+	admin.Handle("/admin/log/level", logging.LevelHandler())
+	admin.Handle("/health/live", health.LiveHandler())
+	admin.Handle("/health/ready", health.ReadyHandler())
+	admin.Start(conf.AdminPort)
 
+	var wg sync.WaitGroup
 	for _, item := range conf.DMuxItems {
-		go func(connType co.ConnectionType, connConf interface{}, logDebug bool) {
-			connType.Start(connConf, logDebug, nil)
-		}(item.ConnType, item.Connection, dmuxLogging.EnableDebug)
+		wg.Add(1)
+		go func(name string, connType co.ConnectionType, connConf interface{}) {
+			defer wg.Done()
+			connType.Run(name, connConf, nil)
+		}(item.Name, item.ConnType, item.Connection)
+	}
+
+	//main thread halts till all connections return, which only bounded
+	//replays do. TODO make changes to listen to kill and reboot
+	wg.Wait()
+}
+
+// replay runs a single kafka dmuxItem of the config over a bounded range with
+// an ephemeral consumer group and returns once the range is processed
+//
+//	go-dmux replay -item <name> [-from <time>] [-to <time>] <config path>
+func replay(args []string) {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	name := flags.String("item", "", "name of the dmuxItem to replay")
+	from := flags.String("from", "", "start of the replay, RFC3339, epoch millis or relative like -2h. Defaults to the oldest offset")
+	to := flags.String("to", "", "end of the replay, same format as -from. Defaults to the newest offset")
+	flags.Parse(args)
+
+	dconf := co.DMuxConfigSetting{
+		FilePath: flags.Arg(0),
 	}
+	conf := dconf.GetDmuxConf()
 
-	//main thread halts. TODO make changes to listen to kill and reboot
-	select {}
+	dmuxLogging := new(logging.DMuxLogging)
+	dmuxLogging.Start(conf.Logging)
+	tracing.Start(conf.Tracing)
+
+	for _, item := range conf.DMuxItems {
+		if item.Name != *name {
+			continue
+		}
+		connConf, err := item.ReplayConnection(*from, *to)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		item.ConnType.Run(item.Name, connConf, nil)
+		return
+	}
+	log.Fatalf("no dmuxItem named %q in %s", *name, flags.Arg(0))
 }
@@ -0,0 +1,108 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+)
+
+type kind int
+
+const (
+	gauge kind = iota
+	counter
+	histogram
+)
+
+// family describes how every backend publishes a MetricType
+type family struct {
+	name    string
+	help    string
+	kind    kind
+	labels  []string
+	buckets []float64 // upper bounds of histogram buckets, in the unit of observed
+}
+
+var (
+	partitionLabels  = []string{"connection", "consumer_group", "topic", "partition"}
+	connectionLabels = []string{"connection", "consumer_group"}
+	workerLabels     = []string{"connection", "worker"}
+
+	durationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	sizeBuckets     = []float64{1, 2, 4, 8, 16, 32, 64, 128, 256, 512, 1024}
+
+	families = map[MetricType]family{
+		SourceOffset:   {"dmux_source_offset", "Offset of the last message read by the source", gauge, partitionLabels, nil},
+		SinkOffset:     {"dmux_sink_offset", "Offset committed once every message up to it was processed by the sink", gauge, partitionLabels, nil},
+		ProducerOffset: {"dmux_producer_offset", "Offset of the newest message of the partition", gauge, partitionLabels, nil},
+		ConsumerOffset: {"dmux_consumer_offset", "Offset the consumer has fetched up to", gauge, partitionLabels, nil},
+		Lag:            {"dmux_consumer_lag", "Messages produced but not yet fetched by the consumer", gauge, partitionLabels, nil},
+		PartitionOwned: {"dmux_partition_owned", "1 while the partition is claimed by this instance", gauge, partitionLabels, nil},
+
+		OffsetMonitorHealthy:  {"dmux_offset_monitor_healthy", "1 while the polls of the offset monitor succeed", gauge, connectionLabels, nil},
+		OffsetMonitorLastPoll: {"dmux_offset_monitor_last_poll_timestamp_seconds", "Unix time of the last successful poll of the offset monitor", gauge, connectionLabels, nil},
+
+		HTTPRequestDuration: {"dmux_http_request_duration_seconds", "Latency of sink http calls", histogram, []string{"connection"}, durationBuckets},
+		HTTPResponses:       {"dmux_http_responses_total", "Sink http calls by status code, error if no response was received", counter, []string{"connection", "code"}, nil},
+		HTTPRetries:         {"dmux_http_retries_total", "Sink http calls that were retried", counter, []string{"connection"}, nil},
+		QueueDepth:          {"dmux_queue_depth", "Messages waiting in the queue of a dmux worker", gauge, workerLabels, nil},
+		Distributed:         {"dmux_messages_distributed_total", "Messages distributed to a dmux worker", counter, workerLabels, nil},
+		BatchSize:           {"dmux_batch_size", "Messages per batch handed to the sink", histogram, []string{"connection"}, sizeBuckets},
+		Sidelined:           {"dmux_sidelined_total", "Messages sidelined", counter, []string{"connection"}, nil},
+		AlreadySidelined:    {"dmux_already_sidelined_total", "Messages skipped as they were already sidelined", counter, []string{"connection"}, nil},
+		Parked:              {"dmux_parked_total", "Keys parked after their message failed the retries of the sink", counter, []string{"connection"}, nil},
+
+		AlertFiring: {"dmux_alert_firing", "1 while the alert fires, topic and partition are empty for alerts of the connection", gauge, []string{"connection", "alert", "topic", "partition"}, nil},
+
+		Workers: {"dmux_workers", "Workers of the dmux as decided by autoscale", gauge, []string{"connection"}, nil},
+		Resizes: {"dmux_resizes_total", "Resizes decided by autoscale by direction", counter, []string{"connection", "direction"}, nil},
+
+		FilterMatches: {"dmux_filter_matches_total", "Messages matching a filter rule", counter, []string{"connection", "rule"}, nil},
+		Filtered:      {"dmux_filtered_total", "Messages dropped by the filter", counter, []string{"connection"}, nil},
+
+		TransformErrors: {"dmux_transform_errors_total", "Messages the sink failed to transform", counter, []string{"connection"}, nil},
+
+		PluginErrors: {"dmux_plugin_errors_total", "Failed calls of a plugin function, including timeouts", counter, []string{"connection", "function"}, nil},
+
+		FanOutLag:       {"dmux_fanout_lag", "Messages handed to a fan-out sink and not delivered yet", gauge, []string{"connection", "sink"}, nil},
+		FanOutDelivered: {"dmux_fanout_delivered_total", "Messages delivered or sidelined by a fan-out sink", counter, []string{"connection", "sink"}, nil},
+		FanOutSkipped:   {"dmux_fanout_skipped_total", "Messages an optional fan-out sink skipped as it was too far behind", counter, []string{"connection", "sink"}, nil},
+	}
+)
+
+// labelValues returns the values of the labels of the family of metric, in order
+func labelValues(metric Metric) []string {
+	l := metric.Labels
+	switch metric.Type {
+	case OffsetMonitorHealthy, OffsetMonitorLastPoll:
+		return []string{l.Connection, l.ConsumerGroup}
+	case QueueDepth, Distributed:
+		return []string{l.Connection, strconv.Itoa(l.Worker)}
+	case HTTPResponses:
+		return []string{l.Connection, l.Code}
+	case Resizes:
+		return []string{l.Connection, l.Direction}
+	case FilterMatches:
+		return []string{l.Connection, l.Rule}
+	case PluginErrors:
+		return []string{l.Connection, l.Function}
+	case FanOutLag, FanOutDelivered, FanOutSkipped:
+		return []string{l.Connection, l.Sink}
+	case HTTPRetries, Sidelined, AlreadySidelined, Parked, HTTPRequestDuration, BatchSize, Workers, Filtered, TransformErrors:
+		return []string{l.Connection}
+	case AlertFiring:
+		if l.Topic == "" {
+			return []string{l.Connection, l.Alert, "", ""}
+		}
+		return []string{l.Connection, l.Alert, l.Topic, strconv.Itoa(int(l.Partition))}
+	default:
+		return []string{l.Connection, l.ConsumerGroup, l.Topic, strconv.Itoa(int(l.Partition))}
+	}
+}
+
+// observed converts the Value of metric to the unit of its family
+func observed(metric Metric) float64 {
+	if metric.Type == HTTPRequestDuration {
+		return time.Duration(metric.Value).Seconds()
+	}
+	return float64(metric.Value)
+}
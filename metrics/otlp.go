@@ -0,0 +1,284 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OTLPConf holds the configuration of the OpenTelemetry push backend
+type OTLPConf struct {
+	Endpoint    string            `json:"endpoint"`     //metrics url of the collector, defaults to http://localhost:4318/v1/metrics
+	Headers     map[string]string `json:"headers"`      //added to every push, e.g. for authentication
+	Interval    string            `json:"interval"`     //time between pushes, defaults to 10s
+	ServiceName string            `json:"service_name"` //service.name of the resource, defaults to go-dmux
+}
+
+const (
+	defaultOTLPEndpoint    = "http://localhost:4318/v1/metrics"
+	defaultOTLPInterval    = 10 * time.Second
+	defaultOTLPServiceName = "go-dmux"
+
+	otlpCumulative = 2 // AGGREGATION_TEMPORALITY_CUMULATIVE
+)
+
+// OTLPRegistry aggregates the metrics in memory and pushes all of them with
+// cumulative temporality to an OpenTelemetry collector every interval, using
+// the http/json encoding of OTLP
+type OTLPRegistry struct {
+	conf    OTLPConf
+	client  *http.Client
+	started time.Time
+
+	l      sync.Mutex
+	points map[string]*otlpPoint
+}
+
+// otlpPoint is the aggregated state of one label set of a family
+type otlpPoint struct {
+	metricType MetricType
+	labels     []string
+	value      int64    // last value of a gauge, sum of a counter
+	count      uint64   // observations of a histogram
+	sum        float64  // sum of the observations of a histogram
+	buckets    []uint64 // observations per bucket of a histogram, the last one is +Inf
+}
+
+func (o *OTLPRegistry) start(config interface{}) {
+	decodeConf(config, &o.conf)
+	if o.conf.Endpoint == "" {
+		o.conf.Endpoint = defaultOTLPEndpoint
+	}
+	if o.conf.ServiceName == "" {
+		o.conf.ServiceName = defaultOTLPServiceName
+	}
+	interval := defaultOTLPInterval
+	if o.conf.Interval != "" {
+		var err error
+		if interval, err = time.ParseDuration(o.conf.Interval); err != nil {
+			log.Fatal("invalid otlp interval " + err.Error())
+		}
+	}
+
+	o.client = &http.Client{Timeout: interval}
+	o.started = time.Now()
+	o.l.Lock()
+	o.points = make(map[string]*otlpPoint)
+	o.l.Unlock()
+	go o.pushLoop(interval)
+}
+
+func (o *OTLPRegistry) ingest(metric Metric) {
+	f, ok := families[metric.Type]
+	if !ok {
+		return
+	}
+	labels := labelValues(metric)
+	key := f.name + "\xff" + strings.Join(labels, "\xff")
+
+	o.l.Lock()
+	defer o.l.Unlock()
+	if o.points == nil {
+		return
+	}
+	point, ok := o.points[key]
+	if !ok {
+		point = &otlpPoint{metricType: metric.Type, labels: labels}
+		if f.kind == histogram {
+			point.buckets = make([]uint64, len(f.buckets)+1)
+		}
+		o.points[key] = point
+	}
+	switch f.kind {
+	case gauge:
+		point.value = metric.Value
+	case counter:
+		point.value += metric.Value
+	case histogram:
+		v := observed(metric)
+		point.count++
+		point.sum += v
+		point.buckets[sort.SearchFloat64s(f.buckets, v)]++
+	}
+}
+
+func (o *OTLPRegistry) pushLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := o.push(); err != nil {
+			log.Printf("failed to push otlp metrics %s \n", err.Error())
+		}
+	}
+}
+
+func (o *OTLPRegistry) push() error {
+	payload, err := json.Marshal(o.export(time.Now()))
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("POST", o.conf.Endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for key, val := range o.conf.Headers {
+		request.Header.Set(key, val)
+	}
+	response, err := o.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	io.Copy(ioutil.Discard, response.Body)
+	if response.StatusCode >= 300 {
+		return errors.New("collector responded " + strconv.Itoa(response.StatusCode))
+	}
+	return nil
+}
+
+// export snapshots every point as an ExportMetricsServiceRequest
+func (o *OTLPRegistry) export(now time.Time) otlpRequest {
+	start := strconv.FormatInt(o.started.UnixNano(), 10)
+	ts := strconv.FormatInt(now.UnixNano(), 10)
+
+	o.l.Lock()
+	byName := make(map[string]*otlpMetric)
+	for _, point := range o.points {
+		f := families[point.metricType]
+		m, ok := byName[f.name]
+		if !ok {
+			m = &otlpMetric{Name: f.name, Description: f.help}
+			switch f.kind {
+			case gauge:
+				m.Gauge = &otlpGauge{}
+			case counter:
+				m.Sum = &otlpSum{AggregationTemporality: otlpCumulative, IsMonotonic: true}
+			case histogram:
+				m.Histogram = &otlpHistogram{AggregationTemporality: otlpCumulative}
+			}
+			byName[f.name] = m
+		}
+		attributes := make([]otlpAttribute, len(point.labels))
+		for i, value := range point.labels {
+			attributes[i] = otlpAttribute{Key: f.labels[i], Value: otlpValue{StringValue: value}}
+		}
+		switch f.kind {
+		case gauge:
+			m.Gauge.DataPoints = append(m.Gauge.DataPoints, otlpNumberPoint{
+				Attributes: attributes, TimeUnixNano: ts, AsInt: strconv.FormatInt(point.value, 10)})
+		case counter:
+			m.Sum.DataPoints = append(m.Sum.DataPoints, otlpNumberPoint{
+				Attributes: attributes, StartTimeUnixNano: start, TimeUnixNano: ts, AsInt: strconv.FormatInt(point.value, 10)})
+		case histogram:
+			buckets := make([]string, len(point.buckets))
+			for i, c := range point.buckets {
+				buckets[i] = strconv.FormatUint(c, 10)
+			}
+			m.Histogram.DataPoints = append(m.Histogram.DataPoints, otlpHistogramPoint{
+				Attributes: attributes, StartTimeUnixNano: start, TimeUnixNano: ts,
+				Count: strconv.FormatUint(point.count, 10), Sum: point.sum,
+				BucketCounts: buckets, ExplicitBounds: f.buckets})
+		}
+	}
+	o.l.Unlock()
+
+	exported := make([]otlpMetric, 0, len(byName))
+	for _, m := range byName {
+		exported = append(exported, *m)
+	}
+	sort.Slice(exported, func(i, j int) bool { return exported[i].Name < exported[j].Name })
+
+	return otlpRequest{ResourceMetrics: []otlpResourceMetrics{{
+		Resource: otlpResource{Attributes: []otlpAttribute{
+			{Key: "service.name", Value: otlpValue{StringValue: o.conf.ServiceName}},
+		}},
+		ScopeMetrics: []otlpScopeMetrics{{
+			Scope:   otlpScope{Name: defaultOTLPServiceName},
+			Metrics: exported,
+		}},
+	}}}
+}
+
+// json encoding of the OTLP ExportMetricsServiceRequest, 64 bit integers are
+// strings as per the protobuf json mapping
+
+type otlpRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpMetric struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Gauge       *otlpGauge     `json:"gauge,omitempty"`
+	Sum         *otlpSum       `json:"sum,omitempty"`
+	Histogram   *otlpHistogram `json:"histogram,omitempty"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpNumberPoint `json:"dataPoints"`
+}
+
+type otlpSum struct {
+	AggregationTemporality int               `json:"aggregationTemporality"`
+	IsMonotonic            bool              `json:"isMonotonic"`
+	DataPoints             []otlpNumberPoint `json:"dataPoints"`
+}
+
+type otlpNumberPoint struct {
+	Attributes        []otlpAttribute `json:"attributes"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string          `json:"timeUnixNano"`
+	AsInt             string          `json:"asInt"`
+}
+
+type otlpHistogram struct {
+	AggregationTemporality int                  `json:"aggregationTemporality"`
+	DataPoints             []otlpHistogramPoint `json:"dataPoints"`
+}
+
+type otlpHistogramPoint struct {
+	Attributes        []otlpAttribute `json:"attributes"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	TimeUnixNano      string          `json:"timeUnixNano"`
+	Count             string          `json:"count"`
+	Sum               float64         `json:"sum"`
+	BucketCounts      []string        `json:"bucketCounts"`
+	ExplicitBounds    []float64       `json:"explicitBounds"`
+}
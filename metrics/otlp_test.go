@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOTLPExport(t *testing.T) {
+	o := new(OTLPRegistry)
+	o.points = make(map[string]*otlpPoint)
+	o.conf.ServiceName = "dmux-test"
+
+	o.ingest(Metric{Type: Lag, Value: 5, Labels: Labels{Connection: "orders", ConsumerGroup: "orders-cg", Topic: "orders", Partition: 1}})
+	o.ingest(Metric{Type: Lag, Value: 3, Labels: Labels{Connection: "orders", ConsumerGroup: "orders-cg", Topic: "orders", Partition: 1}})
+	o.ingest(Metric{Type: Sidelined, Value: 1, Labels: Labels{Connection: "orders"}})
+	o.ingest(Metric{Type: Sidelined, Value: 2, Labels: Labels{Connection: "orders"}})
+	o.ingest(Metric{Type: BatchSize, Value: 3, Labels: Labels{Connection: "orders"}})
+	o.ingest(Metric{Type: BatchSize, Value: 4, Labels: Labels{Connection: "orders"}})
+	o.ingest(Metric{Type: BatchSize, Value: 5000, Labels: Labels{Connection: "orders"}})
+
+	req := o.export(time.Unix(10, 0))
+	assert.Equal(t, "dmux-test", req.ResourceMetrics[0].Resource.Attributes[0].Value.StringValue)
+	exported := req.ResourceMetrics[0].ScopeMetrics[0].Metrics
+	assert.Len(t, exported, 3)
+
+	batch := exported[0]
+	assert.Equal(t, "dmux_batch_size", batch.Name)
+	point := batch.Histogram.DataPoints[0]
+	assert.Equal(t, "3", point.Count)
+	assert.Equal(t, float64(5007), point.Sum)
+	assert.Equal(t, []string{"0", "0", "2", "0", "0", "0", "0", "0", "0", "0", "0", "1"}, point.BucketCounts)
+
+	lag := exported[1]
+	assert.Equal(t, "dmux_consumer_lag", lag.Name)
+	assert.Equal(t, "3", lag.Gauge.DataPoints[0].AsInt)
+	assert.Equal(t, "10000000000", lag.Gauge.DataPoints[0].TimeUnixNano)
+	assert.Equal(t, otlpAttribute{Key: "partition", Value: otlpValue{StringValue: "1"}}, lag.Gauge.DataPoints[0].Attributes[3])
+
+	sidelined := exported[2]
+	assert.Equal(t, "dmux_sidelined_total", sidelined.Name)
+	assert.True(t, sidelined.Sum.IsMonotonic)
+	assert.Equal(t, otlpCumulative, sidelined.Sum.AggregationTemporality)
+	assert.Equal(t, "3", sidelined.Sum.DataPoints[0].AsInt)
+}
+
+func TestOTLPPush(t *testing.T) {
+	requests := make(chan *http.Request, 10)
+	bodies := make(chan []byte, 10)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests <- r
+		bodies <- body
+	}))
+	defer collector.Close()
+
+	o := new(OTLPRegistry)
+	o.start(map[string]interface{}{
+		"endpoint": collector.URL + "/v1/metrics",
+		"interval": "20ms",
+		"headers":  map[string]string{"Authorization": "Bearer token"},
+	})
+	o.ingest(Metric{Type: HTTPRetries, Value: 1, Labels: Labels{Connection: "orders"}})
+
+	r := <-requests
+	assert.Equal(t, "/v1/metrics", r.URL.Path)
+	assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+	assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+
+	var req otlpRequest
+	assert.NoError(t, json.Unmarshal(<-bodies, &req))
+	assert.Equal(t, "go-dmux", req.ResourceMetrics[0].Resource.Attributes[0].Value.StringValue)
+	assert.Equal(t, "dmux_http_retries_total", req.ResourceMetrics[0].ScopeMetrics[0].Metrics[0].Name)
+}
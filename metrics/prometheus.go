@@ -1,53 +1,110 @@
 package metrics
 
 import (
-	"flag"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"log"
 	"net/http"
 	"strconv"
 )
 
-var (
-	// initialize all the metrics here
-	offsetMetrics = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "offset_metrics",
-			Help: "The metric represent all offset related metrics for dmux",
-		}, []string{"key"})
-)
-
-type PrometheusConfig struct {
-	//metricPort to which the metrics would be sent
-	metricPort int
+// PrometheusConf holds the configuration of the prometheus backend
+type PrometheusConf struct {
+	Port int `json:"port"` //port of the /metrics endpoint, defaults to metric_port
 }
+
+// PrometheusRegistry serves the metrics on the /metrics endpoint of its own
+// port. Every PrometheusRegistry has its own collectors, so several of them
+// can run at once
 type PrometheusRegistry struct {
-	// stateless
+	metricPort          int
+	legacyOffsetMetrics bool
+
+	offsetMetrics *prometheus.GaugeVec
+	gauges        map[MetricType]*prometheus.GaugeVec
+	counters      map[MetricType]*prometheus.CounterVec
+	histograms    map[MetricType]*prometheus.HistogramVec
 }
 
-func (p PrometheusRegistry) start(config interface{}) {
-	pConfig, ok := config.(PrometheusConfig)
-	if !ok {
-		log.Println("error in starting metric ingestion - invalid config")
-		return
+func newPrometheusRegistry(metricPort int, legacyOffsetMetrics bool) *PrometheusRegistry {
+	p := &PrometheusRegistry{
+		metricPort:          metricPort,
+		legacyOffsetMetrics: legacyOffsetMetrics,
+		offsetMetrics: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "offset_metrics",
+				Help: "The metric represent all offset related metrics for dmux",
+			}, []string{"key"}),
+		gauges:     make(map[MetricType]*prometheus.GaugeVec),
+		counters:   make(map[MetricType]*prometheus.CounterVec),
+		histograms: make(map[MetricType]*prometheus.HistogramVec),
 	}
+	for metricType, f := range families {
+		switch f.kind {
+		case gauge:
+			p.gauges[metricType] = prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: f.name, Help: f.help}, f.labels)
+		case counter:
+			p.counters[metricType] = prometheus.NewCounterVec(prometheus.CounterOpts{Name: f.name, Help: f.help}, f.labels)
+		case histogram:
+			p.histograms[metricType] = prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: f.name, Help: f.help, Buckets: f.buckets}, f.labels)
+		}
+	}
+	return p
+}
 
-	//The metrics can be fetched by a Get request from the http://localhost:9999/metrics end point
-	go func(config PrometheusConfig) {
-		addr := flag.String("listen-address", ":"+strconv.Itoa(config.metricPort), "The address to listen on for HTTP requests.")
-		http.Handle("/metrics", promhttp.Handler())
-		log.Fatal(http.ListenAndServe(*addr, nil))
-	}(pConfig)
-
+// registered returns every collector the registry serves
+func (p *PrometheusRegistry) registered() []prometheus.Collector {
+	cs := []prometheus.Collector{
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	}
 	//register collector for offset metrics
-	prometheus.MustRegister(offsetMetrics)
+	if p.legacyOffsetMetrics {
+		cs = append(cs, p.offsetMetrics)
+	}
+	for _, metric := range p.gauges {
+		cs = append(cs, metric)
+	}
+	for _, metric := range p.counters {
+		cs = append(cs, metric)
+	}
+	for _, metric := range p.histograms {
+		cs = append(cs, metric)
+	}
+	return cs
+}
+
+func (p *PrometheusRegistry) start(config interface{}) {
+	var conf PrometheusConf
+	decodeConf(config, &conf)
+	if conf.Port <= 0 {
+		conf.Port = p.metricPort
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(p.registered()...)
+
+	//The metrics can be fetched by a Get request from the http://localhost:9999/metrics end point
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	go func(addr string) {
+		log.Fatal(http.ListenAndServe(addr, mux))
+	}(":" + strconv.Itoa(conf.Port))
 }
 
 //Ingest metrics as and when events are received
-func (p PrometheusRegistry) ingest(metric Metric) {
-	switch metric.Type {
-	case Offset:
-		offsetMetrics.WithLabelValues(metric.Name).Set(float64(metric.Value))
+func (p *PrometheusRegistry) ingest(metric Metric) {
+	if p.legacyOffsetMetrics && metric.Name != "" {
+		p.offsetMetrics.WithLabelValues(metric.Name).Set(float64(metric.Value))
+	}
+	if vec, ok := p.gauges[metric.Type]; ok {
+		vec.WithLabelValues(labelValues(metric)...).Set(float64(metric.Value))
+	}
+	if vec, ok := p.counters[metric.Type]; ok {
+		vec.WithLabelValues(labelValues(metric)...).Add(float64(metric.Value))
+	}
+	if vec, ok := p.histograms[metric.Type]; ok {
+		vec.WithLabelValues(labelValues(metric)...).Observe(observed(metric))
 	}
 }
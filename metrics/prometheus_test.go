@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIngestLabeledMetric(t *testing.T) {
+	labels := Labels{Connection: "orders", ConsumerGroup: "orders-cg", Topic: "orders", Partition: 3}
+
+	p := newPrometheusRegistry(0, false)
+	p.ingest(Metric{Type: Lag, Name: "lag_producer_consumer.orders-cg.orders.3", Value: 42, Labels: labels})
+	assert.Equal(t, float64(42), testutil.ToFloat64(p.gauges[Lag].WithLabelValues("orders", "orders-cg", "orders", "3")))
+	assert.Equal(t, 0, testutil.CollectAndCount(p.offsetMetrics))
+
+	p = newPrometheusRegistry(0, true)
+	p.ingest(Metric{Type: Lag, Name: "lag_producer_consumer.orders-cg.orders.3", Value: 7, Labels: labels})
+	assert.Equal(t, float64(7), testutil.ToFloat64(p.gauges[Lag].WithLabelValues("orders", "orders-cg", "orders", "3")))
+	assert.Equal(t, float64(7), testutil.ToFloat64(p.offsetMetrics.WithLabelValues("lag_producer_consumer.orders-cg.orders.3")))
+
+	p.ingest(Metric{Type: OffsetMonitorHealthy, Value: 1, Labels: Labels{Connection: "orders", ConsumerGroup: "orders-cg"}})
+	assert.Equal(t, float64(1), testutil.ToFloat64(p.gauges[OffsetMonitorHealthy].WithLabelValues("orders", "orders-cg")))
+}
+
+func TestIngestCountersAndHistograms(t *testing.T) {
+	p := newPrometheusRegistry(0, false)
+	p.ingest(Metric{Type: HTTPResponses, Value: 1, Labels: Labels{Connection: "orders", Code: "503"}})
+	p.ingest(Metric{Type: HTTPResponses, Value: 1, Labels: Labels{Connection: "orders", Code: "503"}})
+	assert.Equal(t, float64(2), testutil.ToFloat64(p.counters[HTTPResponses].WithLabelValues("orders", "503")))
+
+	p.ingest(Metric{Type: Distributed, Value: 5, Labels: Labels{Connection: "orders", Worker: 2}})
+	assert.Equal(t, float64(5), testutil.ToFloat64(p.counters[Distributed].WithLabelValues("orders", "2")))
+
+	p.ingest(Metric{Type: QueueDepth, Value: 9, Labels: Labels{Connection: "orders", Worker: 2}})
+	p.ingest(Metric{Type: QueueDepth, Value: 4, Labels: Labels{Connection: "orders", Worker: 2}})
+	assert.Equal(t, float64(4), testutil.ToFloat64(p.gauges[QueueDepth].WithLabelValues("orders", "2")))
+
+	p.ingest(Metric{Type: HTTPRequestDuration, Value: int64(250 * time.Millisecond), Labels: Labels{Connection: "orders"}})
+	assert.Equal(t, 1, testutil.CollectAndCount(p.histograms[HTTPRequestDuration]))
+	assert.Equal(t, 0.25, observed(Metric{Type: HTTPRequestDuration, Value: int64(250 * time.Millisecond)}))
+	assert.Equal(t, float64(16), observed(Metric{Type: BatchSize, Value: 16}))
+}
+
+func TestPrometheusServesOwnMux(t *testing.T) {
+	port := freePort(t)
+	p := newPrometheusRegistry(0, false)
+	p.start(map[string]interface{}{"port": port})
+	p.ingest(Metric{Type: Sidelined, Value: 3, Labels: Labels{Connection: "orders"}})
+
+	var body []byte
+	assert.Eventually(t, func() bool {
+		resp, err := http.Get("http://localhost:" + strconv.Itoa(port) + "/metrics")
+		if err != nil {
+			return false
+		}
+		defer resp.Body.Close()
+		body, _ = ioutil.ReadAll(resp.Body)
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Contains(t, string(body), `dmux_sidelined_total{connection="orders"} 3`)
+
+	// the default mux is left alone
+	_, pattern := http.DefaultServeMux.Handler(httptest.NewRequest("GET", "/metrics", nil))
+	assert.Empty(t, pattern)
+}
+
+func freePort(t *testing.T) int {
+	l, err := net.Listen("tcp", "localhost:0")
+	assert.NoError(t, err)
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
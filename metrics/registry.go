@@ -1,17 +1,96 @@
 package metrics
 
+import "encoding/json"
+
 type MetricType int64
 
 const (
 	defaultMetricPort int        = 9999
-	Offset            MetricType = iota
+	Offset            MetricType = iota // legacy, Name is the key of offset_metrics
+
+	SourceOffset   // offset read by the source
+	SinkOffset     // offset committed once processed by the sink
+	ProducerOffset // newest offset of a partition
+	ConsumerOffset // offset the consumer fetched up to
+	Lag            // producer offset - consumer offset
+	PartitionOwned // 1 while the partition is claimed by this instance
+
+	OffsetMonitorHealthy  // 1 while the polls of the offset monitor succeed, Labels without topic and partition
+	OffsetMonitorLastPoll // unix time of the last successful poll, Labels without topic and partition
+
+	HTTPRequestDuration // nanoseconds taken by a sink http call, Labels with only connection
+	HTTPResponses       // count of sink http calls by Labels.Code, "error" if no response was received
+	HTTPRetries         // count of sink http calls retried, Labels with only connection
+	QueueDepth          // messages waiting in the queue of Labels.Worker
+	Distributed         // count of messages distributed to Labels.Worker
+	BatchSize           // messages per batch handed to the sink, Labels with only connection
+	Sidelined           // count of messages sidelined, Labels with only connection
+	AlreadySidelined    // count of messages skipped as already sidelined, Labels with only connection
+	Parked              // count of keys parked after failing, Labels with only connection
+
+	AlertFiring // 1 while Labels.Alert fires, Labels with topic and partition only for partition alerts
+
+	Workers // workers of the dmux of a connection, Labels with only connection
+	Resizes // count of resizes decided by autoscale in Labels.Direction
+
+	FilterMatches // count of messages matching the filter rule Labels.Rule
+	Filtered      // count of messages dropped by the filter, Labels with only connection
+
+	TransformErrors // count of messages the sink failed to transform, Labels with only connection
+
+	PluginErrors // count of failed calls of the plugin function Labels.Function
+
+	FanOutLag       // messages handed to the fan-out sink Labels.Sink and not delivered yet
+	FanOutDelivered // count of messages delivered by the fan-out sink Labels.Sink
+	FanOutSkipped   // count of messages the optional fan-out sink Labels.Sink was too far behind for
 )
 
 //generic metric structure
 type Metric struct {
-	Type  MetricType
-	Name  string
-	Value int64
+	Type   MetricType
+	Name   string // dot encoded key of the legacy offset_metrics, ingested only if legacy offset metrics are enabled
+	Value  int64
+	Labels Labels
+}
+
+// Labels identify what a Metric was measured on
+type Labels struct {
+	Connection    string
+	ConsumerGroup string
+	Topic         string
+	Partition     int32
+
+	Worker int    // index of the dmux worker
+	Code   string // http status code of the sink call
+
+	Alert string // name of the alert
+
+	Direction string // of a resize, up or down
+
+	Rule string // name of the filter rule
+
+	Function string // of a plugin
+
+	Sink string // name of a fan-out sink
+}
+
+// BackendType selects where the metrics are published
+type BackendType string
+
+const (
+	// Prometheus serves the metrics on /metrics of its own port
+	Prometheus BackendType = "prometheus"
+	// StatsD pushes the metrics over udp, optionally with dogstatsd tags
+	StatsD BackendType = "statsd"
+	// OTLP pushes the metrics to an OpenTelemetry collector over http/json
+	OTLP BackendType = "otlp"
+)
+
+// BackendConf holds the configuration of one metrics backend, Config depends
+// on the Type
+type BackendConf struct {
+	Type   BackendType `json:"type"`
+	Config interface{} `json:"config"`
 }
 
 type Registry interface {
@@ -19,23 +98,50 @@ type Registry interface {
 	ingest(metric Metric)
 }
 
-var registry PrometheusRegistry
+var registries []Registry
 
-//Start creates a registry and initializes the metrics based on the registry type and implementation and returns the created registry
-func Start(metricPort int) {
+//Start creates and starts a registry for every backend, all of them get every ingested metric.
+//Without backends prometheus is served on metricPort, which is also the default port of a prometheus backend.
+//legacyOffsetMetrics keeps publishing offset_metrics with dot encoded keys along with the labeled metrics
+func Start(backends []BackendConf, metricPort int, legacyOffsetMetrics bool) {
 
 	if metricPort <= 0 {
 		metricPort = defaultMetricPort
 	}
+	if len(backends) == 0 {
+		backends = []BackendConf{{Type: Prometheus}}
+	}
 
-	config := PrometheusConfig{metricPort: metricPort}
+	for _, backend := range backends {
+		registry := newRegistry(backend.Type, metricPort, legacyOffsetMetrics)
+		registry.start(backend.Config)
+		registries = append(registries, registry)
+	}
 
-	registry = PrometheusRegistry{}
-	registry.start(config)
+}
 
+func newRegistry(backendType BackendType, metricPort int, legacyOffsetMetrics bool) Registry {
+	switch backendType {
+	case Prometheus:
+		return newPrometheusRegistry(metricPort, legacyOffsetMetrics)
+	case StatsD:
+		return new(StatsDRegistry)
+	case OTLP:
+		return new(OTLPRegistry)
+	default:
+		panic("Invalid metrics backend type " + string(backendType))
+	}
 }
 
-//Ingest calls the ingest method of the provider which is implementation by a metric registry type and forwards the metric
+//Ingest forwards the metric to the registry of every backend
 func Ingest(metric Metric) {
-	registry.ingest(metric)
+	for _, registry := range registries {
+		registry.ingest(metric)
+	}
+}
+
+// decodeConf converts the generic Config of a BackendConf to conf
+func decodeConf(config interface{}, conf interface{}) {
+	data, _ := json.Marshal(config)
+	json.Unmarshal(data, conf)
 }
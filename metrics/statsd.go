@@ -0,0 +1,142 @@
+package metrics
+
+import (
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StatsDConf holds the configuration of the statsd backend
+type StatsDConf struct {
+	Address       string `json:"address"`         //host:port of the statsd agent, defaults to localhost:8125
+	Prefix        string `json:"prefix"`          //prepended to the name of every metric
+	DogStatsD     bool   `json:"dogstatsd"`       //send labels as dogstatsd tags instead of appending their values to the name
+	FlushInterval string `json:"flush_interval"`  //longest a metric waits in the buffer, defaults to 1s
+	MaxPacketSize int    `json:"max_packet_size"` //defaults to 1432 bytes which fits an ethernet MTU
+}
+
+const (
+	defaultStatsDAddress       = "localhost:8125"
+	defaultStatsDFlushInterval = 1 * time.Second
+	defaultStatsDMaxPacketSize = 1432
+	statsDQueueSize            = 4096
+)
+
+// StatsDRegistry pushes the metrics to a statsd agent over udp. Metrics are
+// queued and sent in batches by a separate goroutine, a metric is dropped
+// rather than blocking the caller if the queue is full
+type StatsDRegistry struct {
+	conf  StatsDConf
+	lines chan string
+}
+
+func (s *StatsDRegistry) start(config interface{}) {
+	decodeConf(config, &s.conf)
+	if s.conf.Address == "" {
+		s.conf.Address = defaultStatsDAddress
+	}
+	if s.conf.MaxPacketSize <= 0 {
+		s.conf.MaxPacketSize = defaultStatsDMaxPacketSize
+	}
+	interval := defaultStatsDFlushInterval
+	if s.conf.FlushInterval != "" {
+		var err error
+		if interval, err = time.ParseDuration(s.conf.FlushInterval); err != nil {
+			log.Fatal("invalid statsd flush_interval " + err.Error())
+		}
+	}
+
+	conn, err := net.Dial("udp", s.conf.Address)
+	if err != nil {
+		log.Fatal("error in starting statsd metrics " + err.Error())
+	}
+	s.lines = make(chan string, statsDQueueSize)
+	go s.send(conn, interval)
+}
+
+func (s *StatsDRegistry) ingest(metric Metric) {
+	f, ok := families[metric.Type]
+	if !ok {
+		return
+	}
+	for _, line := range s.format(f, metric) {
+		select {
+		case s.lines <- line:
+		default:
+		}
+	}
+}
+
+// format returns the statsd lines of metric. A negative gauge is sent as 0
+// followed by the value, as a signed gauge value is taken as a delta
+func (s *StatsDRegistry) format(f family, metric Metric) []string {
+	name := s.conf.Prefix + f.name
+	values := labelValues(metric)
+	tags := ""
+	if s.conf.DogStatsD {
+		pairs := make([]string, len(values))
+		for i, value := range values {
+			pairs[i] = f.labels[i] + ":" + value
+		}
+		tags = "|#" + strings.Join(pairs, ",")
+	} else {
+		for _, value := range values {
+			name += "." + strings.Replace(value, ".", "_", -1)
+		}
+	}
+
+	switch f.kind {
+	case gauge:
+		value := strconv.FormatInt(metric.Value, 10)
+		if metric.Value < 0 {
+			return []string{name + ":0|g" + tags, name + ":" + value + "|g" + tags}
+		}
+		return []string{name + ":" + value + "|g" + tags}
+	case counter:
+		return []string{name + ":" + strconv.FormatInt(metric.Value, 10) + "|c" + tags}
+	default:
+		if metric.Type == HTTPRequestDuration {
+			ms := observed(metric) * 1000
+			return []string{name + ":" + strconv.FormatFloat(ms, 'f', -1, 64) + "|ms" + tags}
+		}
+		statType := "|ms"
+		if s.conf.DogStatsD {
+			statType = "|h"
+		}
+		return []string{name + ":" + strconv.FormatFloat(observed(metric), 'f', -1, 64) + statType + tags}
+	}
+}
+
+// send writes the queued lines to conn, as many as fit in a packet at once
+func (s *StatsDRegistry) send(conn net.Conn, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	buf := make([]byte, 0, s.conf.MaxPacketSize)
+	flush := func() {
+		if len(buf) == 0 {
+			return
+		}
+		if _, err := conn.Write(buf); err != nil {
+			log.Printf("failed to send statsd metrics %s \n", err.Error())
+		}
+		buf = buf[:0]
+	}
+
+	for {
+		select {
+		case line := <-s.lines:
+			if len(buf) > 0 && len(buf)+1+len(line) > s.conf.MaxPacketSize {
+				flush()
+			}
+			if len(buf) > 0 {
+				buf = append(buf, '\n')
+			}
+			buf = append(buf, line...)
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
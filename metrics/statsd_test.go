@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func listenStatsD(t *testing.T) *net.UDPConn {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	assert.NoError(t, err)
+	return conn
+}
+
+func readStatsD(t *testing.T, conn *net.UDPConn) []string {
+	buf := make([]byte, 2048)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := conn.Read(buf)
+	assert.NoError(t, err)
+	return strings.Split(string(buf[:n]), "\n")
+}
+
+func TestStatsD(t *testing.T) {
+	conn := listenStatsD(t)
+	defer conn.Close()
+
+	s := new(StatsDRegistry)
+	s.start(map[string]interface{}{"address": conn.LocalAddr().String(), "prefix": "dmux.", "flush_interval": "10ms"})
+	s.ingest(Metric{Type: Lag, Value: 42, Labels: Labels{Connection: "orders", ConsumerGroup: "orders.cg", Topic: "orders", Partition: 3}})
+	s.ingest(Metric{Type: HTTPResponses, Value: 1, Labels: Labels{Connection: "orders", Code: "200"}})
+	s.ingest(Metric{Type: HTTPRequestDuration, Value: int64(1500 * time.Microsecond), Labels: Labels{Connection: "orders"}})
+	s.ingest(Metric{Type: BatchSize, Value: 8, Labels: Labels{Connection: "orders"}})
+
+	assert.Equal(t, []string{
+		"dmux.dmux_consumer_lag.orders.orders_cg.orders.3:42|g",
+		"dmux.dmux_http_responses_total.orders.200:1|c",
+		"dmux.dmux_http_request_duration_seconds.orders:1.5|ms",
+		"dmux.dmux_batch_size.orders:8|ms",
+	}, readStatsD(t, conn))
+}
+
+func TestDogStatsD(t *testing.T) {
+	conn := listenStatsD(t)
+	defer conn.Close()
+
+	s := new(StatsDRegistry)
+	s.start(map[string]interface{}{"address": conn.LocalAddr().String(), "dogstatsd": true, "flush_interval": "10ms"})
+	s.ingest(Metric{Type: Lag, Value: -2, Labels: Labels{Connection: "orders", ConsumerGroup: "orders-cg", Topic: "orders", Partition: 3}})
+	s.ingest(Metric{Type: BatchSize, Value: 8, Labels: Labels{Connection: "orders"}})
+
+	tags := "|#connection:orders,consumer_group:orders-cg,topic:orders,partition:3"
+	assert.Equal(t, []string{
+		"dmux_consumer_lag:0|g" + tags,
+		"dmux_consumer_lag:-2|g" + tags,
+		"dmux_batch_size:8|h|#connection:orders",
+	}, readStatsD(t, conn))
+}
+
+func TestStatsDSplitsPackets(t *testing.T) {
+	conn := listenStatsD(t)
+	defer conn.Close()
+
+	s := new(StatsDRegistry)
+	s.start(map[string]interface{}{"address": conn.LocalAddr().String(), "flush_interval": "1h", "max_packet_size": 40})
+	s.ingest(Metric{Type: Sidelined, Value: 1, Labels: Labels{Connection: "orders"}})
+	s.ingest(Metric{Type: Sidelined, Value: 2, Labels: Labels{Connection: "orders"}})
+
+	assert.Equal(t, []string{"dmux_sidelined_total.orders:1|c"}, readStatsD(t, conn))
+}
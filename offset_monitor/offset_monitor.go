@@ -3,10 +3,15 @@ package offset_monitor
 import (
 	"context"
 	"github.com/Shopify/sarama"
+	"github.com/cenkalti/backoff"
+	"github.com/flipkart-incubator/go-dmux/alerting"
+	"github.com/flipkart-incubator/go-dmux/autoscale"
 	"github.com/flipkart-incubator/go-dmux/core"
 	consumergroup "github.com/flipkart-incubator/go-dmux/kafka/consumer-group"
 	"github.com/flipkart-incubator/go-dmux/metrics"
+	"log"
 	"strconv"
+	"sync/atomic"
 	"time"
 )
 
@@ -18,15 +23,27 @@ type OffMonitorConf struct {
 
 type OffMonitor struct {
 	offMonitorConf OffMonitorConf
+	connection     string // name of the dmux connection, for metric labels
+	status         *monitorStatus
+}
+
+// monitorStatus is the health of the producer consumer monitor, shared by the
+// copies of an OffMonitor
+type monitorStatus struct {
+	healthy  int32 // 1 once connected and the last poll succeeded
+	lastPoll int64 // unix nanos of the last successful poll
 }
 
 type OffMonitorHandler interface {
-	StartProducerConsumerMonitor(brokerList []string, topic string, cgName string, consumer *consumergroup.ConsumerGroup,
+	StartProducerConsumerMonitor(brokerList []string, cgName string, consumer *consumergroup.ConsumerGroup,
 		ctx context.Context)
-	IngestSrcSkMetric(prefixName string, msg *sarama.ConsumerMessage)
+	IngestSrcSkMetric(metricType metrics.MetricType, cgName string, msg *sarama.ConsumerMessage)
 }
 
-func (monitor *OffMonitor) StartProducerConsumerMonitor(brokerList []string, topic string, cgName string,
+// StartProducerConsumerMonitor polls the producer and consumer offsets of every
+// topic the consumer group subscribes to, including those picked up later by a
+// topic pattern
+func (monitor *OffMonitor) StartProducerConsumerMonitor(brokerList []string, cgName string,
 	consumer *consumergroup.ConsumerGroup, ctx context.Context) {
 	//if polling interval is invalid then set it to default value - 5 seconds
 	if monitor.offMonitorConf.OffPollingInterval.Duration <= 0 {
@@ -34,63 +51,177 @@ func (monitor *OffMonitor) StartProducerConsumerMonitor(brokerList []string, top
 	}
 
 	if monitor.offMonitorConf.ProducerConsumerMonitorEnabled {
-		go monitorProducerConsumerOffset(brokerList, topic, cgName, consumer, ctx, monitor.offMonitorConf.OffPollingInterval.Duration)
+		labels := metrics.Labels{Connection: monitor.connection, ConsumerGroup: cgName}
+		go monitorProducerConsumerOffset(brokerList, labels, consumer, ctx, monitor.offMonitorConf.OffPollingInterval.Duration, monitor.status)
+	}
+}
+
+// Healthy returns true if the producer consumer monitor is connected and its
+// last poll succeeded
+func (monitor *OffMonitor) Healthy() bool {
+	return atomic.LoadInt32(&monitor.status.healthy) == 1
+}
+
+// LastPoll returns when the producer consumer monitor last polled every topic
+// successfully, zero if it never did
+func (monitor *OffMonitor) LastPoll() time.Time {
+	if nanos := atomic.LoadInt64(&monitor.status.lastPoll); nanos > 0 {
+		return time.Unix(0, nanos)
 	}
+	return time.Time{}
 }
 
-func (monitor *OffMonitor) IngestSrcSkMetric(prefixName string, msg *sarama.ConsumerMessage) {
+// Connection returns the name of the dmux connection the monitor reports for
+func (monitor *OffMonitor) Connection() string {
+	return monitor.connection
+}
+
+// IngestSrcSkMetric ingests the offset of msg as metricType, SourceOffset or SinkOffset
+func (monitor *OffMonitor) IngestSrcSkMetric(metricType metrics.MetricType, cgName string, msg *sarama.ConsumerMessage) {
 	if monitor.offMonitorConf.SourceSinkMonitorEnabled {
-		ingestMetric(prefixName+"."+msg.Topic+"."+strconv.Itoa(int(msg.Partition)), msg.Offset)
+		labels := metrics.Labels{Connection: monitor.connection, ConsumerGroup: cgName, Topic: msg.Topic, Partition: msg.Partition}
+		ingestMetric(metricType, labels, msg.Offset)
 	}
 }
 
 //Ingest producer and consumer offset after a certain interval
-func monitorProducerConsumerOffset(brokerList []string, topic string, connectionName string,
-	consumer *consumergroup.ConsumerGroup, ctx context.Context, interval time.Duration) {
-
-	if client, err := sarama.NewClient(brokerList, nil); err == nil {
-		for {
-			select {
-			case <-time.After(interval):
-				if partitions, err := client.Partitions(topic); err == nil {
-					for partition := range partitions {
-						suffixName := connectionName + "." + topic + "." + strconv.Itoa(partition)
-						pOff := int64(-1)
-						cOff := int64(-1)
-
-						//producerOff fetched from client
-						if producerOff, errInCollection := client.GetOffset(topic, int32(partition), sarama.OffsetNewest); errInCollection == nil && producerOff > 0 {
-							pOff = producerOff
-							ingestMetric("producer_offset"+"."+suffixName, producerOff-1)
-						}
-
-						//consumerOff feched from consumer
-						if consumerOff, errInCollection := consumer.GetConsumerOffset(topic, int32(partition)); errInCollection == nil && consumerOff > 0 {
-							cOff = consumerOff
-							ingestMetric("consumer_offset"+"."+suffixName, consumerOff-1)
-						}
-
-						if pOff >= 0 && cOff >= 0 && (pOff-cOff >= 0) {
-							ingestMetric("lag_producer_consumer"+"."+suffixName, pOff-cOff)
-						}
-					}
+func monitorProducerConsumerOffset(brokerList []string, labels metrics.Labels,
+	consumer *consumergroup.ConsumerGroup, ctx context.Context, interval time.Duration, status *monitorStatus) {
+
+	status.report(labels, false, time.Time{})
+	client, err := newMonitorClient(brokerList, labels.ConsumerGroup, consumer.GetSaramaConfig(), ctx)
+	if err != nil {
+		return
+	}
+	defer client.Close()
+
+	for {
+		select {
+		case <-time.After(interval):
+			healthy := true
+			for _, topic := range consumer.Topics() {
+				if err := ingestTopicOffsets(client, topic, labels, consumer); err != nil {
+					log.Printf("offset monitor of %s failed to poll %s: %s \n", labels.ConsumerGroup, topic, err)
+					healthy = false
 				}
-			case <-ctx.Done():
-				return
 			}
+			if healthy {
+				status.report(labels, true, time.Now())
+			} else {
+				status.report(labels, false, time.Time{})
+			}
+		case <-ctx.Done():
+			return
 		}
 	}
 }
 
-func ingestMetric(name string, value int64) {
+// newMonitorClient connects to the brokers with the config of the consumer,
+// retrying with backoff till it succeeds or ctx is done
+func newMonitorClient(brokerList []string, connectionName string, config *sarama.Config, ctx context.Context) (sarama.Client, error) {
+	expBackOff := backoff.NewExponentialBackOff()
+	expBackOff.MaxInterval = time.Minute
+	expBackOff.MaxElapsedTime = 0 // retry till ctx is done
+
+	var client sarama.Client
+	err := backoff.RetryNotify(func() error {
+		var err error
+		client, err = sarama.NewClient(brokerList, config)
+		return err
+	}, backoff.WithContext(expBackOff, ctx), func(err error, next time.Duration) {
+		log.Printf("offset monitor of %s failed to connect, retrying in %s: %s \n", connectionName, next, err)
+	})
+	return client, err
+}
+
+// report records the outcome of a poll, lastPoll is zero unless it succeeded
+func (s *monitorStatus) report(labels metrics.Labels, healthy bool, lastPoll time.Time) {
+	var up int64
+	if healthy {
+		up = 1
+	}
+	atomic.StoreInt32(&s.healthy, int32(up))
+	ingestMetric(metrics.OffsetMonitorHealthy, labels, up)
+	if !lastPoll.IsZero() {
+		atomic.StoreInt64(&s.lastPoll, lastPoll.UnixNano())
+		ingestMetric(metrics.OffsetMonitorLastPoll, labels, lastPoll.Unix())
+	}
+}
+
+// groupOffsets are the offsets of a consumer group ingestTopicOffsets reports
+type groupOffsets interface {
+	GetConsumerOffset(topic string, partition int32) (int64, error)
+	GetProcessedOffset(topic string, partition int32) (int64, bool)
+}
+
+func ingestTopicOffsets(client sarama.Client, topic string, labels metrics.Labels, consumer groupOffsets) error {
+	partitions, err := client.Partitions(topic)
+	if err != nil {
+		return err
+	}
+	scaling := autoscale.ForConnection(labels.Connection)
+	for _, partition := range partitions {
+		labels.Topic, labels.Partition = topic, partition
+		pOff := int64(-1)
+		cOff := int64(-1)
+
+		//producerOff fetched from client
+		producerOff, errInCollection := client.GetOffset(topic, partition, sarama.OffsetNewest)
+		if errInCollection == nil && producerOff > 0 {
+			pOff = producerOff
+			ingestMetric(metrics.ProducerOffset, labels, producerOff-1)
+			alerting.ForConnection(labels.Connection).Produced(topic, partition, producerOff-1)
+		}
+
+		//consumerOff feched from consumer
+		if consumerOff, errInCollection := consumer.GetConsumerOffset(topic, partition); errInCollection == nil && consumerOff > 0 {
+			cOff = consumerOff
+			ingestMetric(metrics.ConsumerOffset, labels, consumerOff-1)
+		}
+
+		if pOff >= 0 && cOff >= 0 && (pOff-cOff >= 0) {
+			ingestMetric(metrics.Lag, labels, pOff-cOff)
+		}
+
+		//autoscale by what is left to process of the partitions this instance
+		//consumes, unknown till it processed or committed an offset of them
+		if processed, owned := consumer.GetProcessedOffset(topic, partition); !owned {
+			scaling.Release(topic, partition)
+		} else if errInCollection == nil && processed >= 0 {
+			lag := producerOff - processed
+			if lag < 0 {
+				lag = 0
+			}
+			scaling.Lag(topic, partition, lag)
+		}
+	}
+	return nil
+}
+
+// legacyNames are the prefixes of the dot encoded keys of offset_metrics
+var legacyNames = map[metrics.MetricType]string{
+	metrics.SourceOffset:   "source_offset",
+	metrics.SinkOffset:     "sink_offset",
+	metrics.ProducerOffset: "producer_offset",
+	metrics.ConsumerOffset: "consumer_offset",
+	metrics.Lag:            "lag_producer_consumer",
+}
+
+func ingestMetric(metricType metrics.MetricType, labels metrics.Labels, value int64) {
+	var name string
+	if prefix, ok := legacyNames[metricType]; ok {
+		name = prefix + "." + labels.ConsumerGroup + "." + labels.Topic + "." + strconv.Itoa(int(labels.Partition))
+	}
 	metrics.Ingest(metrics.Metric{
-		Type:  metrics.Offset,
-		Name:  name,
-		Value: value,
+		Type:   metricType,
+		Name:   name,
+		Value:  value,
+		Labels: labels,
 	})
 }
 
-func GetOffMonitor(conf OffMonitorConf) OffMonitor {
-	offMonitor := OffMonitor{conf}
+// GetOffMonitor returns an OffMonitor reporting for the dmux connection
+func GetOffMonitor(conf OffMonitorConf, connection string) OffMonitor {
+	offMonitor := OffMonitor{conf, connection, new(monitorStatus)}
 	return offMonitor
 }
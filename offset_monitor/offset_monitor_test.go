@@ -0,0 +1,102 @@
+package offset_monitor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/flipkart-incubator/go-dmux/autoscale"
+	"github.com/flipkart-incubator/go-dmux/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMonitorStatus(t *testing.T) {
+	monitor := GetOffMonitor(OffMonitorConf{}, "test")
+	assert.False(t, monitor.Healthy())
+	assert.True(t, monitor.LastPoll().IsZero())
+
+	// copies share the status
+	copied := monitor
+	polled := time.Now()
+	copied.status.report(metrics.Labels{}, true, polled)
+	assert.True(t, monitor.Healthy())
+	assert.True(t, polled.Equal(monitor.LastPoll()))
+
+	copied.status.report(metrics.Labels{}, false, time.Time{})
+	assert.False(t, monitor.Healthy())
+	assert.True(t, polled.Equal(monitor.LastPoll()))
+}
+
+func TestNewMonitorClientStopsWithContext(t *testing.T) {
+	config := sarama.NewConfig()
+	config.Metadata.Retry.Max = 0
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	client, err := newMonitorClient([]string{"127.0.0.1:1"}, "test", config, ctx)
+	assert.NotNil(t, err)
+	assert.Nil(t, client)
+}
+
+// offsetsClient returns the newest offset of every partition of a topic
+type offsetsClient struct {
+	sarama.Client
+	newest map[int32]int64
+}
+
+func (c *offsetsClient) Partitions(topic string) ([]int32, error) {
+	var partitions []int32
+	for p := range c.newest {
+		partitions = append(partitions, p)
+	}
+	return partitions, nil
+}
+
+func (c *offsetsClient) GetOffset(topic string, partition int32, time int64) (int64, error) {
+	return c.newest[partition], nil
+}
+
+// ownedOffsets is a consumer group instance that consumes the partitions of
+// processed, its high water marks are the newest offsets
+type ownedOffsets struct {
+	client    *offsetsClient
+	processed map[int32]int64
+}
+
+func (g *ownedOffsets) GetConsumerOffset(topic string, partition int32) (int64, error) {
+	return g.client.newest[partition], nil
+}
+
+func (g *ownedOffsets) GetProcessedOffset(topic string, partition int32) (int64, bool) {
+	offset, ok := g.processed[partition]
+	return offset, ok
+}
+
+func TestIngestTopicOffsetsLag(t *testing.T) {
+	client := &offsetsClient{newest: map[int32]int64{0: 100, 1: 50}}
+	group := &ownedOffsets{client: client, processed: map[int32]int64{0: 40, 1: 0}}
+	labels := metrics.Labels{Connection: "lagging", ConsumerGroup: "group"}
+	controller := autoscale.GetController("lagging", autoscale.Conf{Enabled: true, MaxLag: 100, Cooldown: "1ns"}, 2)
+	ingest := func() {
+		assert.Nil(t, ingestTopicOffsets(client, "orders", labels, group))
+	}
+
+	// both partitions are behind
+	ingest()
+	assert.Equal(t, 3, controller.Decide(2, time.Now()))
+
+	// the lag of a partition another instance took over is not counted
+	delete(group.processed, 1)
+	ingest()
+	assert.Equal(t, 3, controller.Decide(3, time.Now()))
+
+	// the lag is what is left to process, not the high water mark
+	group.processed[0] = 100
+	ingest()
+	assert.Equal(t, 2, controller.Decide(3, time.Now()))
+
+	client.newest[0] = 300
+	ingest()
+	assert.Equal(t, 3, controller.Decide(2, time.Now()))
+}
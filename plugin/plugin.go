@@ -0,0 +1,385 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/flipkart-incubator/go-dmux/logging"
+	"github.com/flipkart-incubator/go-dmux/metrics"
+	"github.com/flipkart-incubator/go-dmux/transform"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// Conf holds the WebAssembly module of a connection and its limits
+type Conf struct {
+	Path           string `json:"path"`            //wasm module, no plugin if empty
+	ReloadInterval string `json:"reload_interval"` //how often the module is checked for changes, defaults to 30s
+	Timeout        string `json:"timeout"`         //longest a single call of the module may run, defaults to 100ms
+	MaxMemoryMB    int    `json:"max_memory_mb"`   //most memory of an instance of the module, defaults to 16
+}
+
+const (
+	defaultReloadInterval = 30 * time.Second
+	defaultTimeout        = 100 * time.Millisecond
+	defaultMaxMemoryMB    = 16
+	pagesPerMB            = 16 // wasm pages are 64KiB
+)
+
+// functions a module can export, it has to export alloc and memory and at
+// least one of filter, transform and key
+const (
+	Alloc     = "alloc"     // (size i32) -> ptr i32, where the record of a call is written
+	Filter    = "filter"    // (ptr i32, len i32) -> i32, 0 drops the message
+	Transform = "transform" // (ptr i32, len i32) -> i64, the payload as ptr << 32 | len, negative on failure
+	Key       = "key"       // (ptr i32, len i32) -> i64, the ordering key as ptr << 32 | len, negative to keep the ordering key
+)
+
+// Plugin runs the functions of a WebAssembly module of a connection in a
+// sandbox without filesystem or network, each call bounded in memory and
+// time. The module is reloaded when its file changes. A nil *Plugin is valid
+// and keeps every message as it is
+type Plugin struct {
+	connection string
+	path       string
+	timeout    time.Duration
+	runtime    wazero.Runtime
+	logger     *logging.Logger
+	instances  int // of a module at most, calls beyond wait for a free one
+
+	l       sync.Mutex
+	cond    *sync.Cond // signaled when an instance is released
+	current *module
+	binary  []byte // of current
+}
+
+// module is a compiled module with the instances that are not in use
+type module struct {
+	compiled wazero.CompiledModule
+	exports  map[string]bool
+	free     []api.Module
+	inUse    int  // instances in use or being created
+	retired  bool // replaced by a reload, closed once no instance is in use
+}
+
+// GetPlugin returns the Plugin of conf for connection, nil if conf has no
+// path. It runs an instance per worker of the connection and one for its
+// source at most. A module that can't be loaded is fatal
+func GetPlugin(connection string, conf Conf, workers int) *Plugin {
+	if conf.Path == "" {
+		return nil
+	}
+	p, err := load(connection, conf, workers)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	go p.watch(parseDuration("reload_interval", conf.ReloadInterval, defaultReloadInterval))
+	return p
+}
+
+func load(connection string, conf Conf, workers int) (*Plugin, error) {
+	maxMemoryMB := conf.MaxMemoryMB
+	if maxMemoryMB <= 0 {
+		maxMemoryMB = defaultMaxMemoryMB
+	}
+	ctx := context.Background()
+	runtime := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(uint32(maxMemoryMB*pagesPerMB)).
+		WithCloseOnContextDone(true))
+	// wasi without mounts, args or env lets modules built for wasi run
+	wasi_snapshot_preview1.MustInstantiate(ctx, runtime)
+	p := &Plugin{
+		connection: connection,
+		path:       conf.Path,
+		timeout:    parseDuration("timeout", conf.Timeout, defaultTimeout),
+		runtime:    runtime,
+		logger:     logging.ForConnection(connection),
+		instances:  workers + 1,
+	}
+	p.cond = sync.NewCond(&p.l)
+	if _, err := p.reload(); err != nil {
+		runtime.Close(ctx)
+		return nil, err
+	}
+	return p, nil
+}
+
+func parseDuration(key, value string, fallback time.Duration) time.Duration {
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatal("invalid plugin " + key + " " + err.Error())
+	}
+	return d
+}
+
+// watch reloads the module every interval if its file changed
+func (p *Plugin) watch(interval time.Duration) {
+	for range time.Tick(interval) {
+		reloaded, err := p.reload()
+		if err != nil {
+			p.logger.Errorf("failed to reload plugin %s, keeping the loaded one: %s", p.path, err)
+		} else if reloaded {
+			p.logger.Infof("reloaded plugin %s", p.path)
+		}
+	}
+}
+
+// reload compiles the module if its file changed and replaces the current
+// one, it returns true if it did
+func (p *Plugin) reload() (bool, error) {
+	binary, err := ioutil.ReadFile(p.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read plugin %s: %v", p.path, err)
+	}
+	p.l.Lock()
+	same := bytes.Equal(binary, p.binary)
+	p.l.Unlock()
+	if same {
+		return false, nil
+	}
+
+	ctx := context.Background()
+	compiled, err := p.runtime.CompileModule(ctx, binary)
+	if err != nil {
+		return false, fmt.Errorf("failed to compile plugin %s: %v", p.path, err)
+	}
+	m := &module{compiled: compiled, exports: make(map[string]bool)}
+	for name := range compiled.ExportedFunctions() {
+		m.exports[name] = true
+	}
+	_, memory := compiled.ExportedMemories()["memory"]
+	if !memory || !m.exports[Alloc] || !(m.exports[Filter] || m.exports[Transform] || m.exports[Key]) {
+		compiled.Close(ctx)
+		return false, fmt.Errorf("plugin %s has to export memory, %s and one of %s, %s and %s", p.path, Alloc, Filter, Transform, Key)
+	}
+	// an instance is created now to fail on modules that can't be instantiated
+	instance, err := m.instantiate(p.runtime)
+	if err != nil {
+		compiled.Close(ctx)
+		return false, fmt.Errorf("failed to instantiate plugin %s: %v", p.path, err)
+	}
+	m.free = append(m.free, instance)
+
+	p.l.Lock()
+	old := p.current
+	p.current, p.binary = m, binary
+	if old != nil {
+		old.retired = true
+		old.closeIfUnused()
+	}
+	p.cond.Broadcast() // calls waiting for an instance of old
+	p.l.Unlock()
+	return true, nil
+}
+
+func (m *module) instantiate(runtime wazero.Runtime) (api.Module, error) {
+	// anonymous, so a module can have an instance per concurrent call
+	return runtime.InstantiateModule(context.Background(), m.compiled, wazero.NewModuleConfig().WithName("").WithStartFunctions("_initialize"))
+}
+
+// closeIfUnused closes a retired module once none of its instances is in use
+func (m *module) closeIfUnused() {
+	if !m.retired || m.inUse > 0 {
+		return
+	}
+	ctx := context.Background()
+	for _, instance := range m.free {
+		instance.Close(ctx)
+	}
+	m.free = nil
+	m.compiled.Close(ctx)
+}
+
+// acquire returns an instance of the current module if it exports function,
+// nil if it doesn't. It waits while every instance is in use, and fails if a
+// new instance can't be created, e.g. over the memory limit
+func (p *Plugin) acquire(function string) (*module, api.Module, error) {
+	p.l.Lock()
+	m := p.current
+	for m.exports[function] && len(m.free) == 0 && m.inUse >= p.instances {
+		p.cond.Wait()
+		m = p.current
+	}
+	if !m.exports[function] {
+		p.l.Unlock()
+		return nil, nil, nil
+	}
+	m.inUse++
+	if n := len(m.free); n > 0 {
+		instance := m.free[n-1]
+		m.free = m.free[:n-1]
+		p.l.Unlock()
+		return m, instance, nil
+	}
+	p.l.Unlock()
+
+	// created without the lock, the other calls go on meanwhile
+	instance, err := m.instantiate(p.runtime)
+	if err != nil {
+		p.l.Lock()
+		m.inUse--
+		p.cond.Signal()
+		m.closeIfUnused()
+		p.l.Unlock()
+		return nil, nil, err
+	}
+	return m, instance, nil
+}
+
+// release returns instance to m, closing it if the call failed as it may
+// have been left in any state
+func (p *Plugin) release(m *module, instance api.Module, failed bool) {
+	p.l.Lock()
+	defer p.l.Unlock()
+	m.inUse--
+	if failed {
+		instance.Close(context.Background())
+	} else {
+		m.free = append(m.free, instance)
+	}
+	p.cond.Signal()
+	m.closeIfUnused()
+}
+
+// errNoResult is returned by functions that returned a negative result
+var errNoResult = errors.New("no result")
+
+// call calls function with r and returns its result, ok is false if the
+// module doesn't export function
+func (p *Plugin) call(function string, r transform.Record) (result uint64, output []byte, ok bool, err error) {
+	m, instance, err := p.acquire(function)
+	if err != nil {
+		p.failed(function, err)
+		return 0, nil, true, err
+	}
+	if m == nil {
+		return 0, nil, false, nil
+	}
+	defer func() {
+		if err != nil && err != errNoResult {
+			p.failed(function, err)
+		}
+		p.release(m, instance, err != nil && err != errNoResult)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+	input := encode(r)
+	results, err := instance.ExportedFunction(Alloc).Call(ctx, uint64(len(input)))
+	if err != nil {
+		return 0, nil, true, err
+	}
+	ptr := uint32(results[0])
+	if !instance.Memory().Write(ptr, input) {
+		return 0, nil, true, fmt.Errorf("%s returned %d, out of memory for %d bytes", Alloc, ptr, len(input))
+	}
+	if results, err = instance.ExportedFunction(function).Call(ctx, uint64(ptr), uint64(len(input))); err != nil {
+		return 0, nil, true, err
+	}
+	result = results[0]
+	if function == Filter {
+		return result, nil, true, nil
+	}
+	if int64(result) < 0 {
+		return result, nil, true, errNoResult
+	}
+	ptr, size := uint32(result>>32), uint32(result)
+	data, inMemory := instance.Memory().Read(ptr, size)
+	if !inMemory {
+		return result, nil, true, fmt.Errorf("returned %d bytes at %d, out of memory", size, ptr)
+	}
+	// the memory is reused by the next call
+	return result, append([]byte(nil), data...), true, nil
+}
+
+// failed logs and counts a failed call of function
+func (p *Plugin) failed(function string, err error) {
+	p.logger.SampledInfof("plugin %s failed: %s", function, err)
+	metrics.Ingest(metrics.Metric{Type: metrics.PluginErrors, Value: 1, Labels: metrics.Labels{Connection: p.connection, Function: function}})
+}
+
+// Keep returns false if the filter of the module drops msg. Messages that
+// are not transform.Msg, or that the filter failed on, are kept
+func (p *Plugin) Keep(msg interface{}) bool {
+	m, ok := msg.(transform.Msg)
+	if p == nil || !ok {
+		return true
+	}
+	result, _, exported, err := p.call(Filter, m.GetTransformRecord())
+	if !exported || err != nil || result != 0 {
+		return true
+	}
+	metrics.Ingest(metrics.Metric{Type: metrics.Filtered, Value: 1, Labels: metrics.Labels{Connection: p.connection}})
+	return false
+}
+
+// Key returns the ordering key of r as the key function of the module returns
+// it, nil to keep the ordering key of the connection
+func (p *Plugin) Key(r transform.Record) []byte {
+	if p == nil {
+		return nil
+	}
+	_, key, _, _ := p.call(Key, r)
+	return key
+}
+
+// Transform implements transform.Transformer, it returns the value of r if
+// the module doesn't export transform
+func (p *Plugin) Transform(r transform.Record) ([]byte, error) {
+	_, payload, exported, err := p.call(Transform, r)
+	if !exported {
+		return r.Value, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("plugin transform failed: %v", err)
+	}
+	return payload, nil
+}
+
+// encode writes r as the module reads it, little endian:
+//
+//	u32 key length, key, u32 value length, value, u32 topic length, topic,
+//	i32 partition, i64 offset, i64 timestamp in epoch millis or -1,
+//	u32 id length, id, u32 header count, then for every header sorted by
+//	name u32 name length, name, u32 value length, value
+func encode(r transform.Record) []byte {
+	var b bytes.Buffer
+	bytesOf := func(data []byte) {
+		binary.Write(&b, binary.LittleEndian, uint32(len(data)))
+		b.Write(data)
+	}
+	bytesOf(r.Key)
+	bytesOf(r.Value)
+	bytesOf([]byte(r.Topic))
+	timestamp := int64(-1)
+	if !r.Timestamp.IsZero() {
+		timestamp = r.Timestamp.UnixNano() / int64(time.Millisecond)
+	}
+	binary.Write(&b, binary.LittleEndian, r.Partition)
+	binary.Write(&b, binary.LittleEndian, r.Offset)
+	binary.Write(&b, binary.LittleEndian, timestamp)
+	bytesOf([]byte(r.ID))
+	names := make([]string, 0, len(r.Headers))
+	for name := range r.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	binary.Write(&b, binary.LittleEndian, uint32(len(names)))
+	for _, name := range names {
+		bytesOf([]byte(name))
+		bytesOf([]byte(r.Headers[name]))
+	}
+	return b.Bytes()
+}
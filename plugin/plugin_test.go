@@ -0,0 +1,270 @@
+package plugin
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/flipkart-incubator/go-dmux/transform"
+	"github.com/stretchr/testify/assert"
+	"github.com/tetratelabs/wazero/api"
+)
+
+// function of a test module, its body is wasm code without the final end
+type function struct {
+	name   string
+	typ    byte // index into types
+	locals []byte
+	body   []byte
+}
+
+var types = [][]byte{
+	{0x60, 1, 0x7f, 1, 0x7f},       // (i32) -> i32
+	{0x60, 2, 0x7f, 0x7f, 1, 0x7f}, // (i32, i32) -> i32
+	{0x60, 2, 0x7f, 0x7f, 1, 0x7e}, // (i32, i32) -> i64
+}
+
+// alloc always returns 1024, a call writes one record at a time
+var alloc = function{Alloc, 0, nil, []byte{0x41, 0x80, 0x08}}
+
+// keepFilter keeps messages whose key does not start with x
+var keepFilter = function{Filter, 1, nil, []byte{
+	0x20, 0, 0x28, 2, 0, // key length
+	0x45, 0x04, 0x7f, // if it is 0
+	0x41, 0, // drop
+	0x05,                // else
+	0x20, 0, 0x2d, 0, 4, // first byte of the key
+	0x41, 0xf8, 0, 0x47, // != 'x'
+	0x0b,
+}}
+
+// firstByteKey returns the first byte of the key, nothing for empty keys
+var firstByteKey = function{Key, 2, nil, []byte{
+	0x20, 0, 0x28, 2, 0, 0x45, 0x04, 0x7e,
+	0x42, 0x7f, // -1
+	0x05,
+	0x20, 0, 0x41, 4, 0x6a, 0xad, 0x42, 0x20, 0x86, // ptr + 4 << 32
+	0x42, 1, 0x84, // | 1
+	0x0b,
+}}
+
+// upperTransform upper cases the first byte of the value
+var upperTransform = function{Transform, 2, []byte{1, 1, 0x7f}, []byte{
+	0x20, 0, 0x20, 0, 0x28, 2, 0, 0x6a, 0x41, 8, 0x6a, 0x21, 2, // value = ptr + key length + 8
+	0x20, 2, 0x20, 2, 0x2d, 0, 0, 0x41, 0x20, 0x6b, 0x3a, 0, 0, // value[0] -= 32
+	0x20, 2, 0xad, 0x42, 0x20, 0x86, // value << 32
+	0x20, 2, 0x41, 4, 0x6b, 0x28, 2, 0, 0xad, 0x84, // | value length
+}}
+
+// spinFilter never returns
+var spinFilter = function{Filter, 1, nil, []byte{0x03, 0x40, 0x0c, 0, 0x0b, 0x41, 0}}
+
+func leb(n int) []byte {
+	var b []byte
+	for {
+		c := byte(n & 0x7f)
+		n >>= 7
+		if n == 0 {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
+
+func vec(items ...[]byte) []byte {
+	b := leb(len(items))
+	for _, item := range items {
+		b = append(b, item...)
+	}
+	return b
+}
+
+func section(id byte, content []byte) []byte {
+	return append(append([]byte{id}, leb(len(content))...), content...)
+}
+
+// wasm assembles a module exporting memory with pages and functions
+func wasm(pages int, functions ...function) []byte {
+	var typeIndexes, exports, code [][]byte
+	for i, f := range functions {
+		typeIndexes = append(typeIndexes, []byte{f.typ})
+		exports = append(exports, append(append(leb(len(f.name)), f.name...), 0, byte(i)))
+		locals := f.locals
+		if locals == nil {
+			locals = []byte{0}
+		}
+		body := append(append(append([]byte{}, locals...), f.body...), 0x0b)
+		code = append(code, append(leb(len(body)), body...))
+	}
+	exports = append(exports, append(append(leb(len("memory")), "memory"...), 2, 0))
+	module := []byte{0, 'a', 's', 'm', 1, 0, 0, 0}
+	module = append(module, section(1, vec(types...))...)
+	module = append(module, section(3, vec(typeIndexes...))...)
+	module = append(module, section(5, vec(append([]byte{0}, leb(pages)...)))...)
+	module = append(module, section(7, vec(exports...))...)
+	return append(module, section(10, vec(code...))...)
+}
+
+func write(t *testing.T, path string, module []byte) {
+	assert.NoError(t, ioutil.WriteFile(path, module, 0644))
+}
+
+type msg struct {
+	record transform.Record
+}
+
+func (m *msg) GetTransformRecord() transform.Record {
+	return m.record
+}
+
+func (m *msg) SetPayload(payload []byte) {}
+
+func record(key, value string) transform.Record {
+	return transform.Record{Topic: "orders", Key: []byte(key), Value: []byte(value), Headers: map[string]string{"b": "2", "a": "1"}}
+}
+
+func TestPlugin(t *testing.T) {
+	var none *Plugin
+	assert.True(t, none.Keep(&msg{}))
+	assert.Nil(t, none.Key(record("k", "v")))
+	assert.Nil(t, GetPlugin("orders", Conf{}, 1))
+
+	path := filepath.Join(t.TempDir(), "plugin.wasm")
+	write(t, path, wasm(1, alloc, keepFilter, firstByteKey, upperTransform))
+	p, err := load("orders", Conf{Path: path}, 3)
+	assert.NoError(t, err)
+
+	assert.True(t, p.Keep(&msg{record("order-1", "v")}))
+	assert.False(t, p.Keep(&msg{record("x-1", "v")}))
+	assert.False(t, p.Keep(&msg{record("", "v")}))
+	assert.True(t, p.Keep("not a transform.Msg"))
+
+	assert.Equal(t, []byte("o"), p.Key(record("order-1", "v")))
+	assert.Nil(t, p.Key(record("", "v")))
+
+	value, err := p.Transform(record("order-1", "created"))
+	assert.NoError(t, err)
+	assert.Equal(t, "Created", string(value))
+
+	// concurrent calls run on instances of their own
+	done := make(chan bool)
+	for i := 0; i < 8; i++ {
+		go func() {
+			for j := 0; j < 50; j++ {
+				value, err := p.Transform(record("k", "abc"))
+				if err != nil || string(value) != "Abc" {
+					done <- false
+					return
+				}
+			}
+			done <- true
+		}()
+	}
+	for i := 0; i < 8; i++ {
+		assert.True(t, <-done)
+	}
+	// on at most an instance per worker and one for the source
+	assert.LessOrEqual(t, len(p.current.free), 4)
+
+	// without the function the message is kept as it is
+	write(t, path, wasm(1, alloc, firstByteKey))
+	reloaded, err := p.reload()
+	assert.True(t, reloaded)
+	assert.NoError(t, err)
+	assert.True(t, p.Keep(&msg{record("x-1", "v")}))
+	value, _ = p.Transform(record("k", "v"))
+	assert.Equal(t, "v", string(value))
+	reloaded, _ = p.reload()
+	assert.False(t, reloaded)
+}
+
+func TestPluginReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plugin.wasm")
+	write(t, path, wasm(1, alloc, firstByteKey))
+	p := GetPlugin("orders", Conf{Path: path, ReloadInterval: "10ms"}, 1)
+	assert.Nil(t, p.Key(record("", "v")))
+
+	// invalid modules are not loaded
+	write(t, path, []byte("not wasm"))
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, []byte("o"), p.Key(record("order", "v")))
+
+	write(t, path, wasm(1, alloc, keepFilter))
+	assert.Eventually(t, func() bool {
+		return !p.Keep(&msg{record("x", "v")})
+	}, time.Second, 10*time.Millisecond)
+	assert.Nil(t, p.Key(record("order", "v")))
+}
+
+func TestPluginLimits(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "spin.wasm")
+	write(t, path, wasm(1, alloc, spinFilter))
+	p, err := load("orders", Conf{Path: path, Timeout: "20ms"}, 1)
+	assert.NoError(t, err)
+	start := time.Now()
+	assert.True(t, p.Keep(&msg{record("k", "v")}))
+	assert.True(t, p.Keep(&msg{record("k", "v")}))
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+
+	path = filepath.Join(dir, "large.wasm")
+	write(t, path, wasm(32, alloc, keepFilter))
+	_, err = load("orders", Conf{Path: path, MaxMemoryMB: 1}, 1)
+	assert.Error(t, err)
+	_, err = load("orders", Conf{Path: path, MaxMemoryMB: 2}, 1)
+	assert.NoError(t, err)
+
+	// a call that can't get an instance fails, the transform with an error
+	path = filepath.Join(dir, "plugin.wasm")
+	write(t, path, wasm(1, alloc, keepFilter, upperTransform))
+	p, err = load("orders", Conf{Path: path}, 1)
+	assert.NoError(t, err)
+	p.current.free = nil
+	p.current.compiled.Close(context.Background())
+	_, err = p.Transform(record("k", "v"))
+	assert.Error(t, err)
+	assert.True(t, p.Keep(&msg{record("x-1", "v")}))
+
+	// calls beyond an instance per worker and one for the source wait for a
+	// free instance
+	p, err = load("orders", Conf{Path: path}, 1)
+	assert.NoError(t, err)
+	m, first, _ := p.acquire(Filter)
+	_, second, _ := p.acquire(Filter)
+	acquired := make(chan api.Module)
+	go func() {
+		_, third, _ := p.acquire(Filter)
+		acquired <- third
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("acquired an instance over the limit")
+	case <-time.After(20 * time.Millisecond):
+	}
+	p.release(m, first, false)
+	assert.Equal(t, first, <-acquired)
+	p.release(m, second, false)
+
+	path = filepath.Join(dir, "empty.wasm")
+	write(t, path, wasm(1, alloc))
+	_, err = load("orders", Conf{Path: path}, 1)
+	assert.EqualError(t, err, "plugin "+path+" has to export memory, alloc and one of filter, transform and key")
+}
+
+func TestEncode(t *testing.T) {
+	r := transform.Record{Topic: "t", Partition: 2, Offset: 3, Key: []byte("k"), Value: []byte("vv"), ID: "i", Headers: map[string]string{"b": "2", "a": "1"}}
+	assert.Equal(t, []byte{
+		1, 0, 0, 0, 'k',
+		2, 0, 0, 0, 'v', 'v',
+		1, 0, 0, 0, 't',
+		2, 0, 0, 0,
+		3, 0, 0, 0, 0, 0, 0, 0,
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+		1, 0, 0, 0, 'i',
+		2, 0, 0, 0,
+		1, 0, 0, 0, 'a', 1, 0, 0, 0, '1',
+		1, 0, 0, 0, 'b', 1, 0, 0, 0, '2',
+	}, encode(r))
+}
@@ -0,0 +1,123 @@
+package pulsar
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	pulsar "github.com/apache/pulsar-client-go/pulsar"
+)
+
+// cursorCommitter acks all messages of a partition up to and including id
+type cursorCommitter func(id pulsar.MessageID) error
+
+// cursorManager is the pulsar counterpart of the zookeeper offset manager used
+// by the kafka consumer group. Instead of acking every message, it records the
+// highest processed message per partition and acks it cumulatively every
+// interval and once more on Close.
+type cursorManager struct {
+	interval time.Duration
+	commit   cursorCommitter
+
+	l       sync.Mutex
+	cursors map[int32]*partitionCursor
+
+	closing, closed chan struct{}
+}
+
+type partitionCursor struct {
+	highestProcessed pulsar.MessageID
+	pending          bool // highestProcessed has not been acked yet
+}
+
+const defaultAckInterval = 1 * time.Second
+
+func newCursorManager(interval time.Duration, commit cursorCommitter) *cursorManager {
+	if interval <= 0 {
+		interval = defaultAckInterval
+	}
+	cm := &cursorManager{
+		interval: interval,
+		commit:   commit,
+		cursors:  make(map[int32]*partitionCursor),
+		closing:  make(chan struct{}),
+		closed:   make(chan struct{}),
+	}
+	go cm.cursorCommitter()
+	return cm
+}
+
+// markAsProcessed records id as the highest processed message of its
+// partition if it is ahead of any message seen before for that partition.
+// The CursorTracker hands over messages in the order they were consumed, so
+// the recorded message is always the end of a contiguous processed run.
+func (cm *cursorManager) markAsProcessed(id pulsar.MessageID) bool {
+	cm.l.Lock()
+	defer cm.l.Unlock()
+
+	cursor, ok := cm.cursors[id.PartitionIdx()]
+	if !ok {
+		cursor = &partitionCursor{}
+		cm.cursors[id.PartitionIdx()] = cursor
+	}
+	if cursor.highestProcessed != nil && !messageIDAfter(id, cursor.highestProcessed) {
+		return false
+	}
+	cursor.highestProcessed = id
+	cursor.pending = true
+	return true
+}
+
+// flush cumulatively acks every partition whose highest processed message
+// has not been acked yet
+func (cm *cursorManager) flush() error {
+	cm.l.Lock()
+	defer cm.l.Unlock()
+
+	var returnErr error
+	for partition, cursor := range cm.cursors {
+		if !cursor.pending {
+			continue
+		}
+		if err := cm.commit(cursor.highestProcessed); err != nil {
+			log.Printf("failed to ack cumulative %s for partition %d: %s \n", cursor.highestProcessed, partition, err)
+			returnErr = err
+			continue
+		}
+		cursor.pending = false
+	}
+	return returnErr
+}
+
+// Close stops the periodic ack and flushes whatever is pending
+func (cm *cursorManager) Close() error {
+	close(cm.closing)
+	<-cm.closed
+	return cm.flush()
+}
+
+func (cm *cursorManager) cursorCommitter() {
+	ticker := time.NewTicker(cm.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-cm.closing:
+			close(cm.closed)
+			return
+		case <-ticker.C:
+			cm.flush()
+		}
+	}
+}
+
+// messageIDAfter returns true if a comes after b in the same partition
+func messageIDAfter(a, b pulsar.MessageID) bool {
+	if a.LedgerID() != b.LedgerID() {
+		return a.LedgerID() > b.LedgerID()
+	}
+	if a.EntryID() != b.EntryID() {
+		return a.EntryID() > b.EntryID()
+	}
+	return a.BatchIdx() > b.BatchIdx()
+}
@@ -0,0 +1,53 @@
+package pulsar
+
+import (
+	"testing"
+	"time"
+
+	pulsar "github.com/apache/pulsar-client-go/pulsar"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCursorManagerAcksHighestPerPartition(t *testing.T) {
+	var acked []pulsar.MessageID
+	cm := newCursorManager(time.Hour, func(id pulsar.MessageID) error {
+		acked = append(acked, id)
+		return nil
+	})
+
+	assert.True(t, cm.markAsProcessed(pulsar.NewMessageID(1, 1, 0, 0)))
+	assert.True(t, cm.markAsProcessed(pulsar.NewMessageID(1, 2, 0, 0)))
+	assert.True(t, cm.markAsProcessed(pulsar.NewMessageID(1, 1, 0, 1)))
+	// an older message of partition 0 must not move its cursor back
+	assert.False(t, cm.markAsProcessed(pulsar.NewMessageID(1, 1, 0, 0)))
+
+	assert.Nil(t, cm.Close())
+	assert.Len(t, acked, 2)
+	for _, id := range acked {
+		if id.PartitionIdx() == 0 {
+			assert.Equal(t, int64(2), id.EntryID())
+		} else {
+			assert.Equal(t, int64(1), id.EntryID())
+		}
+	}
+}
+
+func TestCursorManagerAcksOnlyOnce(t *testing.T) {
+	count := 0
+	cm := newCursorManager(time.Hour, func(id pulsar.MessageID) error {
+		count++
+		return nil
+	})
+
+	cm.markAsProcessed(pulsar.NewMessageID(3, 7, 1, 0))
+	assert.Nil(t, cm.flush())
+	assert.Nil(t, cm.Close())
+	assert.Equal(t, 1, count)
+}
+
+func TestMessageIDAfter(t *testing.T) {
+	assert.True(t, messageIDAfter(pulsar.NewMessageID(2, 0, 0, 0), pulsar.NewMessageID(1, 9, 9, 0)))
+	assert.True(t, messageIDAfter(pulsar.NewMessageID(1, 3, 0, 0), pulsar.NewMessageID(1, 2, 5, 0)))
+	assert.True(t, messageIDAfter(pulsar.NewMessageID(1, 2, 6, 0), pulsar.NewMessageID(1, 2, 5, 0)))
+	assert.False(t, messageIDAfter(pulsar.NewMessageID(1, 2, 5, 0), pulsar.NewMessageID(1, 2, 5, 0)))
+}
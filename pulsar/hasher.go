@@ -3,6 +3,7 @@ package pulsar
 import (
 	"github.com/flipkart-incubator/go-dmux/core"
 	"hash/fnv"
+	"strings"
 )
 
 type MessageHasher struct {
@@ -13,8 +14,34 @@ func GetMessageHasher() core.Hasher {
 }
 
 func (m *MessageHasher) ComputeHash(data interface{}) int {
-	processor := data.(MessageProcessor)
 	hash32 := fnv.New32a()
-	hash32.Write([]byte(processor.GetRawMsg().Key()))
+	if k, ok := data.(core.OrderingKeyMsg); ok {
+		hash32.Write(k.GetOrderingKey())
+	} else {
+		hash32.Write([]byte(data.(MessageProcessor).GetRawMsg().Key()))
+	}
 	return int(hash32.Sum32())
 }
+
+// MessagePartitioner implements core.Partitioner for the partition distributor
+type MessagePartitioner struct {
+}
+
+func GetMessagePartitioner() core.Partitioner {
+	return new(MessagePartitioner)
+}
+
+// GetTopicPartition returns the topic and partition index of a message, the
+// topic of a partition of a partitioned topic is the partitioned topic
+func (m *MessagePartitioner) GetTopicPartition(data interface{}) (string, int32) {
+	msg := data.(MessageProcessor).GetRawMsg()
+	topic := msg.Topic()
+	if i := strings.LastIndex(topic, partitionSuffix); i >= 0 {
+		topic = topic[:i]
+	}
+	return topic, msg.ID().PartitionIdx()
+}
+
+// partitionSuffix precedes the index in the name of a partition of a
+// partitioned topic
+const partitionSuffix = "-partition-"
@@ -2,6 +2,8 @@ package pulsar
 
 import (
 	sink "github.com/flipkart-incubator/go-dmux/http"
+	"github.com/flipkart-incubator/go-dmux/logging"
+	"github.com/flipkart-incubator/go-dmux/tracing"
 	"log"
 	"time"
 )
@@ -21,8 +23,8 @@ type CursorTracker struct {
 }
 
 type CursorHook struct {
-	cursorTracker  PulsarCursorTracker
-	enableDebugLog bool
+	cursorTracker PulsarCursorTracker
+	logger        *logging.Logger
 }
 
 // Pre is invoked - before pulsar source pushes message to DMux. This implementation
@@ -35,15 +37,13 @@ func (t *CursorTracker) TrackMe(msg MessageProcessor) {
 	if len(t.ch) == t.size {
 		log.Printf("warning: pending_acks threshold %d reached, please increase pending_acks size \n", t.size)
 	}
+	t.source.health.Tracked()
 	t.ch <- msg
 }
 
 // PreHTTPCall is invoked - before HttpSink execution.
 func (h *CursorHook) PreHTTPCall(msg interface{}) {
-	if h.enableDebugLog {
-		data := msg.(sink.HTTPMsg)
-		log.Printf("%s before http sink \n", data.GetDebugPath())
-	}
+	h.debug(msg, "before http sink")
 }
 
 // PostHTTPCall is invoked - after HttpSink execution. This implementation calls
@@ -54,10 +54,18 @@ func (h *CursorHook) PostHTTPCall(msg interface{}, success bool) {
 	if success {
 		data.MarkDone()
 	}
-	if h.enableDebugLog {
-		data := msg.(sink.HTTPMsg)
-		log.Printf("%s after http sink, status = %t \n", data.GetDebugPath(), success)
+	h.debug(msg, "after http sink, status = %t", success)
+}
+
+// debug logs a sample of the messages passing the hook with their topic and
+// partition
+func (h *CursorHook) debug(msg interface{}, format string, args ...interface{}) {
+	if !h.logger.DebugEnabled() {
+		return
 	}
+	raw := msg.(MessageProcessor).GetRawMsg()
+	path := msg.(sink.HTTPMsg).GetDebugPath()
+	h.logger.WithPartition(raw.Topic(), raw.ID().PartitionIdx()).SampledDebugf(path+" "+format, args...)
 }
 
 func GetCursorTracker(size int, source *PulsarSource) PulsarCursorTracker {
@@ -66,12 +74,15 @@ func GetCursorTracker(size int, source *PulsarSource) PulsarCursorTracker {
 		source: source,
 		size:   size,
 	}
+	source.alerts.WatchPendingAcks(func() (int, int) {
+		return len(t.ch), t.size
+	})
 	go t.run()
 	return t
 }
 
-func GetPulsarHook(tracker PulsarCursorTracker, enableDebugLog bool) *CursorHook {
-	return &CursorHook{tracker, enableDebugLog}
+func GetPulsarHook(tracker PulsarCursorTracker, logger *logging.Logger) *CursorHook {
+	return &CursorHook{tracker, logger}
 }
 
 func (t *CursorTracker) run() {
@@ -81,5 +92,7 @@ func (t *CursorTracker) run() {
 		}
 
 		t.source.commitCursor(msg)
+		t.source.health.Committed()
+		tracing.TraceOf(msg).Committed()
 	}
 }
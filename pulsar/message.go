@@ -3,7 +3,11 @@ package pulsar
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/flipkart-incubator/go-dmux/core"
 	sink "github.com/flipkart-incubator/go-dmux/http"
+	"github.com/flipkart-incubator/go-dmux/plugin"
+	"github.com/flipkart-incubator/go-dmux/tracing"
+	"github.com/flipkart-incubator/go-dmux/transform"
 	"strconv"
 	"strings"
 
@@ -15,12 +19,38 @@ type Message struct {
 	Msg       *pulsar.ConsumerMessage
 	Processed bool
 	Sidelined bool
+
+	Trace *tracing.Trace // nil unless tracing is enabled
+
+	OrderingKey []byte // key the message is distributed by
+	Payload     []byte // payload as transformed by the sink, nil to post the payload of the message
 }
 
 func (m *Message) GetPayload() []byte {
+	if m.Payload != nil {
+		return m.Payload
+	}
 	return m.Msg.Payload()
 }
 
+// GetTransformRecord implements transform.Msg interface
+func (m *Message) GetTransformRecord() transform.Record {
+	return transform.Record{
+		Topic:     m.Msg.Topic(),
+		Partition: m.Msg.ID().PartitionIdx(),
+		ID:        m.Msg.ID().String(),
+		Key:       []byte(m.Msg.Key()),
+		Timestamp: m.Msg.PublishTime(),
+		Headers:   m.Msg.Properties(),
+		Value:     m.Msg.Payload(),
+	}
+}
+
+// SetPayload implements transform.Msg interface
+func (m *Message) SetPayload(payload []byte) {
+	m.Payload = payload
+}
+
 // GetDebugPath implements HTTPMsg interface
 func (m *Message) GetDebugPath() string {
 	return fmt.Sprintf("/%s/%s/%s/%s/%s/%s",
@@ -42,7 +72,7 @@ func (m *Message) GetURL(endpoint string) string {
 		strconv.FormatInt(m.Msg.ID().EntryID(), 10),
 		strconv.FormatInt(m.Msg.ID().LedgerID(), 10),
 		strconv.FormatInt(int64(m.Msg.ID().BatchIdx()), 10)))
-	url := strings.Replace(endpoint, CustomURLKey, m.Msg.Key(), 1)
+	url := strings.Replace(endpoint, CustomURLKey, string(m.OrderingKey), 1)
 	return url + builder.String()
 }
 
@@ -57,12 +87,12 @@ func (m *Message) GetHeaders(conf sink.HTTPSinkConf) map[string]string {
 	return header
 }
 
-// CustomURLKey  place holder name, which will be replaced by kafka key
+// CustomURLKey  place holder name, which will be replaced by the ordering key
 const CustomURLKey = "__KEY_NAME__"
 
 // BatchURL implements HTTPMsg interface
 func (m *Message) BatchURL(msgs []interface{}, endpoint string, version int) string {
-	url := strings.Replace(endpoint, CustomURLKey, m.Msg.Key(), 1)
+	url := strings.Replace(endpoint, CustomURLKey, string(m.OrderingKey), 1)
 	url = url + "/bulk"
 
 	var builder strings.Builder
@@ -125,16 +155,58 @@ func (m *Message) IsProcessed() bool {
 	return m.Processed
 }
 
+// GetTrace implements tracing.Traced
+func (m *Message) GetTrace() *tracing.Trace {
+	return m.Trace
+}
+
+// GetOrderingKey implements core.OrderingKeyMsg
+func (m *Message) GetOrderingKey() []byte {
+	return m.OrderingKey
+}
+
 type PulsarMessageFactoryImpl struct {
+	keys   *core.KeyExtractor
+	plugin *plugin.Plugin
 }
 
-func (*PulsarMessageFactoryImpl) Create(msg pulsar.ConsumerMessage) MessageProcessor {
-	return &Message{
+func (f *PulsarMessageFactoryImpl) Create(msg pulsar.ConsumerMessage) MessageProcessor {
+	m := &Message{
 		Msg:       &msg,
 		Processed: false,
+		Trace:     startTrace(msg),
+	}
+	if f.plugin != nil {
+		m.OrderingKey = f.plugin.Key(m.GetTransformRecord())
+	}
+	if m.OrderingKey == nil {
+		m.OrderingKey = f.keys.Extract([]byte(msg.Key()), msg.Payload(), property(msg))
+	}
+	return m
+}
+
+// property looks up the properties of msg
+func property(msg pulsar.ConsumerMessage) func(name string) []byte {
+	return func(name string) []byte {
+		if value, ok := msg.Properties()[name]; ok {
+			return []byte(value)
+		}
+		return nil
+	}
+}
+
+// startTrace starts the Trace of msg, continuing the trace of its traceparent
+// property if it has one
+func startTrace(msg pulsar.ConsumerMessage) *tracing.Trace {
+	if !tracing.Enabled() {
+		return nil
 	}
+	return tracing.StartTrace(msg.Properties()[tracing.Header],
+		tracing.String("messaging.system", "pulsar"),
+		tracing.String("messaging.destination", msg.Topic()),
+		tracing.String("messaging.message_id", msg.ID().String()))
 }
 
-func getPulsarMessageFactory() *PulsarMessageFactoryImpl {
-	return new(PulsarMessageFactoryImpl)
+func getPulsarMessageFactory(keys *core.KeyExtractor, pl *plugin.Plugin) *PulsarMessageFactoryImpl {
+	return &PulsarMessageFactoryImpl{keys, pl}
 }
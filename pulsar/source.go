@@ -8,6 +8,11 @@ import (
 	"time"
 
 	pulsar "github.com/apache/pulsar-client-go/pulsar"
+	"github.com/flipkart-incubator/go-dmux/alerting"
+	"github.com/flipkart-incubator/go-dmux/core"
+	"github.com/flipkart-incubator/go-dmux/filter"
+	"github.com/flipkart-incubator/go-dmux/health"
+	"github.com/flipkart-incubator/go-dmux/plugin"
 )
 
 type PulsarSource struct {
@@ -15,11 +20,17 @@ type PulsarSource struct {
 	client   pulsar.Client
 	hook     SourceHook
 	consumer pulsar.Consumer
+	cursors  *cursorManager // set when acking cumulatively
+
+	health *health.Connection   // readiness signals of the connection, nil if not reported
+	alerts *alerting.Connection // alert signals of the connection, nil if not reported
+	keys   *core.KeyExtractor   // extracts the ordering key of messages, nil for their key
+	filter *filter.Filter       // drops messages before they are pushed, nil to push every message
+	plugin *plugin.Plugin       // filters and keys messages after filter, nil if there is none
 }
 
 func (p *PulsarSource) GetKey(msg interface{}) []byte {
-	//TODO implement me
-	panic("implement me")
+	return msg.(*Message).OrderingKey
 }
 
 func (p *PulsarSource) GetPartition(msg interface{}) int32 {
@@ -45,6 +56,35 @@ func GetPulsarSource(conf PulsarConf) *PulsarSource {
 	return &PulsarSource{conf: conf}
 }
 
+// SetHealth makes the source report readiness signals to h
+func (p *PulsarSource) SetHealth(h *health.Connection) {
+	p.health = h
+}
+
+// SetFilter makes the source drop the messages f does not keep, they are
+// marked done without being pushed
+func (p *PulsarSource) SetFilter(f *filter.Filter) {
+	p.filter = f
+}
+
+// SetPlugin makes the source drop the messages the filter function of p
+// drops and key messages with its key function
+func (p *PulsarSource) SetPlugin(pl *plugin.Plugin) {
+	p.plugin = pl
+}
+
+// SetKeyExtractor makes the source extract the ordering key of messages with
+// keys
+func (p *PulsarSource) SetKeyExtractor(keys *core.KeyExtractor) {
+	p.keys = keys
+}
+
+// SetAlerts makes the cursor tracker of the source report alert signals to
+// a, it has to be called before the tracker is created
+func (p *PulsarSource) SetAlerts(a *alerting.Connection) {
+	p.alerts = a
+}
+
 // Generate is Source method implementation, which connects to Pulsar and pushes
 // PulsarMessage into the channel
 func (p *PulsarSource) Generate(out chan<- interface{}) {
@@ -101,7 +141,7 @@ func (p *PulsarSource) Generate(out chan<- interface{}) {
 
 	if p.conf.ForceRestart && p.conf.ReadNewest {
 
-		log.Println("Setting force restart as true and readnewest as true, the consumers will start listenning from time  = %v", time.Now().UTC())
+		log.Printf("Setting force restart as true and readnewest as true, the consumers will start listenning from time  = %v \n", time.Now().UTC())
 		//er := consumer.Seek(pulsar.EarliestMessageID())
 		er := consumer.SeekByTime(time.Now().UTC())
 		if er != nil {
@@ -132,9 +172,21 @@ func (p *PulsarSource) Generate(out chan<- interface{}) {
 		log.Println("no specific configs were given during the start of this topology, will use the sane defaults")
 	}
 
+	if p.conf.AckCumulative {
+		if subsriptionType == pulsar.Failover {
+			p.cursors = newCursorManager(p.conf.AckInterval.Duration, consumer.AckIDCumulative)
+			log.Printf("acking cumulatively every %v \n", p.cursors.interval)
+		} else {
+			log.Printf("warning: ack_cumulative is only supported for failover subscriptions, acking individually \n")
+		}
+	}
+
 	p.client = client
 	p.consumer = consumer
-	pulsarMessageFactoryImpl := getPulsarMessageFactory()
+	pulsarMessageFactoryImpl := getPulsarMessageFactory(p.keys, p.plugin)
+	p.health.Joined(true)
+	p.health.Producing(true)
+	defer p.health.Producing(false)
 
 	// Receive messages from channel. The channel returns a struct which contains message and the consumer from where
 	// the message was received. It's not necessary here since we have 1 single consumer, but the channel could be
@@ -144,17 +196,38 @@ func (p *PulsarSource) Generate(out chan<- interface{}) {
 		if p.hook != nil {
 			p.hook.Pre(processor)
 		}
+		if !p.filter.Keep(&filter.Record{
+			Topic:     cm.Topic(),
+			Partition: cm.ID().PartitionIdx(),
+			Key:       []byte(cm.Key()),
+			Value:     cm.Payload(),
+			Header:    property(cm),
+		}) || !p.plugin.Keep(processor) {
+			processor.MarkDone()
+			continue
+		}
+		p.health.Push()
 		out <- processor
+		p.health.Pushed()
 	}
 }
 
 // Stop method implements Source interface stop method, to Stop the KafkaConsumer
 func (p *PulsarSource) Stop() {
+	if p.cursors != nil {
+		if err := p.cursors.Close(); err != nil {
+			log.Printf("failed to flush cumulative acks on stop: %s \n", err)
+		}
+	}
 	p.consumer.Close()
 	p.client.Close()
 }
 
 func (p *PulsarSource) commitCursor(data MessageProcessor) {
+	if p.cursors != nil {
+		p.cursors.markAsProcessed(data.GetRawMsg().ID())
+		return
+	}
 	log.Printf("going to ack message " + data.GetRawMsg().Key() + " " + data.GetRawMsg().ID().String() + "\n")
 	p.consumer.Ack(data.GetRawMsg())
 }
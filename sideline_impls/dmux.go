@@ -1,9 +1,13 @@
 package sideline_impls
 
 import (
+	"github.com/flipkart-incubator/go-dmux/admin"
+	"github.com/flipkart-incubator/go-dmux/alerting"
 	co "github.com/flipkart-incubator/go-dmux/config"
+	"github.com/flipkart-incubator/go-dmux/health"
 	"github.com/flipkart-incubator/go-dmux/logging"
 	"github.com/flipkart-incubator/go-dmux/metrics"
+	"github.com/flipkart-incubator/go-dmux/tracing"
 	"log"
 )
 
@@ -20,24 +24,36 @@ func (d *DmuxCustom) DmuxStart(path string, sidelineImp interface{}) {
 	}
 	conf := dconf.GetDmuxConf()
 
-	dmuxLogging := new(logging.DMuxLogging)
 	//_ = new(logging.DMuxLogging)
 
 	log.Printf("config: %v \n", conf)
 
 	//start showing metrics at the endpoint
-	metrics.Start(conf.MetricPort)
+	metrics.Start(conf.Metrics, conf.MetricPort, conf.LegacyOffsetMetrics)
+
+	//start tracing, if enabled
+	tracing.Start(conf.Tracing)
+
+	//start evaluating alerts
+	alerting.Start(conf.Alerting)
+
+	//start admin endpoints
+	health.Start(conf.Health)
+	admin.Handle("/admin/log/level", logging.LevelHandler())
+	admin.Handle("/health/live", health.LiveHandler())
+	admin.Handle("/health/ready", health.ReadyHandler())
+	admin.Start(conf.AdminPort)
 
 	for _, item := range conf.DMuxItems {
 		log.Println(item.ConnType)
 		if item.SidelineEnable {
-			go func(connType co.ConnectionType, connConf interface{}, logDebug bool) {
-				connType.Start(connConf, logDebug, sidelineImp)
-			}(item.ConnType, item.Connection, dmuxLogging.EnableDebug)
+			go func(name string, connType co.ConnectionType, connConf interface{}) {
+				connType.Run(name, connConf, sidelineImp)
+			}(item.Name, item.ConnType, item.Connection)
 		} else {
-			go func(connType co.ConnectionType, connConf interface{}, logDebug bool) {
-				connType.Start(connConf, logDebug, nil)
-			}(item.ConnType, item.Connection, dmuxLogging.EnableDebug)
+			go func(name string, connType co.ConnectionType, connConf interface{}) {
+				connType.Run(name, connConf, nil)
+			}(item.Name, item.ConnType, item.Connection)
 		}
 	}
 
@@ -0,0 +1,129 @@
+package tracing
+
+import (
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+const statusError = 2 // STATUS_CODE_ERROR
+
+func (t *tracer) request(spans []*Span) otlpRequest {
+	exported := make([]otlpSpan, len(spans))
+	for i, s := range spans {
+		exported[i] = encodeSpan(s)
+	}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: encodeAttributes([]Attribute{
+			String("service.name", t.conf.ServiceName),
+		})},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: defaultServiceName},
+			Spans: exported,
+		}},
+	}}}
+}
+
+func encodeSpan(s *Span) otlpSpan {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	span := otlpSpan{
+		TraceID:           hex.EncodeToString(s.context.TraceID[:]),
+		SpanID:            hex.EncodeToString(s.context.SpanID[:]),
+		Name:              s.name,
+		Kind:              int(s.kind),
+		StartTimeUnixNano: unixNano(s.start),
+		EndTimeUnixNano:   unixNano(s.end),
+		Attributes:        encodeAttributes(s.attributes),
+	}
+	if s.parent != [8]byte{} {
+		span.ParentSpanID = hex.EncodeToString(s.parent[:])
+	}
+	for _, link := range s.links {
+		span.Links = append(span.Links, otlpLink{
+			TraceID: hex.EncodeToString(link.TraceID[:]),
+			SpanID:  hex.EncodeToString(link.SpanID[:]),
+		})
+	}
+	if s.failed {
+		span.Status = &otlpStatus{Code: statusError, Message: s.message}
+	}
+	return span
+}
+
+func encodeAttributes(attributes []Attribute) []otlpAttribute {
+	encoded := make([]otlpAttribute, 0, len(attributes))
+	for _, a := range attributes {
+		switch v := a.Value.(type) {
+		case string:
+			encoded = append(encoded, otlpAttribute{Key: a.Key, Value: otlpValue{StringValue: &v}})
+		case int64:
+			i := strconv.FormatInt(v, 10)
+			encoded = append(encoded, otlpAttribute{Key: a.Key, Value: otlpValue{IntValue: &i}})
+		}
+	}
+	return encoded
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// json encoding of the OTLP ExportTraceServiceRequest, ids are hex and 64 bit
+// integers are strings
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Links             []otlpLink      `json:"links,omitempty"`
+	Status            *otlpStatus     `json:"status,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+
+type otlpLink struct {
+	TraceID string `json:"traceId"`
+	SpanID  string `json:"spanId"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
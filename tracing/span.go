@@ -0,0 +1,219 @@
+package tracing
+
+import (
+	"encoding/hex"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SpanContext identifies a span across processes, as carried by the W3C
+// traceparent header
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+}
+
+// IsValid returns false for the zero SpanContext
+func (c SpanContext) IsValid() bool {
+	return c.TraceID != [16]byte{} && c.SpanID != [8]byte{}
+}
+
+// Traceparent formats c as a W3C traceparent header value
+func (c SpanContext) Traceparent() string {
+	flags := "00"
+	if c.Sampled {
+		flags = "01"
+	}
+	return "00-" + hex.EncodeToString(c.TraceID[:]) + "-" + hex.EncodeToString(c.SpanID[:]) + "-" + flags
+}
+
+// ParseTraceparent parses a W3C traceparent header value, ok is false if it
+// is not valid
+func ParseTraceparent(value string) (c SpanContext, ok bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" ||
+		len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return c, false
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return c, false
+	}
+	var flags [1]byte
+	if _, err := hex.Decode(c.TraceID[:], []byte(parts[1])); err != nil {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(c.SpanID[:], []byte(parts[2])); err != nil {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return SpanContext{}, false
+	}
+	c.Sampled = flags[0]&1 == 1
+	return c, c.IsValid()
+}
+
+// Attribute is a key value pair recorded on a span, Value is a string or an
+// int64
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// String returns a string Attribute
+func String(key, value string) Attribute {
+	return Attribute{key, value}
+}
+
+// Int returns an int64 Attribute
+func Int(key string, value int64) Attribute {
+	return Attribute{key, value}
+}
+
+// Kind of a span, values as in OTLP
+type Kind int
+
+const (
+	KindInternal Kind = 1
+	KindClient   Kind = 3
+	KindConsumer Kind = 5
+)
+
+// Span is a timed operation. A nil *Span is valid and does nothing, it is
+// what every function returns while tracing is disabled. Spans which are not
+// sampled are only propagated, they are never exported
+type Span struct {
+	name       string
+	kind       Kind
+	context    SpanContext
+	parent     [8]byte
+	start, end time.Time
+	attributes []Attribute
+	links      []SpanContext
+	failed     bool
+	message    string
+
+	l sync.Mutex
+}
+
+// StartSpan starts a span, as a child of parent if parent is valid or as the
+// root of a new trace otherwise. It returns nil if tracing is disabled
+func StartSpan(name string, parent SpanContext, attributes ...Attribute) *Span {
+	t := current()
+	if t == nil {
+		return nil
+	}
+	s := &Span{name: name, kind: KindInternal, start: time.Now(), attributes: attributes}
+	if parent.IsValid() {
+		s.context.TraceID = parent.TraceID
+		s.context.Sampled = parent.Sampled
+		s.parent = parent.SpanID
+	} else {
+		s.context.TraceID = t.ids.traceID()
+		s.context.Sampled = t.sample()
+	}
+	s.context.SpanID = t.ids.spanID()
+	return s
+}
+
+// Child starts a span with s as its parent
+func (s *Span) Child(name string, attributes ...Attribute) *Span {
+	if s == nil {
+		return nil
+	}
+	return StartSpan(name, s.context, attributes...)
+}
+
+// Context returns the SpanContext of s, the zero SpanContext for nil
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.context
+}
+
+// SetKind sets the Kind of s, spans are KindInternal by default
+func (s *Span) SetKind(kind Kind) {
+	if s == nil {
+		return
+	}
+	s.kind = kind
+}
+
+// SetAttributes records attributes on s
+func (s *Span) SetAttributes(attributes ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.l.Lock()
+	s.attributes = append(s.attributes, attributes...)
+	s.l.Unlock()
+}
+
+// AddLink links s to another span, e.g. a batch to the spans of its messages
+func (s *Span) AddLink(c SpanContext) {
+	if s == nil || !c.IsValid() {
+		return
+	}
+	s.l.Lock()
+	s.links = append(s.links, c)
+	s.l.Unlock()
+}
+
+// SetError marks s as failed
+func (s *Span) SetError(message string) {
+	if s == nil {
+		return
+	}
+	s.l.Lock()
+	s.failed = true
+	s.message = message
+	s.l.Unlock()
+}
+
+// End ends s and queues it for export if it is sampled
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.l.Lock()
+	if !s.end.IsZero() {
+		s.l.Unlock()
+		return
+	}
+	s.end = time.Now()
+	s.l.Unlock()
+	if t := current(); t != nil && s.context.Sampled {
+		t.export(s)
+	}
+}
+
+// idGenerator generates random trace and span ids
+type idGenerator struct {
+	l      sync.Mutex
+	random *rand.Rand
+}
+
+func newIDGenerator() *idGenerator {
+	return &idGenerator{random: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+func (g *idGenerator) traceID() (id [16]byte) {
+	g.l.Lock()
+	defer g.l.Unlock()
+	for id == [16]byte{} {
+		g.random.Read(id[:])
+	}
+	return id
+}
+
+func (g *idGenerator) spanID() (id [8]byte) {
+	g.l.Lock()
+	defer g.l.Unlock()
+	for id == [8]byte{} {
+		g.random.Read(id[:])
+	}
+	return id
+}
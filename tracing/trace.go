@@ -0,0 +1,83 @@
+package tracing
+
+import "sync"
+
+// Header is the W3C header carrying a SpanContext between processes
+const Header = "traceparent"
+
+// Trace holds the spans of one message through dmux. Its root span
+// dmux.message lasts from the source until the offset of the message is
+// committed, with the children dmux.queue until the sink picks the message up
+// and dmux.commit from the end of the sink until the commit. A nil *Trace is
+// valid and does nothing
+type Trace struct {
+	root, queue *Span
+
+	l      sync.Mutex
+	commit *Span
+}
+
+// Traced is implemented by messages which carry a Trace
+type Traced interface {
+	GetTrace() *Trace
+}
+
+// TraceOf returns the Trace of msg, nil if msg is not Traced
+func TraceOf(msg interface{}) *Trace {
+	if t, ok := msg.(Traced); ok {
+		return t.GetTrace()
+	}
+	return nil
+}
+
+// StartTrace starts the Trace of a message as part of the trace in its
+// traceparent header, or of a new trace if traceparent is not valid. It
+// returns nil if tracing is disabled
+func StartTrace(traceparent string, attributes ...Attribute) *Trace {
+	parent, _ := ParseTraceparent(traceparent)
+	root := StartSpan("dmux.message", parent, attributes...)
+	if root == nil {
+		return nil
+	}
+	root.SetKind(KindConsumer)
+	return &Trace{root: root, queue: root.Child("dmux.queue")}
+}
+
+// Span returns the root span of t
+func (t *Trace) Span() *Span {
+	if t == nil {
+		return nil
+	}
+	return t.root
+}
+
+// Dequeued ends the queue wait of the message
+func (t *Trace) Dequeued() {
+	if t == nil {
+		return
+	}
+	t.queue.End()
+}
+
+// Processed starts the wait for the offset commit once the sink is done
+func (t *Trace) Processed() {
+	if t == nil {
+		return
+	}
+	t.l.Lock()
+	if t.commit == nil {
+		t.commit = t.root.Child("dmux.commit")
+	}
+	t.l.Unlock()
+}
+
+// Committed ends the Trace once the offset of the message is committed
+func (t *Trace) Committed() {
+	if t == nil {
+		return
+	}
+	t.Processed()
+	t.queue.End()
+	t.commit.End()
+	t.root.End()
+}
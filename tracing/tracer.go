@@ -0,0 +1,190 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Conf holds the tracing configuration
+type Conf struct {
+	Enabled     bool              `json:"enabled"`
+	Endpoint    string            `json:"endpoint"`     //traces url of the collector, defaults to http://localhost:4318/v1/traces
+	Headers     map[string]string `json:"headers"`      //added to every push, e.g. for authentication
+	ServiceName string            `json:"service_name"` //service.name of the resource, defaults to go-dmux
+	SampleRatio *float64          `json:"sample_ratio"` //ratio of new traces which are sampled, defaults to 1. Traces continued from a traceparent keep its decision
+	Interval    string            `json:"interval"`     //longest a span waits before it is pushed, defaults to 5s
+}
+
+const (
+	defaultEndpoint    = "http://localhost:4318/v1/traces"
+	defaultServiceName = "go-dmux"
+	defaultInterval    = 5 * time.Second
+	queueSize          = 4096
+	maxBatchSize       = 512
+)
+
+// tracer exports ended spans to the collector in batches, using the http/json
+// encoding of OTLP. Spans are dropped rather than blocking when the queue is
+// full
+type tracer struct {
+	conf   Conf
+	ratio  float64
+	ids    *idGenerator
+	client *http.Client
+
+	spans chan *Span
+	flush chan chan struct{}
+}
+
+var (
+	l      sync.RWMutex
+	global *tracer
+)
+
+func current() *tracer {
+	l.RLock()
+	defer l.RUnlock()
+	return global
+}
+
+// Enabled returns true once tracing is started
+func Enabled() bool {
+	return current() != nil
+}
+
+// Start enables tracing if conf is enabled, every span started before is
+// nil and so not traced
+func Start(conf Conf) {
+	if !conf.Enabled {
+		return
+	}
+	if conf.Endpoint == "" {
+		conf.Endpoint = defaultEndpoint
+	}
+	if conf.ServiceName == "" {
+		conf.ServiceName = defaultServiceName
+	}
+	interval := defaultInterval
+	if conf.Interval != "" {
+		var err error
+		if interval, err = time.ParseDuration(conf.Interval); err != nil {
+			log.Fatal("invalid tracing interval " + err.Error())
+		}
+	}
+	ratio := 1.0
+	if conf.SampleRatio != nil {
+		ratio = *conf.SampleRatio
+	}
+
+	t := &tracer{
+		conf:   conf,
+		ratio:  ratio,
+		ids:    newIDGenerator(),
+		client: &http.Client{Timeout: 10 * time.Second},
+		spans:  make(chan *Span, queueSize),
+		flush:  make(chan chan struct{}),
+	}
+	go t.run(interval)
+
+	l.Lock()
+	global = t
+	l.Unlock()
+	log.Printf("tracing to %s \n", conf.Endpoint)
+}
+
+// Flush pushes every span ended so far and returns once they were pushed
+func Flush() {
+	if t := current(); t != nil {
+		done := make(chan struct{})
+		t.flush <- done
+		<-done
+	}
+}
+
+func (t *tracer) sample() bool {
+	if t.ratio >= 1 {
+		return true
+	}
+	t.ids.l.Lock()
+	defer t.ids.l.Unlock()
+	return t.ids.random.Float64() < t.ratio
+}
+
+func (t *tracer) export(s *Span) {
+	select {
+	case t.spans <- s:
+	default:
+	}
+}
+
+func (t *tracer) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var batch []*Span
+	push := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := t.push(batch); err != nil {
+			log.Printf("failed to push %d spans %s \n", len(batch), err.Error())
+		}
+		batch = nil
+	}
+
+	for {
+		select {
+		case s := <-t.spans:
+			batch = append(batch, s)
+			if len(batch) >= maxBatchSize {
+				push()
+			}
+		case <-ticker.C:
+			push()
+		case done := <-t.flush:
+			for drained := false; !drained; {
+				select {
+				case s := <-t.spans:
+					batch = append(batch, s)
+				default:
+					drained = true
+				}
+			}
+			push()
+			close(done)
+		}
+	}
+}
+
+func (t *tracer) push(spans []*Span) error {
+	payload, err := json.Marshal(t.request(spans))
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("POST", t.conf.Endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for key, val := range t.conf.Headers {
+		request.Header.Set(key, val)
+	}
+	response, err := t.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	io.Copy(ioutil.Discard, response.Body)
+	if response.StatusCode >= 300 {
+		return errors.New("collector responded " + strconv.Itoa(response.StatusCode))
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package tracing
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTraceparent(t *testing.T) {
+	c, ok := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	assert.True(t, ok)
+	assert.True(t, c.Sampled)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", hex.EncodeToString(c.TraceID[:]))
+	assert.Equal(t, "00f067aa0ba902b7", hex.EncodeToString(c.SpanID[:]))
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", c.Traceparent())
+
+	c, ok = ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-future")
+	assert.True(t, ok)
+	assert.False(t, c.Sampled)
+
+	for _, invalid := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01",
+	} {
+		_, ok := ParseTraceparent(invalid)
+		assert.False(t, ok, invalid)
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	var trace *Trace
+	trace.Dequeued()
+	trace.Processed()
+	trace.Committed()
+	assert.Nil(t, trace.Span())
+	assert.False(t, trace.Span().Context().IsValid())
+	assert.Nil(t, trace.Span().Child("child"))
+	assert.Nil(t, TraceOf("not traced"))
+}
+
+func TestTraceExport(t *testing.T) {
+	requests := make(chan otlpRequest, 10)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req otlpRequest
+		body, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(body, &req)
+		requests <- req
+	}))
+	defer collector.Close()
+
+	// stands in for the http sink endpoint
+	traceparents := make(chan string, 10)
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparents <- r.Header.Get(Header)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer endpoint.Close()
+
+	Start(Conf{Enabled: true, Endpoint: collector.URL, ServiceName: "dmux-test"})
+	defer func() {
+		l.Lock()
+		global = nil
+		l.Unlock()
+	}()
+
+	trace := StartTrace("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", String("messaging.system", "kafka"))
+	trace.Dequeued()
+	attempt := trace.Span().Child("HTTP POST")
+	attempt.SetKind(KindClient)
+	request, _ := http.NewRequest("POST", endpoint.URL, nil)
+	request.Header.Set(Header, attempt.Context().Traceparent())
+	response, err := http.DefaultClient.Do(request)
+	assert.NoError(t, err)
+	response.Body.Close()
+	attempt.SetError("503")
+	attempt.End()
+	trace.Processed()
+	trace.Committed()
+	Flush()
+
+	propagated, ok := ParseTraceparent(<-traceparents)
+	assert.True(t, ok)
+	assert.Equal(t, attempt.Context(), propagated)
+
+	req := <-requests
+	assert.Equal(t, "dmux-test", *req.ResourceSpans[0].Resource.Attributes[0].Value.StringValue)
+	spans := make(map[string]otlpSpan)
+	for _, s := range req.ResourceSpans[0].ScopeSpans[0].Spans {
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", s.TraceID)
+		spans[s.Name] = s
+	}
+	assert.Len(t, spans, 4)
+
+	root := spans["dmux.message"]
+	assert.Equal(t, "00f067aa0ba902b7", root.ParentSpanID)
+	assert.Equal(t, int(KindConsumer), root.Kind)
+	assert.Equal(t, "kafka", *root.Attributes[0].Value.StringValue)
+	assert.Equal(t, root.SpanID, spans["dmux.queue"].ParentSpanID)
+	assert.Equal(t, root.SpanID, spans["dmux.commit"].ParentSpanID)
+
+	exported := spans["HTTP POST"]
+	assert.Equal(t, root.SpanID, exported.ParentSpanID)
+	assert.Equal(t, hex.EncodeToString(propagated.SpanID[:]), exported.SpanID)
+	assert.Equal(t, &otlpStatus{Code: statusError, Message: "503"}, exported.Status)
+}
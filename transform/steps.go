@@ -0,0 +1,433 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// payload is the payload between steps, as bytes, as decoded json or both
+type payload struct {
+	raw      []byte
+	value    interface{}
+	hasRaw   bool
+	hasValue bool
+}
+
+func (p *payload) bytes() ([]byte, error) {
+	if !p.hasRaw {
+		b, err := json.Marshal(p.value)
+		if err != nil {
+			return nil, err
+		}
+		p.raw, p.hasRaw = b, true
+	}
+	return p.raw, nil
+}
+
+// json returns the payload decoded as json, numbers as json.Number
+func (p *payload) json() (interface{}, error) {
+	if !p.hasValue {
+		d := json.NewDecoder(bytes.NewReader(p.raw))
+		d.UseNumber()
+		var v interface{}
+		if err := d.Decode(&v); err != nil {
+			return nil, fmt.Errorf("payload is not json: %v", err)
+		}
+		if d.More() {
+			return nil, errors.New("payload is not json: data after the value")
+		}
+		p.value, p.hasValue = v, true
+	}
+	return p.value, nil
+}
+
+// object returns the payload decoded as a json object
+func (p *payload) object() (map[string]interface{}, error) {
+	v, err := p.json()
+	if err != nil {
+		return nil, err
+	}
+	o, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("payload is not a json object")
+	}
+	return o, nil
+}
+
+func (p *payload) setValue(v interface{}) {
+	p.value, p.hasValue = v, true
+	p.raw, p.hasRaw = nil, false
+}
+
+func (p *payload) setRaw(b []byte) {
+	p.raw, p.hasRaw = b, true
+	p.value, p.hasValue = nil, false
+}
+
+// compile returns the step of s
+func compile(s Step) (step, error) {
+	switch s.Type {
+	case Envelope:
+		e := envelope{field: s.Field, metadata: s.Metadata}
+		if e.field == "" {
+			e.field = "value"
+		}
+		if len(e.metadata) == 0 {
+			e.metadata = []string{"topic", "partition", "offset", "key", "timestamp", "headers", "id"}
+		}
+		for _, m := range e.metadata {
+			switch m {
+			case "topic", "partition", "offset", "key", "timestamp", "headers", "id":
+			default:
+				return nil, errors.New("unknown envelope metadata " + m)
+			}
+		}
+		return e, nil
+	case Project:
+		if len(s.Fields) == 0 {
+			return nil, errors.New("project needs fields")
+		}
+		var p project
+		for _, f := range s.Fields {
+			p = append(p, strings.Split(f, "."))
+		}
+		return p, nil
+	case Rename:
+		if len(s.Rename) == 0 {
+			return nil, errors.New("rename needs rename")
+		}
+		var r rename
+		for from := range s.Rename {
+			r = append(r, [2][]string{strings.Split(from, "."), strings.Split(s.Rename[from], ".")})
+		}
+		sort.Slice(r, func(i, j int) bool {
+			return strings.Join(r[i][0], ".") < strings.Join(r[j][0], ".")
+		})
+		return r, nil
+	case Convert:
+		c := convert{from: s.From, to: s.To}
+		if c.from == "" {
+			c.from = "json"
+		}
+		if c.to == "" {
+			c.to = "json"
+		}
+		for _, f := range []string{c.from, c.to} {
+			switch f {
+			case "json", "text", "base64", "form":
+			default:
+				return nil, errors.New("unknown format " + f)
+			}
+		}
+		return c, nil
+	case Template:
+		t, err := template.New("payload").Funcs(template.FuncMap{
+			"json": func(v interface{}) (string, error) {
+				b, err := json.Marshal(v)
+				return string(b), err
+			},
+			"base64": func(s string) string {
+				return base64.StdEncoding.EncodeToString([]byte(s))
+			},
+		}).Parse(s.Template)
+		if err != nil {
+			return nil, err
+		}
+		return templateStep{t}, nil
+	}
+	return nil, errors.New("unknown type " + s.Type)
+}
+
+// envelope wraps the payload in an object with metadata of the record. The
+// payload is put as json if it is json, else as a string
+type envelope struct {
+	field    string
+	metadata []string
+}
+
+func (e envelope) apply(r *Record, p *payload) error {
+	value, err := p.json()
+	if err != nil {
+		raw, _ := p.bytes()
+		value = string(raw)
+	}
+	o := map[string]interface{}{e.field: value}
+	for _, m := range e.metadata {
+		switch m {
+		case "topic":
+			o[m] = r.Topic
+		case "partition":
+			o[m] = r.Partition
+		case "offset":
+			if r.ID == "" {
+				o[m] = r.Offset
+			}
+		case "key":
+			o[m] = string(r.Key)
+		case "timestamp":
+			if !r.Timestamp.IsZero() {
+				o[m] = r.Timestamp.UnixNano() / int64(time.Millisecond)
+			}
+		case "headers":
+			headers := r.Headers
+			if headers == nil {
+				headers = map[string]string{}
+			}
+			o[m] = headers
+		case "id":
+			if r.ID != "" {
+				o[m] = r.ID
+			}
+		}
+	}
+	p.setValue(o)
+	return nil
+}
+
+// project keeps only the fields at the paths
+type project [][]string
+
+func (pr project) apply(r *Record, p *payload) error {
+	o, err := p.object()
+	if err != nil {
+		return err
+	}
+	kept := make(map[string]interface{})
+	for _, path := range pr {
+		if v, ok := get(o, path); ok {
+			set(kept, path, v)
+		}
+	}
+	p.setValue(kept)
+	return nil
+}
+
+// rename moves the fields at the first paths to the second ones
+type rename [][2][]string
+
+func (rn rename) apply(r *Record, p *payload) error {
+	o, err := p.object()
+	if err != nil {
+		return err
+	}
+	moved := make(map[string]interface{})
+	for _, fromTo := range rn {
+		if v, ok := get(o, fromTo[0]); ok {
+			remove(o, fromTo[0])
+			moved[strings.Join(fromTo[1], ".")] = v
+		}
+	}
+	for _, fromTo := range rn {
+		if v, ok := moved[strings.Join(fromTo[1], ".")]; ok {
+			set(o, fromTo[1], v)
+		}
+	}
+	p.setValue(o)
+	return nil
+}
+
+// get returns the value at path of o
+func get(o map[string]interface{}, path []string) (interface{}, bool) {
+	var v interface{} = o
+	for _, field := range path {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[field]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// set sets the value at path of o, creating the objects on the way
+func set(o map[string]interface{}, path []string, v interface{}) {
+	for _, field := range path[:len(path)-1] {
+		next, ok := o[field].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			o[field] = next
+		}
+		o = next
+	}
+	o[path[len(path)-1]] = v
+}
+
+// remove deletes the value at path of o
+func remove(o map[string]interface{}, path []string) {
+	for _, field := range path[:len(path)-1] {
+		next, ok := o[field].(map[string]interface{})
+		if !ok {
+			return
+		}
+		o = next
+	}
+	delete(o, path[len(path)-1])
+}
+
+// convert reads the payload in one format and writes it in another. text is
+// the bytes as they are, so json to text keeps json and text to json makes a
+// json string. base64 decodes to and encodes from text, form is a flat json
+// object
+type convert struct {
+	from, to string
+}
+
+func (c convert) apply(r *Record, p *payload) error {
+	var value interface{} // decoded json, or []byte for text
+	switch c.from {
+	case "json":
+		v, err := p.json()
+		if err != nil {
+			return err
+		}
+		value = v
+	case "text":
+		b, err := p.bytes()
+		if err != nil {
+			return err
+		}
+		value = b
+	case "base64":
+		b, err := p.bytes()
+		if err != nil {
+			return err
+		}
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b)))
+		if err != nil {
+			return fmt.Errorf("payload is not base64: %v", err)
+		}
+		value = decoded
+	case "form":
+		b, err := p.bytes()
+		if err != nil {
+			return err
+		}
+		values, err := url.ParseQuery(string(b))
+		if err != nil {
+			return fmt.Errorf("payload is not a form: %v", err)
+		}
+		o := make(map[string]interface{}, len(values))
+		for k, v := range values {
+			if len(v) == 1 {
+				o[k] = v[0]
+			} else {
+				list := make([]interface{}, len(v))
+				for i := range v {
+					list[i] = v[i]
+				}
+				o[k] = list
+			}
+		}
+		value = o
+	}
+
+	switch c.to {
+	case "json":
+		if b, ok := value.([]byte); ok {
+			value = string(b)
+		}
+		p.setValue(value)
+	case "text", "base64":
+		b, ok := value.([]byte)
+		if !ok {
+			var err error
+			if b, err = json.Marshal(value); err != nil {
+				return err
+			}
+		}
+		if c.to == "base64" {
+			b = []byte(base64.StdEncoding.EncodeToString(b))
+		}
+		p.setRaw(b)
+	case "form":
+		o, ok := value.(map[string]interface{})
+		if !ok {
+			return errors.New("only a json object converts to a form")
+		}
+		form := url.Values{}
+		for k, v := range o {
+			switch t := v.(type) {
+			case string:
+				form.Add(k, t)
+			case []interface{}:
+				for _, item := range t {
+					form.Add(k, scalar(item))
+				}
+			default:
+				form.Add(k, scalar(t))
+			}
+		}
+		p.setRaw([]byte(form.Encode()))
+	}
+	return nil
+}
+
+// scalar formats v for a form, strings as they are and the rest as json
+func scalar(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// templateStep renders the payload with a text/template. The template sees
+// .Value, the payload as json or else a string, .Raw, the payload as a
+// string, and .Topic, .Partition, .Offset, .ID, .Key, .Timestamp in epoch
+// millis and .Headers of the record. json and base64 functions encode values
+type templateStep struct {
+	t *template.Template
+}
+
+type templateData struct {
+	Value     interface{}
+	Raw       string
+	Topic     string
+	Partition int32
+	Offset    int64
+	ID        string
+	Key       string
+	Timestamp int64
+	Headers   map[string]string
+}
+
+func (ts templateStep) apply(r *Record, p *payload) error {
+	raw, err := p.bytes()
+	if err != nil {
+		return err
+	}
+	value, err := p.json()
+	if err != nil {
+		value = string(raw)
+	}
+	data := templateData{
+		Value:     value,
+		Raw:       string(raw),
+		Topic:     r.Topic,
+		Partition: r.Partition,
+		Offset:    r.Offset,
+		ID:        r.ID,
+		Key:       string(r.Key),
+		Timestamp: -1,
+		Headers:   r.Headers,
+	}
+	if !r.Timestamp.IsZero() {
+		data.Timestamp = r.Timestamp.UnixNano() / int64(time.Millisecond)
+	}
+	var out bytes.Buffer
+	if err := ts.t.Execute(&out, data); err != nil {
+		return err
+	}
+	p.setRaw(out.Bytes())
+	return nil
+}
@@ -0,0 +1,224 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Conf holds the steps the payload of a message is reshaped by before it is
+// posted, applied in order
+type Conf struct {
+	Steps       []Step `json:"steps"`
+	Batch       string `json:"batch"`        //body of a batch of transformed payloads, json_array or ndjson, defaults to the batch format of the connection
+	ContentType string `json:"content_type"` //content type of the transformed payload, defaults to the one of the connection
+	OnError     string `json:"on_error"`     //fail (default) fails a message that can't be transformed like a sink call that is not retried, raw posts it untransformed
+}
+
+// Step is one transformation, Type selects which of the other fields apply
+type Step struct {
+	Type string `json:"type"` //envelope, project, rename, convert or template
+
+	Field    string   `json:"field"`    //envelope: field the payload is put under, defaults to value
+	Metadata []string `json:"metadata"` //envelope: topic, partition, offset, key, timestamp, headers or id, defaults to all
+
+	Fields []string          `json:"fields"` //project: dot separated paths of the fields that are kept
+	Rename map[string]string `json:"rename"` //rename: dot separated path of a field to its new path
+
+	From string `json:"from"` //convert: format of the payload, json, text, base64 or form, defaults to json
+	To   string `json:"to"`   //convert: format it is converted to, defaults to json
+
+	Template string `json:"template"` //template: go text/template of the payload
+}
+
+// step types
+const (
+	Envelope = "envelope"
+	Project  = "project"
+	Rename   = "rename"
+	Convert  = "convert"
+	Template = "template"
+)
+
+// batch bodies
+const (
+	JSONArray = "json_array"
+	NDJSON    = "ndjson"
+)
+
+// on_error modes
+const (
+	Fail = "fail"
+	Raw  = "raw"
+)
+
+// Record is the source record of a message, what the steps read metadata from
+type Record struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	ID        string // id of records without offsets, such as pulsar messages
+	Key       []byte
+	Timestamp time.Time // zero if the record has none
+	Headers   map[string]string
+	Value     []byte
+}
+
+// Msg is implemented by messages whose payload can be transformed
+type Msg interface {
+	// GetTransformRecord returns the source record of the message
+	GetTransformRecord() Record
+	// SetPayload replaces the payload the message is posted with
+	SetPayload(payload []byte)
+}
+
+// Transformer transforms the value of a record before the steps, such as a
+// plugin
+type Transformer interface {
+	Transform(r Record) ([]byte, error)
+}
+
+// step transforms the payload of r
+type step interface {
+	apply(r *Record, p *payload) error
+}
+
+// Pipeline applies the steps of a Conf
+type Pipeline struct {
+	plugin      Transformer // nil if there is none
+	steps       []step
+	batch       string
+	contentType string
+	raw         bool
+}
+
+// GetPipeline returns the Pipeline of conf, nil if it has neither steps nor a
+// batch format. An invalid conf is fatal
+func GetPipeline(conf Conf) *Pipeline {
+	p, err := newPipeline(conf)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	return p
+}
+
+func newPipeline(conf Conf) (*Pipeline, error) {
+	if len(conf.Steps) == 0 && conf.Batch == "" {
+		return nil, nil
+	}
+	p := &Pipeline{contentType: conf.ContentType}
+	switch conf.Batch {
+	case "", JSONArray, NDJSON:
+		p.batch = conf.Batch
+	default:
+		return nil, errors.New("invalid transform batch " + conf.Batch)
+	}
+	switch conf.OnError {
+	case "", Fail:
+	case Raw:
+		p.raw = true
+	default:
+		return nil, errors.New("invalid transform on_error " + conf.OnError)
+	}
+	for i, s := range conf.Steps {
+		compiled, err := compile(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid transform step %d: %v", i, err)
+		}
+		p.steps = append(p.steps, compiled)
+	}
+	return p, nil
+}
+
+// WithPlugin returns a copy of p, which may be nil, that transforms the
+// value with t before the steps
+func (p *Pipeline) WithPlugin(t Transformer) *Pipeline {
+	with := &Pipeline{}
+	if p != nil {
+		*with = *p
+	}
+	with.plugin = t
+	return with
+}
+
+// Apply returns the payload of r after the plugin and every step
+func (p *Pipeline) Apply(r Record) ([]byte, error) {
+	if p.plugin != nil {
+		value, err := p.plugin.Transform(r)
+		if err != nil {
+			return nil, err
+		}
+		r.Value = value
+	}
+	current := &payload{raw: r.Value, hasRaw: true}
+	for _, s := range p.steps {
+		if err := s.apply(&r, current); err != nil {
+			return nil, err
+		}
+	}
+	return current.bytes()
+}
+
+// Transform sets the payload of msg if it is a Msg. It returns false if msg
+// can't be transformed and is to fail
+func (p *Pipeline) Transform(msg interface{}) (bool, error) {
+	m, ok := msg.(Msg)
+	if p == nil || !ok {
+		return true, nil
+	}
+	transformed, err := p.Apply(m.GetTransformRecord())
+	if err != nil {
+		return p.raw, err
+	}
+	m.SetPayload(transformed)
+	return true, nil
+}
+
+// Batch returns the body of a batch of payloads and its content type, false
+// if the batch format of the connection is kept
+func (p *Pipeline) Batch(payloads [][]byte) ([]byte, string, bool) {
+	if p == nil || p.batch == "" {
+		return nil, "", false
+	}
+	var body bytes.Buffer
+	if p.batch == NDJSON {
+		for _, b := range payloads {
+			body.Write(b)
+			body.WriteByte('\n')
+		}
+		return body.Bytes(), p.orContentType("application/x-ndjson"), true
+	}
+	body.WriteByte('[')
+	for i, b := range payloads {
+		if i > 0 {
+			body.WriteByte(',')
+		}
+		if json.Valid(b) {
+			body.Write(b)
+		} else {
+			s, _ := json.Marshal(string(b))
+			body.Write(s)
+		}
+	}
+	body.WriteByte(']')
+	return body.Bytes(), p.orContentType("application/json"), true
+}
+
+func (p *Pipeline) orContentType(fallback string) string {
+	if p.contentType != "" {
+		return p.contentType
+	}
+	return fallback
+}
+
+// ContentType returns the content type of transformed payloads, empty to
+// keep the one of the connection
+func (p *Pipeline) ContentType() string {
+	if p == nil {
+		return ""
+	}
+	return p.contentType
+}
@@ -0,0 +1,150 @@
+package transform
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func record(value string) Record {
+	return Record{
+		Topic:     "orders",
+		Partition: 3,
+		Offset:    42,
+		Key:       []byte("order-17"),
+		Timestamp: time.Unix(1600000000, 0),
+		Headers:   map[string]string{"tenant": "acme"},
+		Value:     []byte(value),
+	}
+}
+
+func apply(t *testing.T, steps []Step, value string) string {
+	out, err := GetPipeline(Conf{Steps: steps}).Apply(record(value))
+	assert.NoError(t, err)
+	return string(out)
+}
+
+func TestEnvelope(t *testing.T) {
+	assert.JSONEq(t, `{"value":{"id":12345678901234567890},"topic":"orders","partition":3,"offset":42,"key":"order-17","timestamp":1600000000000,"headers":{"tenant":"acme"}}`,
+		apply(t, []Step{{Type: Envelope}}, `{"id":12345678901234567890}`))
+	assert.JSONEq(t, `{"payload":"not json","key":"order-17"}`,
+		apply(t, []Step{{Type: Envelope, Field: "payload", Metadata: []string{"key"}}}, `not json`))
+
+	r := record(`{}`)
+	r.ID, r.Timestamp = "1:2:-1", time.Time{}
+	out, _ := GetPipeline(Conf{Steps: []Step{{Type: Envelope, Metadata: []string{"offset", "id", "timestamp"}}}}).Apply(r)
+	assert.JSONEq(t, `{"value":{},"id":"1:2:-1"}`, string(out))
+}
+
+func TestProjectAndRename(t *testing.T) {
+	value := `{"order":{"id":"o1","total":10,"internal":true},"customer":{"id":"c1","email":"a@b"},"debug":1}`
+	assert.JSONEq(t, `{"order":{"id":"o1","total":10},"customer":{"id":"c1"}}`,
+		apply(t, []Step{{Type: Project, Fields: []string{"order.id", "order.total", "customer.id", "missing.field"}}}, value))
+	assert.JSONEq(t, `{"orderId":"o1","order":{"total":10,"internal":true},"customer":{"id":"c1","email":"a@b"},"meta":{"debug":1}}`,
+		apply(t, []Step{{Type: Rename, Rename: map[string]string{"order.id": "orderId", "debug": "meta.debug"}}}, value))
+	// swaps do not overwrite each other
+	assert.JSONEq(t, `{"a":2,"b":1}`, apply(t, []Step{{Type: Rename, Rename: map[string]string{"a": "b", "b": "a"}}}, `{"a":1,"b":2}`))
+
+	_, err := GetPipeline(Conf{Steps: []Step{{Type: Project, Fields: []string{"a"}}}}).Apply(record(`[1]`))
+	assert.EqualError(t, err, "payload is not a json object")
+}
+
+func TestConvert(t *testing.T) {
+	assert.Equal(t, "eyJhIjoxfQ==", apply(t, []Step{{Type: Convert, From: "text", To: "base64"}}, `{"a":1}`))
+	assert.Equal(t, `{"a":1}`, apply(t, []Step{{Type: Convert, From: "base64", To: "text"}}, "eyJhIjoxfQ=="))
+	assert.Equal(t, `"plain"`, apply(t, []Step{{Type: Convert, From: "text"}}, "plain"))
+	assert.Equal(t, "a=1&b=x&c=1&c=2", apply(t, []Step{{Type: Convert, To: "form"}}, `{"a":1,"b":"x","c":[1,2]}`))
+	assert.JSONEq(t, `{"a":"1","c":["1","2"]}`, apply(t, []Step{{Type: Convert, From: "form"}}, "a=1&c=1&c=2"))
+
+	_, err := GetPipeline(Conf{Steps: []Step{{Type: Convert, To: "text"}}}).Apply(record("plain"))
+	assert.Error(t, err)
+}
+
+func TestTemplate(t *testing.T) {
+	tmpl := `{"k":"{{.Key}}","o":{{.Offset}},"id":{{json .Value.id}},"t":"{{.Headers.tenant}}","m":"{{or .Value.missing ""}}","ts":{{.Timestamp}}}`
+	assert.JSONEq(t, `{"k":"order-17","o":42,"id":"x\"1","t":"acme","m":"","ts":1600000000000}`,
+		apply(t, []Step{{Type: Template, Template: tmpl}}, `{"id":"x\"1"}`))
+
+	// steps compose: project, then envelope, then render
+	assert.Equal(t, "orders/3: {\"id\":1}",
+		apply(t, []Step{
+			{Type: Project, Fields: []string{"id"}},
+			{Type: Envelope, Metadata: []string{"topic", "partition"}},
+			{Type: Template, Template: `{{.Value.topic}}/{{.Value.partition}}: {{json .Value.value}}`},
+		}, `{"id":1,"other":2}`))
+}
+
+func TestGetPipeline(t *testing.T) {
+	p, err := newPipeline(Conf{})
+	assert.Nil(t, p)
+	assert.NoError(t, err)
+	for _, conf := range []Conf{
+		{Steps: []Step{{Type: "unknown"}}},
+		{Steps: []Step{{Type: Project}}},
+		{Steps: []Step{{Type: Convert, To: "xml"}}},
+		{Steps: []Step{{Type: Envelope, Metadata: []string{"size"}}}},
+		{Steps: []Step{{Type: Template, Template: "{{"}}},
+		{Batch: "csv"},
+		{Batch: JSONArray, OnError: "drop"},
+	} {
+		_, err := newPipeline(conf)
+		assert.Error(t, err, "%v", conf)
+	}
+}
+
+type msg struct {
+	record  Record
+	payload []byte
+}
+
+func (m *msg) GetTransformRecord() Record {
+	return m.record
+}
+
+func (m *msg) SetPayload(payload []byte) {
+	m.payload = payload
+}
+
+func TestTransform(t *testing.T) {
+	var none *Pipeline
+	ok, err := none.Transform(&msg{})
+	assert.True(t, ok)
+	assert.NoError(t, err)
+
+	p := GetPipeline(Conf{Steps: []Step{{Type: Project, Fields: []string{"a"}}}})
+	m := &msg{record: record(`{"a":1,"b":2}`)}
+	ok, err = p.Transform(m)
+	assert.True(t, ok)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"a":1}`, string(m.payload))
+	// idempotent, the record is never changed
+	p.Transform(m)
+	assert.Equal(t, `{"a":1}`, string(m.payload))
+
+	m = &msg{record: record(`not json`)}
+	ok, err = p.Transform(m)
+	assert.False(t, ok)
+	assert.Error(t, err)
+	assert.Nil(t, m.payload)
+
+	p = GetPipeline(Conf{Steps: []Step{{Type: Project, Fields: []string{"a"}}}, OnError: Raw})
+	ok, err = p.Transform(m)
+	assert.True(t, ok)
+	assert.Error(t, err)
+}
+
+func TestBatch(t *testing.T) {
+	_, _, ok := GetPipeline(Conf{Steps: []Step{{Type: Envelope}}}).Batch(nil)
+	assert.False(t, ok)
+
+	payloads := [][]byte{[]byte(`{"a":1}`), []byte(`text`)}
+	body, contentType, ok := GetPipeline(Conf{Batch: JSONArray}).Batch(payloads)
+	assert.True(t, ok)
+	assert.Equal(t, `[{"a":1},"text"]`, string(body))
+	assert.Equal(t, "application/json", contentType)
+
+	body, contentType, _ = GetPipeline(Conf{Batch: NDJSON, ContentType: "text/plain"}).Batch(payloads)
+	assert.Equal(t, "{\"a\":1}\ntext\n", string(body))
+	assert.Equal(t, "text/plain", contentType)
+}